@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ========================================
+// RESULTAAT CACHE (zelfde foto + check = zelfde oordeel)
+// ========================================
+
+// cachedVerdict is het oordeel van het model dat we bij een herhaalde upload teruggeven
+type cachedVerdict struct {
+	Key            string         `json:"key"`
+	Result         string         `json:"result"`
+	Reason         string         `json:"reason,omitempty"`
+	Provider       string         `json:"provider"`
+	Model          string         `json:"model"`
+	Findings       []imageFinding `json:"findings,omitempty"`
+	ReasonCode     string         `json:"reasonCode,omitempty"`
+	SuggestedCheck string         `json:"suggestedCheck,omitempty"`
+	Relevance      *relevance     `json:"relevance,omitempty"`
+	Level          []levelReading `json:"level,omitempty"`
+	SubFindings    []subFinding   `json:"subFindings,omitempty"`
+	ExpiresAt      time.Time      `json:"expiresAt"`
+}
+
+// resultCache is een LRU in memory met een vaste TTL. Met een bestand erbij
+// (JSON lines) overleeft de cache een herstart. Het bestand groeit met elke put en
+// wordt herschreven zodra het twee keer zoveel regels heeft als maxEntries.
+type resultCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List               // voorkant = meest recent gebruikt
+	entries map[string]*list.Element // key -> element met *cachedVerdict
+	file    *os.File                 // nil = alleen in memory
+	path    string
+	lines   int // regels in het bestand, inclusief vervangen en verdrongen resultaten
+}
+
+// openResultCache maakt de cache en laadt nog geldige resultaten uit path (leeg = alleen in memory)
+func openResultCache(cfg cacheConfig) (*resultCache, error) {
+	cache := &resultCache{
+		ttl:        time.Duration(cfg.TTL),
+		maxEntries: cfg.MaxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		path:       cfg.File,
+	}
+	if cfg.File == "" {
+		return cache, nil
+	}
+
+	// Inlezen en meteen compact herschrijven, zodat verlopen resultaten verdwijnen
+	if data, err := os.ReadFile(cfg.File); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		now := time.Now()
+		for scanner.Scan() {
+			var verdict cachedVerdict
+			if err := json.Unmarshal(scanner.Bytes(), &verdict); err != nil || verdict.ExpiresAt.Before(now) {
+				continue // kapotte of verlopen regel: overslaan, de cache is geen administratie
+			}
+			cache.putLocked(&verdict)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read cache file: %w", err)
+	}
+
+	if err := cache.rewriteLocked(); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// rewriteLocked schrijft de geldige resultaten naar een nieuw bestand en vervangt het oude
+// daarmee (c.mu moet vast zijn, of de cache is nog niet in gebruik)
+func (c *resultCache) rewriteLocked() error {
+	tmp, err := os.OpenFile(c.path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("open cache file: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	now, lines := time.Now(), 0
+	for e := c.order.Back(); e != nil; e = e.Prev() {
+		verdict := e.Value.(*cachedVerdict)
+		if verdict.ExpiresAt.Before(now) {
+			continue
+		}
+		line, _ := json.Marshal(verdict)
+		writer.Write(append(line, '\n'))
+		lines++
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cache file: %w", err)
+	}
+	if err := os.Rename(c.path+".tmp", c.path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("replace cache file: %w", err)
+	}
+
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file, c.lines = tmp, lines
+	return nil
+}
+
+// get geeft een geldig resultaat voor key
+func (c *resultCache) get(key string) (cachedVerdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return cachedVerdict{}, false
+	}
+	verdict := element.Value.(*cachedVerdict)
+	if time.Now().After(verdict.ExpiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return cachedVerdict{}, false
+	}
+	c.order.MoveToFront(element)
+	return *verdict, true
+}
+
+// put slaat een resultaat op; de oudste resultaten vallen eruit boven maxEntries
+func (c *resultCache) put(verdict cachedVerdict) error {
+	verdict.ExpiresAt = time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.putLocked(&verdict)
+	if c.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(verdict)
+	if err != nil {
+		return err
+	}
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	// Vervangen en verdrongen resultaten blijven in het bestand staan tot we herschrijven
+	if c.lines++; c.lines > 2*c.maxEntries {
+		return c.rewriteLocked()
+	}
+	return nil
+}
+
+func (c *resultCache) putLocked(verdict *cachedVerdict) {
+	if element, ok := c.entries[verdict.Key]; ok {
+		element.Value = verdict
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[verdict.Key] = c.order.PushFront(verdict)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedVerdict).Key)
+	}
+}
+
+// close sluit het cache bestand
+func (c *resultCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// resultCacheKey combineert tenant, tier, check, promptversie en de foto hash.
+// De tenant zit in de key zodat een klant nooit het oordeel van een ander ziet.
+func resultCacheKey(tenant, tier string, check checkDefinition, photoHash string) string {
+	sum := sha256.Sum256([]byte(tenant + "\x00" + tier + "\x00" + check.ID + "\x00" + check.promptVersion(tier) + "\x00" + photoHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// photoHash is de SHA-256 van de genormaliseerde foto: bij een JPEG zonder de
+// metadata segmenten (EXIF, XMP, commentaar), zodat dezelfde foto met andere
+// metadata dezelfde hash krijgt. Geen decode nodig, dus geen extra geheugen.
+func photoHash(photoBytes []byte) string {
+	h := sha256.New()
+	writeJPEGWithoutMetadata(h, photoBytes)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeJPEGWithoutMetadata schrijft de JPEG zonder APP1-APP15 en COM segmenten naar w.
+// Geen geldige JPEG (of PNG e.d.)? Dan gaan de bytes ongewijzigd door.
+func writeJPEGWithoutMetadata(w io.Writer, data []byte) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		w.Write(data)
+		return
+	}
+
+	w.Write(data[:2]) // SOI
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		isMetadata := (marker >= 0xE1 && marker <= 0xEF) || marker == 0xFE
+		if !isMetadata {
+			w.Write(data[pos:end])
+		}
+		pos = end
+		if marker == 0xDA { // SOS: vanaf hier alleen nog beelddata
+			break
+		}
+	}
+	w.Write(data[pos:])
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResultCacheFileStaysBounded(t *testing.T) {
+	cfg := cacheConfig{Enabled: true, TTL: duration(time.Hour), MaxEntries: 3, File: filepath.Join(t.TempDir(), "cache.jsonl")}
+	cache, err := openResultCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		// Steeds dezelfde twee keys plus nieuwe: vervangen en verdrongen regels
+		for _, key := range []string{"a", "b", fmt.Sprintf("photo-%d", i)} {
+			if err := cache.put(cachedVerdict{Key: key, Result: "PASS"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*cfg.MaxEntries {
+		t.Errorf("cache file has %d lines, want at most %d", lines, 2*cfg.MaxEntries)
+	}
+	cache.close()
+
+	// Na een herstart staan de laatste resultaten er nog
+	cache, err = openResultCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.close()
+	for _, key := range []string{"a", "b", "photo-49"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s missing after reopen", key)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// checkDefinition beschrijft één installatiecheck met de prompts per tier
+type checkDefinition struct {
+	ID             string
+	Description    string // wat de foto moet laten zien, voor de classificatie (zie relevance.go)
+	SilverPrompt   string // antwoord alleen PASS of FAIL
+	SilverUserText string
+	GoldPrompt     string // antwoord PASS/FAIL plus uitleg op de tweede regel
+	PhotoMerge     string // bij meer foto's: any, all of majority (leeg = any, zie photos.go)
+
+	// Strengere gold varianten van een check: geen silver route, en de classificatie kent
+	// alleen de check waar ze een variant van zijn.
+	GoldOnly  bool
+	VariantOf string
+
+	// GoldExtra leest de regels na result en reason van het gold antwoord in het oordeel
+	// (bijv. de waterpas, zie level.go). Nil = het antwoord heeft alleen result en reason.
+	GoldExtra func(content string, cfg config, v *verdict)
+
+	// photoMode pair: twee foto's met tijd ertussen. Leeg = de check kent geen pair mode.
+	PairPrompt string        // wat er tussen de foto's veranderd moet zijn (het antwoordformaat komt erbij)
+	PairMinGap time.Duration // standaard minimale tijd tussen de foto's (EXIF)
+}
+
+// goldUserText is de user message voor alle gold checks
+const goldUserText = "Analyze this installation photo."
+
+// findCheck zoekt een check op id
+func findCheck(id string) (checkDefinition, bool) {
+	for _, check := range laundryChecks {
+		if check.ID == id {
+			return check, true
+		}
+	}
+	return checkDefinition{}, false
+}
+
+// classID is de check die de classificatie voor deze check herkent
+func (c checkDefinition) classID() string {
+	if c.VariantOf != "" {
+		return c.VariantOf
+	}
+	return c.ID
+}
+
+// promptVersion is een korte hash van de prompts van een tier. Verandert een
+// prompt, dan verandert de versie en worden oude cache resultaten niet meer gebruikt.
+func (c checkDefinition) promptVersion(tier string) string {
+	prompt := c.SilverPrompt + "\x00" + c.SilverUserText
+	if tier == "gold" {
+		prompt = c.GoldPrompt + "\x00" + goldUserText
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
+
+// checkIDs geeft de ids van alle checks in vaste volgorde
+func checkIDs() []string {
+	ids := make([]string, 0, len(laundryChecks))
+	for _, check := range laundryChecks {
+		ids = append(ids, check.ID)
+	}
+	return ids
+}
+
+// ========================================
+// LAUNDRY INSTALLATION CHECKS
+// ========================================
+
+var laundryChecks = []checkDefinition{
+	{
+		ID:             "waterFeedAttachedToTap",
+		Description:    "Water inlet hose of the appliance connected to a tap, valve or wall outlet",
+		SilverUserText: "Analyze this installation photo.",
+		SilverPrompt: `You are a quality control expert for home appliance water connections.
+
+		PHOTO QUALITY CHECK FIRST:
+		- First check if the photo is clear enough for proper analysis
+		- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+		- Only proceed with the main check if photo quality is acceptable
+
+		Evaluate if the water supply system is properly connected and functional.
+
+		WHAT TO LOOK FOR:
+		- Water inlet hose(s) present and connected (may include gray/silver flexible hoses)
+		- Connection to water supply point (tap, valve, or wall outlet)
+		- Leak detection device (aquastop) if present - should be connected
+		- No visible water leaks or loose connections
+		- Hoses are not kinked or damaged
+
+		RESPONSE FORMAT - FOLLOW EXACTLY:
+		- Respond with ONLY "PASS" or "FAIL"
+		- PASS: Water supply system is properly connected AND photo quality is good
+		- FAIL: Missing connection, visible leaks, damaged components OR photo is too blurry for analysis
+		- No explanations needed`,
+		GoldPrompt: `You are a quality control expert for home appliance water connections.
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+Evaluate if the water supply system is properly connected and functional.
+
+WHAT TO LOOK FOR:
+- Water inlet hose(s) present and connected (may include gray/silver flexible hoses)
+- Connection to water supply point (tap, valve, or wall outlet)
+- Leak detection device (aquastop) if present - should be connected
+- No visible water leaks or loose connections
+- Hoses are not kinked or damaged
+
+RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed
+- Example:
+PASS
+Water supply properly connected with no visible leaks
+
+or
+
+FAIL
+No water connection visible or loose hoses detected`,
+	},
+	{
+		ID:             "drainHoseInDrain",
+		Description:    "Drain hose of the appliance placed in a drain, standpipe or sink connection",
+		GoldExtra:      readDrainFindings, // schade en aansluiting als losse deelbevindingen (zie drain.go)
+		SilverUserText: "Analyze this drain hose connection.",
+		SilverPrompt: `You are a quality control expert for appliance installations.
+
+			PHOTO QUALITY CHECK FIRST:
+			- First check if the photo is clear enough for proper analysis
+			- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+			- Only proceed with the main check if photo quality is acceptable
+
+			CHECK: Is the drain hose connected to drainage?
+
+			DRAIN HOSE: Large ribbed gray/blue corrugated hose (NOT the smooth water supply hose)
+
+			PASS CONDITIONS:
+			- Drain hose goes downward toward floor/wall
+			- Hose appears to enter a drain, pipe, or opening
+			- Hose is positioned for proper drainage (even if full connection not visible)
+
+			FAIL CONDITIONS ONLY:
+			- Drain hose is completely loose and hanging in the air
+			- Hose is lying flat on the floor disconnected
+			- No drain hose visible at all in the image
+			- Only water supply hose visible (smooth, not ribbed)
+			- Photo is too blurry for proper analysis
+
+			IMPORTANT: If the drain hose goes downward and appears connected to drainage (even if you cannot see the exact connection point), respond PASS.
+
+			Respond with ONLY "PASS" or "FAIL"`,
+		GoldPrompt: `You are a quality control expert for appliance installations.
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+CHECK: Is the drain hose connected to drainage?
+
+DRAIN HOSE: Large ribbed gray/blue corrugated hose (NOT the smooth water supply hose)
+
+PASS CONDITIONS:
+- Drain hose goes downward toward floor/wall
+- Hose appears to enter a drain, pipe, or opening
+- Hose is positioned for proper drainage (even if full connection not visible)
+
+FAIL CONDITIONS ONLY:
+- Drain hose is completely loose and hanging in the air
+- Hose is lying flat on the floor disconnected
+- No drain hose visible at all in the image
+- Only water supply hose visible (smooth or ribbed)
+
+DAMAGE AND ROUTING - judge each one separately, UNKNOWN if it cannot be seen on the photo:
+- HOSE_DAMAGE: FAIL if the drain hose is cut off, kinked, crushed or torn, or the drain pipe is broken
+- HOSE_SUPPORT: FAIL if the hose has no hose bracket/hook or anti-siphon loop (the hose must go up high before it goes down into the drain)
+- HOSE_INSERTION: FAIL if the hose is pushed too far into the standpipe (deeper than about 15 cm, or sealed airtight)
+- If any of these is FAIL, the first line is FAIL as well
+
+RESPONSE FORMAT - FOLLOW EXACTLY (5 lines):
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed
+- Third line: "HOSE_DAMAGE: " then PASS, FAIL or UNKNOWN, " - " and a brief explanation
+- Fourth line: "HOSE_SUPPORT: " then PASS, FAIL or UNKNOWN, " - " and a brief explanation
+- Fifth line: "HOSE_INSERTION: " then PASS, FAIL or UNKNOWN, " - " and a brief explanation
+- Example:
+FAIL
+Drain hose in standpipe but kinked behind the machine
+HOSE_DAMAGE: FAIL - hose kinked behind the machine
+HOSE_SUPPORT: PASS - hose hooked in a bracket above the standpipe
+HOSE_INSERTION: UNKNOWN - end of the hose not visible`,
+	},
+	{
+		ID:             "powerCordInSocket",
+		Description:    "Power cord of the appliance plugged into a wall socket",
+		SilverUserText: "Analyze this power cord connection.",
+		SilverPrompt: `You are a quality control expert for appliance installations.
+
+		PHOTO QUALITY CHECK FIRST:
+		- First check if the photo is clear enough for proper analysis
+		- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+		- Only proceed with the main check if photo quality is acceptable
+
+		CHECK: Is the power plug connected to an electrical outlet?
+
+		WHAT TO LOOK FOR:
+		- A power plug inserted into any type of electrical socket/outlet
+		- This can be: wall socket, power strip, junction box, or any electrical connection point
+		- The plug should be inserted (even if partially visible or in corner of image)
+
+		PASS = Power plug is connected to ANY electrical outlet (wall, strip, box, etc.) AND photo quality is good
+		FAIL = Plug clearly not connected, hanging loose, no electrical connection visible OR photo is too blurry for analysis
+
+		Even if the connection is small or in corner of image, if you can see a plug connected to power, respond PASS.
+
+		Respond with ONLY "PASS" or "FAIL"`,
+		GoldPrompt: `You are a quality control expert for appliance installations.
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+CHECK: Is the power plug connected to an electrical outlet?
+
+WHAT TO LOOK FOR:
+- A power plug inserted into any type of electrical socket/outlet
+- This can be: wall socket, power strip, junction box, or any electrical connection point
+- The plug should be inserted (even if partially visible or in corner of image)
+
+PASS = Power plug is connected to ANY electrical outlet (wall, strip, box, etc.)
+FAIL = Plug clearly not connected, hanging loose, or no electrical connection visible
+
+RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed`,
+	},
+	{
+		ID:             "rinseCycleMachineIsOn",
+		Description:    "Control panel or display of the appliance showing a running (rinse) program",
+		SilverUserText: "Analyze if the machine is running rinse cycle.",
+		SilverPrompt: `You are a quality control expert for appliance installations.
+
+		PHOTO QUALITY CHECK FIRST:
+		- First check if the photo is clear enough for proper analysis
+		- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+		- Only proceed with the main check if photo quality is acceptable
+
+		CHECK: Is the machine is powered on?
+		
+		PASS = Machine display is active/lit up showing time or cycle information AND photo quality is good
+		FAIL = Display is off/dark, no machine visible OR photo is too blurry for analysis
+		
+		Respond with ONLY "PASS" or "FAIL"`,
+		GoldPrompt: `You are a quality control expert for appliance installations.
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+CHECK: Is the machine powered on?
+
+PASS = Machine display is active/lit up showing time or cycle information
+FAIL = Display is off/dark, or no machine visible
+
+RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed`,
+		PairPrompt: `You are a quality control expert for appliance installations.
+
+You get two photos of the same machine. The first photo was taken earlier than the second one; the user message says how much time is between them.
+
+PHOTO QUALITY CHECK FIRST:
+- If either photo is too blurry or unclear to compare, the answer is FAIL
+
+CHECK: Did the machine actually run a (rinse) program between the two photos, rather than just being switched on?
+
+PASS = The display or countdown changed between the photos (less remaining time, another program phase, other indicator lights)
+       OR water is visible in the drum (through the door glass)
+FAIL = Both photos show the same display state and no water in the drum, the display is off,
+       or the photos do not show the same machine`,
+		PairMinGap: time.Minute, // een countdown in minuten moet minstens één stap gezet hebben
+	},
+	{
+		ID:             "shippingBoltsRemoved",
+		Description:    "Back of a washing machine where the shipping/transit bolts are removed",
+		PhotoMerge:     "all", // elke boutpositie moet leeg zijn
+		SilverUserText: "Analyze if shipping bolts have been removed.",
+		SilverPrompt: `You are a quality control expert for home appliance installations (washing machines, dryers, dishwashers, etc.).
+
+	PHOTO QUALITY CHECK FIRST:
+	- First check if the photo is clear enough for proper analysis
+	- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+	- Only proceed with the main check if photo quality is acceptable
+
+	Check if the shipping bolts/transit bolts have been removed from the appliance.
+
+	PASS CONDITIONS:
+	- Shipping bolts have been removed from their original mounting positions in the appliance
+	- If shipping bolts are visible on top of the machine or next to it, this means they were successfully REMOVED and should be counted as PASS
+	- Bolt holes in the appliance are empty (no bolts screwed into the appliance itself)
+	- Appliance is properly positioned without transport locks
+
+	FAIL CONDITIONS:
+	- Shipping bolts are still screwed into the appliance in their original positions
+	- Appliance is still locked in transport position with bolts in place
+
+	RESPONSE FORMAT - FOLLOW EXACTLY:
+	- Respond with ONLY "PASS" or "FAIL"
+	- PASS: Shipping bolts have been removed from the appliance (even if visible on top/side) AND photo quality is good
+	- FAIL: Shipping bolts are still installed in the appliance OR photo is too blurry for analysis
+	- No explanations needed`,
+		GoldPrompt: `You are a quality control expert for home appliance installations (washing machines, dryers, dishwashers, etc.).
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+Check if the shipping bolts/transit bolts have been removed from the appliance.
+
+PASS CONDITIONS:
+- Shipping bolts have been removed from their original mounting positions in the appliance
+- If shipping bolts are visible on top of the machine or next to it, this means they were successfully REMOVED and should be counted as PASS
+- Bolt holes in the appliance are empty (no bolts screwed into the appliance itself)
+- Appliance is properly positioned without transport locks
+
+FAIL CONDITIONS:
+- Shipping bolts are still screwed into the appliance in their original positions
+- Appliance is still locked in transport position with bolts in place
+
+RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed`,
+	},
+	{
+		ID:             "levelIndicatorPresent",
+		Description:    "Spirit level placed on top of the appliance",
+		SilverUserText: "Analyze if spirit level is present.",
+		SilverPrompt: `You are a quality control expert for home appliance installations (washing machines, dryers, dishwashers, etc.).
+
+	PHOTO QUALITY CHECK FIRST:
+	- First check if the photo is clear enough for proper analysis
+	- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with: FAIL
+	- Only proceed with the main check if photo quality is acceptable
+
+	Check if a spirit level/level indicator is present on the appliance.
+	Look for: spirit level tool visible on or near the appliance, level indicator present, measuring tool for leveling.
+
+	RESPONSE FORMAT - FOLLOW EXACTLY:
+	- Respond with ONLY "PASS" or "FAIL"
+	- PASS: Spirit level/level indicator is present AND photo quality is good
+	- FAIL: Spirit level/level indicator is not visible OR photo is too blurry for analysis
+	- No explanations needed`,
+		GoldPrompt: `You are a quality control expert for home appliance installations (washing machines, dryers, dishwashers, etc.).
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+
+- Only proceed with the main check if photo quality is acceptable
+
+Check if a spirit level/level indicator is present on the appliance.
+Look for: spirit level tool visible on or near the appliance, level indicator present, measuring tool for leveling.
+
+RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed`,
+	},
+	{
+		ID:          levelCheckID,
+		Description: "Spirit level placed on top of the appliance, with a readable bubble",
+		GoldOnly:    true,
+		VariantOf:   "levelIndicatorPresent",
+		PhotoMerge:  "all", // beide richtingen moeten waterpas zijn
+		GoldExtra:   readLevel,
+		GoldPrompt: `You are a quality control expert for home appliance installations (washing machines, dryers, dishwashers, etc.).
+
+PHOTO QUALITY CHECK:
+- First check if the photo is clear enough for proper analysis
+- If the image is too blurry, unclear, or has poor quality that prevents proper evaluation, respond with:
+FAIL
+Photo too blurry - please retake with better focus
+AXIS: unknown
+OFFSET: NONE
+
+- Only proceed with the main check if photo quality is acceptable
+
+CHECK: Is the appliance level? Read the spirit level that lies on the appliance.
+- Find the vial of the spirit level and the bubble in it
+- Estimate how far the bubble is off-centre, in bubble lengths: 0 = exactly between the marks, 0.5 = half a bubble length, 1 = a full bubble length
+- Determine the direction of the spirit level: along the front edge of the appliance (left-right) or along the side (front-back)
+
+PASS = a spirit level lies on the appliance and the bubble is (nearly) centred
+FAIL = no spirit level, the bubble is not readable, or the bubble is clearly off-centre
+
+RESPONSE FORMAT - FOLLOW EXACTLY (4 lines):
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed
+- Third line: "AXIS: left-right", "AXIS: front-back" or "AXIS: unknown"
+- Fourth line: "OFFSET: " and the offset in bubble lengths as a number (e.g. "OFFSET: 0.2"), or "OFFSET: NONE" if no bubble is readable
+- Example:
+PASS
+Spirit level on top, bubble just right of centre
+AXIS: left-right
+OFFSET: 0.2`,
+	},
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ========================================
+// CLASSIFY (stapel foto's zonder gekozen check)
+// ========================================
+
+// classifyEndpoint: POST /api/laundry/gold/v1/{projectNumber}/classify
+const classifyEndpoint = "classify"
+
+// classification is een gedane classificatie met de provider en wat die kostte, zodat judge
+// niet nog een keer classificeert
+type classification struct {
+	relevance
+	Provider string
+	Model    string
+	Usage    tokenUsage
+}
+
+// ClassifyResponse is per foto de check waar hij bewijs voor is, met het oordeel van die check
+type ClassifyResponse struct {
+	ProjectNumber string            `json:"projectNumber"`
+	Photos        []ClassifiedPhoto `json:"photos"`
+}
+
+// ClassifiedPhoto is één foto uit de stapel: de gold response plus wat de classificatie zag
+type ClassifiedPhoto struct {
+	Index     int         `json:"index"` // volgorde in het formulier, vanaf 0
+	Filename  string      `json:"filename,omitempty"`
+	Check     *string     `json:"check"`               // null = de foto is voor geen enkele check bewijs
+	Unmatched bool        `json:"unmatched,omitempty"` // geen check: niet beoordeeld en geen inspectie
+	Subject   string      `json:"subject,omitempty"`   // wat de classificatie op de foto zag
+	Usage     *photoUsage `json:"usage,omitempty"`     // tokens en kosten van deze foto (de headers zijn de som)
+	GoldResponse
+}
+
+// photoUsage is het verbruik van één foto uit de stapel
+type photoUsage struct {
+	tokenUsage
+	CostUSD float64 `json:"costUsd"`
+}
+
+// classifyHandler laat per foto bepalen voor welke check hij bewijs is en voert die check uit.
+// Foto's zonder check komen terug als unmatched; hun classificatie is een inspectie van
+// relevanceCheckID, zodat ook die kosten meetellen. Alle foto's worden eerst gecontroleerd
+// (risico, afspraakvenster) en alle quota gereserveerd. De foto's lopen tegelijk
+// (upload.classifyConcurrency) binnen één deadline voor de hele stapel (de gold
+// analysisTimeout, die onder server.writeTimeout blijft). De inspecties worden opgeslagen
+// als de hele stapel klaar is; breekt een foto de stapel af, dan worden alleen de model
+// calls die al klaar waren opgeslagen en afgerekend.
+func (a *app) classifyHandler(w http.ResponseWriter, r *http.Request, projectNumber string) {
+	photos, releasePhotos, ok := a.readPhotos(w, r, "gold", a.cfg.imageSettingsFor(relevanceCheckID), a.cfg.Upload.MaxPhotos, true)
+	if !ok {
+		return
+	}
+	defer releasePhotos()
+	addLogAttrs(r.Context(), slog.Int("photos", len(photos)))
+
+	// Zonder Content-Length pas nu op de foto's geclaimd (zie withIdempotency)
+	if !a.idempotency.claim(w, r, photosKey(photos)) {
+		return
+	}
+
+	// Bewerkt of een screenshot? Alleen weigeren als de tenant dat wil
+	if !a.checkPhotoRisk(w, r, photos) {
+		return
+	}
+	signals := make([]goldSignals, len(photos))
+	for i, photo := range photos {
+		if signals[i], ok = a.goldSignals(w, r, projectNumber, photo); !ok {
+			return
+		}
+	}
+
+	// Quota's vóór de model calls: één inspectie per foto
+	for range photos {
+		release, ok := a.quotas.reserve(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	items := a.judgeBatch(r, photos)
+	defer func() {
+		for _, item := range items {
+			if item.release != nil {
+				item.release()
+			}
+		}
+	}()
+
+	// Pas nu opslaan en afrekenen; de X-Usage-* headers zijn de som, per foto staat het in usage
+	response := ClassifyResponse{ProjectNumber: projectNumber, Photos: make([]ClassifiedPhoto, len(photos))}
+	var total photoUsage
+	for i, item := range items {
+		if item.classified == nil {
+			continue // niet aan toegekomen of de classificatie zelf faalde: geen model call betaald
+		}
+		var recorded inspection
+		response.Photos[i] = ClassifiedPhoto{Index: i, Filename: photos[i].Filename, Subject: item.classified.Subject}
+		switch {
+		case item.verdict != nil:
+			response.Photos[i].Check = &item.check.ID
+			response.Photos[i].GoldResponse, recorded = a.recordGold(w, r, projectNumber, item.check.ID, []uploadedPhoto{item.prepared}, signals[i], *item.verdict)
+		case item.unmatched:
+			response.Photos[i].Unmatched = true
+			response.Photos[i].GoldResponse, recorded = a.recordClassification(w, r, projectNumber, photos[i], signals[i], *item.classified, item.classified.noCheckReason(), codeWrongSubject)
+		default:
+			// Afgebroken na de classificatie: alleen die is betaald
+			_, recorded = a.recordClassification(w, r, projectNumber, photos[i], signals[i], *item.classified, batchAbortedReason, "")
+		}
+		response.Photos[i].Usage = &photoUsage{tokenUsage: recorded.Usage, CostUSD: recorded.CostUSD}
+		total.tokenUsage = total.tokenUsage.plus(recorded.Usage)
+		total.CostUSD += recorded.CostUSD
+	}
+	w.Header().Del("X-Inspection-ID") // één per foto, in de response
+	writeUsageHeaders(w, total.tokenUsage, total.CostUSD)
+
+	for _, item := range items {
+		if item.failure != nil {
+			item.failure.writeTo(w)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// batchAbortedReason staat in de inspectie van een foto die wel geclassificeerd maar niet
+// meer beoordeeld is omdat de stapel afbrak
+const batchAbortedReason = "Batch aborted before this photo was judged"
+
+// batchItem is wat er met één foto uit de stapel gedaan is, ook als de stapel afbrak
+type batchItem struct {
+	classified *classification // nil = niet geclassificeerd
+	unmatched  bool            // geclassificeerd, maar voor geen enkele check bewijs
+	check      checkDefinition
+	prepared   uploadedPhoto // de foto zoals de check hem wil
+	release    func()        // geheugen van prepared, na het opslaan vrijgeven
+	verdict    *verdict      // nil = niet beoordeeld
+	failure    *capturedResponse
+}
+
+// judgeBatch classificeert en beoordeelt de foto's tegelijk, hooguit
+// upload.classifyConcurrency tegelijk en samen binnen de gold analysisTimeout. De eerste
+// fout breekt de andere foto's af; alleen die fout staat in failure.
+func (a *app) judgeBatch(r *http.Request, photos []uploadedPhoto) []batchItem {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(a.cfg.Tiers.Gold.AnalysisTimeout))
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	items := make([]batchItem, len(photos))
+	slots := make(chan struct{}, a.cfg.Upload.ClassifyConcurrency)
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+	)
+	// In de volgorde van de foto's een plek pakken; na een fout start er geen nieuwe meer
+	for i := range photos {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			// Deadline voorbij terwijl de foto nog wachtte (anders faalde een andere foto al)
+			errOnce.Do(func() {
+				items[i].failure = &capturedResponse{header: make(http.Header)}
+				writeAnalysisError(items[i].failure, r, classifyUpstreamError(ctx.Err()))
+			})
+			break
+		}
+		wg.Add(1)
+		go func(item *batchItem, photo uploadedPhoto) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// Elke foto schrijft zijn fout in een eigen response; alleen de eerste gaat naar de client
+			captured := &capturedResponse{header: make(http.Header)}
+			if !a.judgeBatchPhoto(captured, r, photo, item) {
+				errOnce.Do(func() {
+					item.failure = captured
+					cancel()
+				})
+			}
+		}(&items[i], photos[i])
+	}
+	wg.Wait()
+	return items
+}
+
+// judgeBatchPhoto classificeert één foto en voert de gevonden check uit. Bij een fout is de
+// error response al naar w geschreven; wat klaar was staat in item.
+func (a *app) judgeBatchPhoto(w http.ResponseWriter, r *http.Request, photo uploadedPhoto, item *batchItem) bool {
+	classified, answer, err := a.classifyPhoto(r.Context(), photo)
+	if err != nil {
+		writeAnalysisError(w, r, err)
+		return false
+	}
+	item.classified = &classification{relevance: classified, Provider: answer.Provider, Model: answer.Model, Usage: answer.Usage}
+
+	check, found := findCheck(classified.Check)
+	if !classified.Installation || !found {
+		classifiedPhotosTotal.WithLabelValues("none").Inc()
+		item.unmatched = true
+		return true
+	}
+	classifiedPhotosTotal.WithLabelValues(check.ID).Inc()
+	item.check = check
+
+	// De foto zoals deze check hem wil (resolutie, detail, uitsneden), niet zoals de classificatie
+	checkPhoto, release, ok := a.reprepare(w, r, photo, a.cfg.imageSettingsFor(check.ID))
+	if !ok {
+		return false
+	}
+	item.prepared, item.release = checkPhoto, release
+
+	v, ok := a.judgeClassified(w, r, "gold", check, checkPhoto, item.classified)
+	if !ok {
+		return false
+	}
+	v = a.applyLevelReport(check.ID, v)
+	item.verdict = &v
+	return true
+}
+
+// recordClassification slaat een foto op waarvan alleen de classificatie gedaan is (unmatched,
+// of de stapel brak af) als inspectie van relevanceCheckID: die tokens zijn wel betaald
+func (a *app) recordClassification(w http.ResponseWriter, r *http.Request, projectNumber string, photo uploadedPhoto, signals goldSignals, classified classification, reason, reasonCode string) (GoldResponse, inspection) {
+	usage := classified.Usage
+	recorded := a.recordInspection(w, r, inspection{
+		ProjectNumber:    projectNumber,
+		Check:            relevanceCheckID,
+		Tier:             "gold",
+		Result:           "FAIL",
+		Reason:           reason,
+		Provider:         classified.Provider,
+		Model:            classified.Model,
+		Usage:            usage,
+		Flags:            signals.Flags,
+		LocationVerified: signals.LocationVerified,
+		DistanceMeters:   signals.DistanceMeters,
+		ReasonCode:       reasonCode,
+		Relevance:        &classified.relevance,
+		ClassifierModel:  classified.Model,
+		ClassifierUsage:  &usage,
+	}, []uploadedPhoto{photo})
+
+	return GoldResponse{
+		Result: "FAIL", ProjectNumber: projectNumber, Reason: reason, ReasonCode: reasonCode, Provider: classified.Provider,
+		InspectionID: recorded.ID, LocationVerified: signals.LocationVerified, Risk: photo.Risk,
+	}, recorded
+}
+
+// capturedResponse houdt de error response van één foto uit de stapel vast, zodat de foto's
+// tegelijk kunnen lopen zonder samen in dezelfde response te schrijven
+type capturedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *capturedResponse) Header() http.Header { return c.header }
+
+func (c *capturedResponse) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *capturedResponse) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(b)
+}
+
+// writeTo stuurt de vastgehouden response naar de client
+func (c *capturedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range c.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(c.status)
+	w.Write(c.body.Bytes())
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedProvider geeft de antwoorden in volgorde (een error als er geen meer zijn) en onthoudt de requests
+type scriptedProvider struct {
+	id      string
+	mu      sync.Mutex
+	answers []string
+	seen    []visionRequest
+}
+
+func (s *scriptedProvider) name() string { return s.id }
+
+func (s *scriptedProvider) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = append(s.seen, req)
+	if len(s.answers) == 0 {
+		return providerAnswer{}, &upstreamError{Code: codeUpstreamUnavailable, Status: http.StatusServiceUnavailable, Message: "no more answers", Err: errors.New("script done")}
+	}
+	content := s.answers[0]
+	s.answers = s.answers[1:]
+	return providerAnswer{Content: content, Model: s.id + "-model", Usage: tokenUsage{PromptTokens: 100, CompletionTokens: 2}}, nil
+}
+
+func newClassifyTestApp(t *testing.T, classifierAnswers, checkerAnswers []string) (*app, *scriptedProvider) {
+	t.Helper()
+	checker := &scriptedProvider{id: "checker", answers: checkerAnswers}
+	a := newTestApp(t, checker)
+	a.vision.chains[relevanceCheckID] = []visionProvider{&scriptedProvider{id: "classifier", answers: classifierAnswers}}
+	a.cfg.Pricing = map[string]modelPrice{"classifier-model": {InputPerMillion: 1}, "checker-model": {InputPerMillion: 10}}
+	// Eén tegelijk: de scripts geven hun antwoorden in de volgorde van de foto's
+	a.cfg.Upload.ClassifyConcurrency = 1
+	return a, checker
+}
+
+func TestClassifyRecordsEveryPhoto(t *testing.T) {
+	a, checker := newClassifyTestApp(t,
+		[]string{"INSTALLATION\npowerCordInSocket\nplug in a socket", "OTHER\nNONE\nselfie of a person"},
+		[]string{"PASS\nPlug is in the socket"},
+	)
+	// De check wil de foto anders dan de classificatie
+	a.cfg.Checks = map[string]checkConfig{"powerCordInSocket": {Detail: "high"}}
+
+	rec := httptest.NewRecorder()
+	a.classifyHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/classify", testJPEG(t, 64, 48), testJPEG(t, 48, 64)), "P1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var response ClassifyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	matched, unmatched := response.Photos[0], response.Photos[1]
+	if matched.Check == nil || *matched.Check != "powerCordInSocket" || matched.Result != "PASS" || matched.InspectionID == "" {
+		t.Errorf("photo 0 = %+v, want a recorded PASS for powerCordInSocket", matched)
+	}
+	if !unmatched.Unmatched || unmatched.Check != nil || unmatched.InspectionID == "" || unmatched.ReasonCode != codeWrongSubject {
+		t.Errorf("photo 1 = %+v, want unmatched with WRONG_SUBJECT and its classification recorded", unmatched)
+	}
+	if got := checker.seen[0].ImageDetail; got != "high" {
+		t.Errorf("check got the photo with detail %q, want the check's own detail high", got)
+	}
+
+	recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+	if len(recorded) != 2 {
+		t.Fatalf("recorded %d inspections, want one per photo", len(recorded))
+	}
+	checks := map[string]inspection{recorded[0].Check: recorded[0], recorded[1].Check: recorded[1]}
+	classification, ok := checks[relevanceCheckID]
+	if !ok || classification.ClassifierModel != "classifier-model" || classification.CostUSD == 0 {
+		t.Errorf("inspections %+v, want the unmatched photo as a priced %s inspection", recorded, relevanceCheckID)
+	}
+	// Headers zijn de som van de opgeslagen inspecties, per foto staat het in usage
+	if matched.Usage == nil || matched.Usage.PromptTokens != 200 {
+		t.Errorf("photo 0 usage = %+v, want 200 prompt tokens (classification + check)", matched.Usage)
+	}
+	if unmatched.Usage == nil || unmatched.Usage.PromptTokens != 100 || unmatched.Usage.CostUSD != classification.CostUSD {
+		t.Errorf("photo 1 usage = %+v, want the classification", unmatched.Usage)
+	}
+	if got := rec.Header().Get("X-Usage-Prompt-Tokens"); got != "300" {
+		t.Errorf("X-Usage-Prompt-Tokens = %s, want 300 for both photos", got)
+	}
+	spend := a.inspections.monthTotals(defaultTenant, time.Now())
+	if spend.CostUSD != recorded[0].CostUSD+recorded[1].CostUSD {
+		t.Errorf("monthly spend = %v, want both inspections", spend.CostUSD)
+	}
+	if got := rec.Header().Get("X-Inspection-ID"); got != "" {
+		t.Errorf("X-Inspection-ID = %s, want none for a batch", got)
+	}
+}
+
+func TestClassifyRecordsCompletedCallsWhenBatchFails(t *testing.T) {
+	// Tweede foto: de check faalt (geen antwoorden meer)
+	a, _ := newClassifyTestApp(t,
+		[]string{"INSTALLATION\npowerCordInSocket\nplug in a socket", "INSTALLATION\npowerCordInSocket\nplug in a socket"},
+		[]string{"PASS\nPlug is in the socket"},
+	)
+
+	rec := httptest.NewRecorder()
+	a.classifyHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/classify", testJPEG(t, 64, 48), testJPEG(t, 48, 64)), "P1")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 (body %s)", rec.Code, rec.Body)
+	}
+
+	// De eerste foto is helemaal beoordeeld, van de tweede alleen de classificatie betaald
+	recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+	if len(recorded) != 2 {
+		t.Fatalf("recorded %d inspections, want the completed photo and the classification of the failed one", len(recorded))
+	}
+	var judged, aborted int
+	for _, in := range recorded {
+		switch {
+		case in.Check == "powerCordInSocket" && in.Result == "PASS":
+			judged++
+		case in.Check == relevanceCheckID && in.Reason == batchAbortedReason && in.Usage.PromptTokens == 100:
+			aborted++
+		}
+	}
+	if judged != 1 || aborted != 1 {
+		t.Errorf("inspections %+v, want one judged photo and one aborted classification", recorded)
+	}
+	if got := rec.Header().Get("X-Usage-Prompt-Tokens"); got != "300" {
+		t.Errorf("X-Usage-Prompt-Tokens = %s, want 300 for the completed calls", got)
+	}
+	if got := rec.Header().Get("X-Inspection-ID"); got != "" {
+		t.Errorf("X-Inspection-ID = %s after a failed batch", got)
+	}
+}
+
+// slowProvider geeft na delay steeds hetzelfde antwoord en houdt bij hoeveel calls tegelijk liepen
+type slowProvider struct {
+	id      string
+	content string
+	delay   time.Duration
+
+	mu       sync.Mutex
+	running  int
+	parallel int
+}
+
+func (s *slowProvider) name() string { return s.id }
+
+func (s *slowProvider) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	s.mu.Lock()
+	s.running++
+	s.parallel = max(s.parallel, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(s.delay):
+		return providerAnswer{Content: s.content, Model: s.id + "-model", Usage: tokenUsage{PromptTokens: 100}}, nil
+	case <-ctx.Done():
+		return providerAnswer{}, ctx.Err()
+	}
+}
+
+func TestClassifyRunsPhotosConcurrently(t *testing.T) {
+	classifier := &slowProvider{id: "classifier", content: "OTHER\nNONE\nselfie of a person", delay: 50 * time.Millisecond}
+	a := newTestApp(t)
+	a.vision.chains[relevanceCheckID] = []visionProvider{classifier}
+	a.cfg.Upload.ClassifyConcurrency = 2
+
+	photos := [][]byte{testJPEG(t, 64, 48), testJPEG(t, 48, 64), testJPEG(t, 32, 32)}
+	rec := httptest.NewRecorder()
+	a.classifyHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/classify", photos...), "P1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if classifier.parallel != 2 {
+		t.Errorf("%d classifications ran at once, want the limit of 2", classifier.parallel)
+	}
+}
+
+func TestClassifyBatchHasOneDeadline(t *testing.T) {
+	// Elke call past ruim in de timeout, classificatie + check samen niet
+	delay := 150 * time.Millisecond
+	a := newTestApp(t, &slowProvider{id: "checker", content: "PASS\nPlug is in the socket", delay: delay})
+	a.vision.chains[relevanceCheckID] = []visionProvider{&slowProvider{id: "classifier", content: "INSTALLATION\npowerCordInSocket\nplug in a socket", delay: delay}}
+	a.cfg.Tiers.Gold.AnalysisTimeout = duration(250 * time.Millisecond)
+
+	started := time.Now()
+	rec := httptest.NewRecorder()
+	a.classifyHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/classify", testJPEG(t, 64, 48)), "P1")
+	if rec.Code == http.StatusOK {
+		t.Fatalf("status = 200 after %v, want the batch deadline to stop it", time.Since(started))
+	}
+	if elapsed := time.Since(started); elapsed > 2*delay {
+		t.Errorf("batch took %v, want it stopped at the %v deadline", elapsed, time.Duration(a.cfg.Tiers.Gold.AnalysisTimeout))
+	}
+}
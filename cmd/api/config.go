@@ -0,0 +1,935 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is de volledige configuratie van de API. Waarden worden in lagen geladen:
+// defaults -> config file (JSON) -> environment variables -> flags (laatste wint).
+type config struct {
+	OpenAIAPIKey   string                 `json:"openaiApiKey"`
+	Server         serverConfig           `json:"server"`
+	Providers      []providerConfig       `json:"providers"`
+	ProviderChain  []string               `json:"providerChain"` // standaard keten, leeg = alle providers
+	Checks         map[string]checkConfig `json:"checks"`        // instellingen per check id
+	Retry          retryConfig            `json:"retry"`
+	CircuitBreaker breakerConfig          `json:"circuitBreaker"`
+	Upload         uploadConfig           `json:"upload"`
+	Tiers          tiersConfig            `json:"tiers"`
+	Logging        loggingConfig          `json:"logging"`
+	Tracing        tracingConfig          `json:"tracing"`
+	Tenants        []tenantConfig         `json:"tenants"` // leeg = geen API keys nodig, alles op tenant "default"
+	Pricing        map[string]modelPrice  `json:"pricing"` // model (of prefix) -> prijs per 1M tokens
+	Storage        storageConfig          `json:"storage"`
+	Quotas         quotasConfig           `json:"quotas"`
+	Cache          cacheConfig            `json:"cache"`
+	Idempotency    idempotencyConfig      `json:"idempotency"`
+	Image          imageConfig            `json:"image"`
+	Projects       projectsConfig         `json:"projects"`
+	Reuse          reuseConfig            `json:"reuse"`
+	Relevance      relevanceConfig        `json:"relevance"`
+	Level          levelConfig            `json:"level"`
+}
+
+// serverConfig bevat alle instellingen van de HTTP server
+type serverConfig struct {
+	BindAddress       string   `json:"bindAddress"`
+	Port              string   `json:"port"`
+	TLSCertFile       string   `json:"tlsCertFile"`
+	TLSKeyFile        string   `json:"tlsKeyFile"`
+	ReadHeaderTimeout duration `json:"readHeaderTimeout"`
+	ReadTimeout       duration `json:"readTimeout"`
+	WriteTimeout      duration `json:"writeTimeout"` // moet ruim boven de duur van een analyse (incl. retries) liggen
+	IdleTimeout       duration `json:"idleTimeout"`
+	ShutdownTimeout   duration `json:"shutdownTimeout"` // max wachttijd voor lopende analyses bij afsluiten
+	DrainDelay        duration `json:"drainDelay"`      // readyz staat al op 503, nieuwe requests komen nog binnen (load balancer)
+}
+
+// providerConfig beschrijft één OpenAI-compatibel model/endpoint
+type providerConfig struct {
+	Name    string `json:"name"`
+	Model   string `json:"model"`
+	BaseURL string `json:"baseUrl,omitempty"` // leeg = standaard OpenAI endpoint
+	APIKey  string `json:"apiKey,omitempty"`  // leeg = openaiApiKey
+}
+
+// checkConfig bevat de instellingen voor één check
+type checkConfig struct {
+	Model       string   `json:"model,omitempty"`       // eigen model, met de standaard keten als fallback
+	Providers   []string `json:"providers,omitempty"`   // eigen providerketen (gaat voor model)
+	MaxLongEdge int      `json:"maxLongEdge,omitempty"` // 0 = image.maxLongEdge
+	JPEGQuality int      `json:"jpegQuality,omitempty"` // 0 = image.jpegQuality
+	Detail      string   `json:"detail,omitempty"`      // leeg = image.detail
+	Tiles       int      `json:"tiles,omitempty"`       // 0 = image.tiles, 1 = uit, 2 = 2x2 uitsneden, ...
+	TileMerge   string   `json:"tileMerge,omitempty"`   // leeg = image.tileMerge
+	PhotoMode   string   `json:"photoMode,omitempty"`   // meer foto's: individual (apart), together (één call) of pair (zie photos.go)
+	PhotoMerge  string   `json:"photoMerge,omitempty"`  // meer foto's: any, all of majority; leeg = standaard van de check
+	PairMinGap  duration `json:"pairMinGap,omitempty"`  // pair: minimale tijd tussen de twee foto's; 0 = standaard van de check
+}
+
+// imageConfig bepaalt hoe foto's voorbewerkt worden voordat ze naar het model gaan
+type imageConfig struct {
+	Preprocess  bool    `json:"preprocess"`  // rechtop draaien, verkleinen en opnieuw als JPEG opslaan
+	MaxLongEdge int     `json:"maxLongEdge"` // langste zijde in pixels
+	JPEGQuality int     `json:"jpegQuality"` // 1-100
+	Detail      string  `json:"detail"`      // low, high of auto
+	Tiles       int     `json:"tiles"`       // 0 of 1 = alleen de hele foto, 2 = ook 2x2 overlappende uitsneden
+	TileOverlap float64 `json:"tileOverlap"` // deel van een uitsnede dat overlapt met de buren
+	TileMerge   string  `json:"tileMerge"`   // any, all of majority
+}
+
+type retryConfig struct {
+	MaxAttempts    int      `json:"maxAttempts"`
+	BaseDelay      duration `json:"baseDelay"`
+	MaxDelay       duration `json:"maxDelay"`
+	AttemptTimeout duration `json:"attemptTimeout"` // max duur van één call, daarna de volgende provider (0 = alleen de tier timeout)
+}
+
+type breakerConfig struct {
+	Threshold int      `json:"threshold"` // fouten op rij voordat de breaker opengaat
+	Cooldown  duration `json:"cooldown"`
+}
+
+type uploadConfig struct {
+	MaxPhotoBytes       int64    `json:"maxPhotoBytes"`
+	MaxPhotos           int      `json:"maxPhotos"`           // foto's per request (photo[], zie photos.go en classify.go)
+	MaxInFlightBytes    int64    `json:"maxInFlightBytes"`    // geheugen voor alle uploads samen
+	InFlightWait        duration `json:"inFlightWait"`        // max wachttijd op vrij geheugen, daarna 503
+	ClassifyConcurrency int      `json:"classifyConcurrency"` // foto's van een classify stapel die tegelijk naar het model gaan
+}
+
+type tiersConfig struct {
+	Silver tierConfig `json:"silver"`
+	Gold   tierConfig `json:"gold"`
+}
+
+// tierConfig bevat de instellingen van een tier (silver of gold)
+type tierConfig struct {
+	Enabled         bool     `json:"enabled"`
+	AnalysisTimeout duration `json:"analysisTimeout"` // max duur van de AI analyse inclusief retries en fallbacks
+}
+
+type loggingConfig struct {
+	Level  string `json:"level"`  // debug, info, warn, error
+	Format string `json:"format"` // json of text
+}
+
+// tracingConfig stelt de OTLP (HTTP) exporter in, bijv. endpoint "localhost:4318" voor een lokale collector
+type tracingConfig struct {
+	Enabled     bool    `json:"enabled"`
+	Endpoint    string  `json:"endpoint"` // host:port, leeg = OTEL_EXPORTER_OTLP_ENDPOINT of localhost:4318
+	Insecure    bool    `json:"insecure"` // zonder TLS (lokale collector)
+	SampleRatio float64 `json:"sampleRatio"`
+	ServiceName string  `json:"serviceName"`
+}
+
+// tenantConfig is een klant met de API keys waarmee hij de API aanroept
+type tenantConfig struct {
+	ID                 string   `json:"id"`
+	APIKeys            []string `json:"apiKeys"`
+	MonthlyInspections int      `json:"monthlyInspections,omitempty"` // 0 = onbeperkt
+	MonthlyBudgetUSD   float64  `json:"monthlyBudgetUsd,omitempty"`   // provider kosten, 0 = onbeperkt
+	RejectRiskScore    float64  `json:"rejectRiskScore,omitempty"`    // foto's vanaf deze risicoscore weigeren (zie fraud.go), 0 = nooit
+	RelevanceCheck     bool     `json:"relevanceCheck,omitempty"`     // classificatie vooraf (zie relevance.go), ook als relevance.enabled uit staat
+}
+
+// quotasConfig stelt de waarschuwingen en de admin override van de quota's in
+type quotasConfig struct {
+	SoftLimitRatio float64 `json:"softLimitRatio"` // waarschuwen vanaf dit deel van de limiet, bijv. 0.8
+	WebhookURL     string  `json:"webhookUrl"`     // POST bij soft en hard limit (één keer per maand)
+	AdminAPIKey    string  `json:"adminApiKey"`    // leeg = geen admin endpoints
+
+	EstimatedCostUSD float64 `json:"estimatedCostUsd"` // geschatte kosten van een lopende analyse zolang de tenant deze maand nog niets verbruikt heeft
+	OverridesFile    string  `json:"overridesFile"`    // JSON lines bestand voor de admin overrides, leeg = alleen in memory
+}
+
+type storageConfig struct {
+	InspectionsFile      string `json:"inspectionsFile"`      // JSON lines bestand, leeg = alleen in memory
+	MaxRecentInspections int    `json:"maxRecentInspections"` // per tenant in memory, voor het zoeken naar hergebruikte foto's
+}
+
+// cacheConfig stelt de resultaat cache in (zelfde foto + check = zelfde oordeel)
+type cacheConfig struct {
+	Enabled    bool     `json:"enabled"`
+	TTL        duration `json:"ttl"`
+	MaxEntries int      `json:"maxEntries"`
+	File       string   `json:"file"` // JSON lines bestand, leeg = alleen in memory
+}
+
+// projectsConfig stelt de projecten (afspraakvensters) en de controle van de opnametijd in
+type projectsConfig struct {
+	File                 string   `json:"file"`                 // JSON lines bestand, leeg = alleen in memory
+	CapturePolicy        string   `json:"capturePolicy"`        // flag of reject bij een foto buiten het venster
+	CaptureTolerance     duration `json:"captureTolerance"`     // marge rond het afspraakvenster
+	TimeZone             string   `json:"timeZone"`             // voor EXIF tijden zonder tijdzone
+	GeofenceRadiusMeters float64  `json:"geofenceRadiusMeters"` // straal rond het adres als het project er geen heeft
+}
+
+// reuseConfig stelt de herkenning van hergebruikte foto's in (zie phash.go)
+type reuseConfig struct {
+	Enabled     bool `json:"enabled"`
+	MaxDistance int  `json:"maxDistance"` // max Hamming afstand (van 64 bits) om als dezelfde foto te gelden
+}
+
+// relevanceConfig stelt de classificatie vóór de check in (zie relevance.go). De providerketen
+// is die van checks.relevance, of de standaard keten.
+type relevanceConfig struct {
+	Enabled bool `json:"enabled"` // voor alle tenants; per tenant met tenants[].relevanceCheck
+}
+
+// levelConfig stelt het aflezen van de waterpas in (applianceIsLevel, zie level.go)
+type levelConfig struct {
+	Tolerance float64 `json:"tolerance"` // max afstand van de bel tot het midden, in bellengtes
+}
+
+type idempotencyConfig struct {
+	TTL duration `json:"ttl"` // hoe lang een antwoord per Idempotency-Key bewaard blijft
+}
+
+// defaultConfig zijn de standaardwaarden als niets anders is ingesteld
+func defaultConfig() config {
+	return config{
+		Server: serverConfig{
+			Port:              "8080",
+			ReadHeaderTimeout: duration(10 * time.Second),
+			ReadTimeout:       duration(60 * time.Second),
+			WriteTimeout:      duration(120 * time.Second),
+			IdleTimeout:       duration(120 * time.Second),
+			ShutdownTimeout:   duration(90 * time.Second),
+			DrainDelay:        duration(5 * time.Second),
+		},
+		Checks: make(map[string]checkConfig),
+		Retry: retryConfig{
+			MaxAttempts:    3,
+			BaseDelay:      duration(500 * time.Millisecond),
+			MaxDelay:       duration(8 * time.Second),
+			AttemptTimeout: duration(30 * time.Second),
+		},
+		CircuitBreaker: breakerConfig{
+			Threshold: 5,
+			Cooldown:  duration(30 * time.Second),
+		},
+		Upload: uploadConfig{
+			MaxPhotoBytes:       10 << 20,  // 10 MB
+			MaxPhotos:           10,        // per request
+			MaxInFlightBytes:    512 << 20, // 512 MB
+			InFlightWait:        duration(10 * time.Second),
+			ClassifyConcurrency: 4,
+		},
+		Tiers: tiersConfig{
+			Silver: tierConfig{Enabled: true, AnalysisTimeout: duration(60 * time.Second)},
+			Gold:   tierConfig{Enabled: true, AnalysisTimeout: duration(90 * time.Second)},
+		},
+		Logging: loggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: tracingConfig{
+			SampleRatio: 1,
+			ServiceName: "api-q",
+		},
+		Pricing: copyPricing(defaultPricing),
+		Quotas: quotasConfig{
+			SoftLimitRatio:   0.8,
+			EstimatedCostUSD: 0.01,
+		},
+		Storage: storageConfig{
+			MaxRecentInspections: 10000, // een paar maanden voor een drukke tenant, ~10 MB
+		},
+		Cache: cacheConfig{
+			Enabled:    true,
+			TTL:        duration(24 * time.Hour),
+			MaxEntries: 10000,
+		},
+		Idempotency: idempotencyConfig{
+			TTL: duration(24 * time.Hour),
+		},
+		Image: imageConfig{
+			Preprocess:  true,
+			MaxLongEdge: 2048, // OpenAI schaalt zelf ook naar 2048, groter is verspilde bytes
+			JPEGQuality: 85,
+			Detail:      "auto",
+			TileOverlap: 0.2,
+			TileMerge:   "any", // kleine details: één uitsnede met bewijs is genoeg
+		},
+		Projects: projectsConfig{
+			CapturePolicy:        "flag",
+			CaptureTolerance:     duration(2 * time.Hour),
+			TimeZone:             "Europe/Amsterdam",
+			GeofenceRadiusMeters: 250, // GPS in een woning is vaak tientallen meters ernaast
+		},
+		Relevance: relevanceConfig{
+			Enabled: false, // extra model call per foto: per tenant aanzetten (relevanceCheck)
+		},
+		Reuse: reuseConfig{
+			Enabled:     true,
+			MaxDistance: 6, // opnieuw opgeslagen of verkleind blijft ruim hieronder, een andere opname zit er ver boven
+		},
+		Level: levelConfig{
+			Tolerance: 0.5, // bel raakt de streepjes nog net
+		},
+	}
+}
+
+func copyPricing(pricing map[string]modelPrice) map[string]modelPrice {
+	copied := make(map[string]modelPrice, len(pricing))
+	for model, price := range pricing {
+		copied[model] = price
+	}
+	return copied
+}
+
+// loadConfig laadt de configuratie uit alle lagen. printOnly is true bij --print-config.
+// envProblems zijn env vars die niet te lezen waren; die horen bij de problemen van validate,
+// zodat alle fouten samen gemeld worden. err is alleen voor flags en het config file.
+func loadConfig(args []string) (cfg config, printOnly bool, envProblems []string, err error) {
+	cfg = defaultConfig()
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "pad naar JSON config file (optioneel)")
+	printConfig := fs.Bool("print-config", false, "print de geladen config (zonder secrets) en stop")
+	port := fs.String("port", "", "HTTP port")
+	bind := fs.String("bind", "", "bind address (leeg = alle interfaces)")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file (optioneel)")
+	tlsKey := fs.String("tls-key", "", "TLS key file (optioneel)")
+	maxPhotoBytes := fs.Int64("max-photo-bytes", 0, "maximale grootte van een foto in bytes")
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, nil, err
+	}
+
+	// 1. Config file
+	if *configFile != "" {
+		if err := loadConfigFile(&cfg, *configFile); err != nil {
+			return cfg, false, nil, err
+		}
+	}
+
+	// 2. Environment variables
+	envProblems = applyEnv(&cfg)
+
+	// 3. Flags (alleen de flags die echt meegegeven zijn)
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "bind":
+			cfg.Server.BindAddress = *bind
+		case "tls-cert":
+			cfg.Server.TLSCertFile = *tlsCert
+		case "tls-key":
+			cfg.Server.TLSKeyFile = *tlsKey
+		case "max-photo-bytes":
+			cfg.Upload.MaxPhotoBytes = *maxPhotoBytes
+		}
+	})
+
+	// Zonder providers gebruiken we één standaard provider
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = []providerConfig{{Name: "primary", Model: "gpt-5-nano-2025-08-07"}}
+	}
+
+	return cfg, *printConfig, envProblems, nil
+}
+
+// loadConfigFile leest een JSON config file over de huidige waarden heen
+func loadConfigFile(cfg *config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv zet alle waarden uit environment variables in de config en geeft de onleesbare terug
+func applyEnv(cfg *config) []string {
+	var problems []string
+
+	setString := func(key string, target *string) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			*target = value
+		}
+	}
+	setInt := func(key string, target *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a number", key, value))
+				return
+			}
+			*target = n
+		}
+	}
+	setInt64 := func(key string, target *int64) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a number", key, value))
+				return
+			}
+			*target = n
+		}
+	}
+	setBool := func(key string, target *bool) {
+		if value := os.Getenv(key); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a boolean", key, value))
+				return
+			}
+			*target = b
+		}
+	}
+	setFloat := func(key string, target *float64) {
+		if value := os.Getenv(key); value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a number", key, value))
+				return
+			}
+			*target = f
+		}
+	}
+	setDuration := func(key string, target *duration) {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a duration (e.g. 30s)", key, value))
+				return
+			}
+			*target = duration(d)
+		}
+	}
+
+	setString("OPENAI_API_KEY", &cfg.OpenAIAPIKey)
+
+	setString("BIND_ADDRESS", &cfg.Server.BindAddress)
+	setString("PORT", &cfg.Server.Port)
+	setString("TLS_CERT_FILE", &cfg.Server.TLSCertFile)
+	setString("TLS_KEY_FILE", &cfg.Server.TLSKeyFile)
+	setDuration("READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	setDuration("READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	setDuration("WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	setDuration("IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	setDuration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	setDuration("SHUTDOWN_DRAIN_DELAY", &cfg.Server.DrainDelay)
+
+	setInt("RETRY_MAX_ATTEMPTS", &cfg.Retry.MaxAttempts)
+	setDuration("RETRY_BASE_DELAY", &cfg.Retry.BaseDelay)
+	setDuration("RETRY_MAX_DELAY", &cfg.Retry.MaxDelay)
+	setDuration("RETRY_ATTEMPT_TIMEOUT", &cfg.Retry.AttemptTimeout)
+	setInt("BREAKER_THRESHOLD", &cfg.CircuitBreaker.Threshold)
+	setDuration("BREAKER_COOLDOWN", &cfg.CircuitBreaker.Cooldown)
+
+	setInt64("MAX_PHOTO_BYTES", &cfg.Upload.MaxPhotoBytes)
+	setInt("MAX_PHOTOS", &cfg.Upload.MaxPhotos)
+	setInt64("MAX_IN_FLIGHT_BYTES", &cfg.Upload.MaxInFlightBytes)
+	setDuration("UPLOAD_IN_FLIGHT_WAIT", &cfg.Upload.InFlightWait)
+	setInt("CLASSIFY_CONCURRENCY", &cfg.Upload.ClassifyConcurrency)
+
+	setBool("SILVER_ENABLED", &cfg.Tiers.Silver.Enabled)
+	setDuration("SILVER_ANALYSIS_TIMEOUT", &cfg.Tiers.Silver.AnalysisTimeout)
+	setBool("GOLD_ENABLED", &cfg.Tiers.Gold.Enabled)
+	setDuration("GOLD_ANALYSIS_TIMEOUT", &cfg.Tiers.Gold.AnalysisTimeout)
+
+	setString("LOG_LEVEL", &cfg.Logging.Level)
+	setString("LOG_FORMAT", &cfg.Logging.Format)
+
+	setBool("TRACING_ENABLED", &cfg.Tracing.Enabled)
+	setString("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	setBool("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	setFloat("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	setString("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+
+	setString("INSPECTIONS_FILE", &cfg.Storage.InspectionsFile)
+	setInt("MAX_RECENT_INSPECTIONS", &cfg.Storage.MaxRecentInspections)
+
+	setBool("CACHE_ENABLED", &cfg.Cache.Enabled)
+	setDuration("CACHE_TTL", &cfg.Cache.TTL)
+	setInt("CACHE_MAX_ENTRIES", &cfg.Cache.MaxEntries)
+	setString("CACHE_FILE", &cfg.Cache.File)
+	setDuration("IDEMPOTENCY_TTL", &cfg.Idempotency.TTL)
+
+	setBool("IMAGE_PREPROCESS", &cfg.Image.Preprocess)
+	setInt("IMAGE_MAX_LONG_EDGE", &cfg.Image.MaxLongEdge)
+	setInt("IMAGE_JPEG_QUALITY", &cfg.Image.JPEGQuality)
+	setString("IMAGE_DETAIL", &cfg.Image.Detail)
+	setInt("IMAGE_TILES", &cfg.Image.Tiles)
+	setFloat("IMAGE_TILE_OVERLAP", &cfg.Image.TileOverlap)
+	setString("IMAGE_TILE_MERGE", &cfg.Image.TileMerge)
+	setString("PROJECTS_FILE", &cfg.Projects.File)
+	setString("CAPTURE_POLICY", &cfg.Projects.CapturePolicy)
+	setDuration("CAPTURE_TOLERANCE", &cfg.Projects.CaptureTolerance)
+	setString("EXIF_TIME_ZONE", &cfg.Projects.TimeZone)
+	setFloat("GEOFENCE_RADIUS_METERS", &cfg.Projects.GeofenceRadiusMeters)
+	setBool("RELEVANCE_CHECK_ENABLED", &cfg.Relevance.Enabled)
+	setBool("REUSE_DETECTION_ENABLED", &cfg.Reuse.Enabled)
+	setInt("REUSE_MAX_DISTANCE", &cfg.Reuse.MaxDistance)
+	setFloat("LEVEL_TOLERANCE", &cfg.Level.Tolerance)
+
+	// TENANT_API_KEYS=acme=key1,acme=key2,bouwbv=key3
+	if raw := strings.TrimSpace(os.Getenv("TENANT_API_KEYS")); raw != "" {
+		cfg.Tenants = nil
+		index := make(map[string]int)
+		for _, entry := range splitList(raw) {
+			id, key, ok := strings.Cut(entry, "=")
+			if !ok || id == "" || key == "" {
+				problems = append(problems, fmt.Sprintf("TENANT_API_KEYS: invalid entry, expected tenant=apiKey (entry %d)", len(cfg.Tenants)+1))
+				continue
+			}
+			i, seen := index[id]
+			if !seen {
+				i = len(cfg.Tenants)
+				index[id] = i
+				cfg.Tenants = append(cfg.Tenants, tenantConfig{ID: id})
+			}
+			cfg.Tenants[i].APIKeys = append(cfg.Tenants[i].APIKeys, key)
+		}
+	}
+
+	// TENANT_QUOTAS=acme=1000/250 (inspecties/USD per maand, 0 = onbeperkt)
+	for _, entry := range splitList(os.Getenv("TENANT_QUOTAS")) {
+		id, spec, _ := strings.Cut(entry, "=")
+		inspections, budget, _ := strings.Cut(spec, "/")
+		maxInspections, errInspections := strconv.Atoi(inspections)
+		maxBudget, errBudget := strconv.ParseFloat(budget, 64)
+		if errInspections != nil || errBudget != nil {
+			problems = append(problems, fmt.Sprintf("TENANT_QUOTAS: invalid entry %q, expected tenant=inspections/budgetUSD", entry))
+			continue
+		}
+		found := false
+		for i := range cfg.Tenants {
+			if cfg.Tenants[i].ID == id {
+				cfg.Tenants[i].MonthlyInspections, cfg.Tenants[i].MonthlyBudgetUSD = maxInspections, maxBudget
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("TENANT_QUOTAS: unknown tenant %q", id))
+		}
+	}
+	// TENANT_REJECT_RISK=acme=0.7 (foto's vanaf deze risicoscore weigeren)
+	for _, entry := range splitList(os.Getenv("TENANT_REJECT_RISK")) {
+		id, spec, _ := strings.Cut(entry, "=")
+		score, err := strconv.ParseFloat(spec, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TENANT_REJECT_RISK: invalid entry %q, expected tenant=score", entry))
+			continue
+		}
+		found := false
+		for i := range cfg.Tenants {
+			if cfg.Tenants[i].ID == id {
+				cfg.Tenants[i].RejectRiskScore = score
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("TENANT_REJECT_RISK: unknown tenant %q", id))
+		}
+	}
+	// TENANT_RELEVANCE_CHECK=acme,bouwbv (classificatie vooraf voor deze tenants)
+	for _, id := range splitList(os.Getenv("TENANT_RELEVANCE_CHECK")) {
+		found := false
+		for i := range cfg.Tenants {
+			if cfg.Tenants[i].ID == id {
+				cfg.Tenants[i].RelevanceCheck = true
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("TENANT_RELEVANCE_CHECK: unknown tenant %q", id))
+		}
+	}
+	setFloat("QUOTA_SOFT_LIMIT_RATIO", &cfg.Quotas.SoftLimitRatio)
+	setString("QUOTA_WEBHOOK_URL", &cfg.Quotas.WebhookURL)
+	setString("ADMIN_API_KEY", &cfg.Quotas.AdminAPIKey)
+	setFloat("QUOTA_ESTIMATED_COST_USD", &cfg.Quotas.EstimatedCostUSD)
+	setString("QUOTA_OVERRIDES_FILE", &cfg.Quotas.OverridesFile)
+
+	// MODEL_PRICES=gpt-5-nano=0.05/0.40,gpt-4o-mini=0.15/0.60 (USD per 1M input/output tokens)
+	for _, entry := range splitList(os.Getenv("MODEL_PRICES")) {
+		model, spec, _ := strings.Cut(entry, "=")
+		input, output, _ := strings.Cut(spec, "/")
+		in, errIn := strconv.ParseFloat(input, 64)
+		out, errOut := strconv.ParseFloat(output, 64)
+		if model == "" || errIn != nil || errOut != nil {
+			problems = append(problems, fmt.Sprintf("MODEL_PRICES: invalid entry %q, expected model=input/output", entry))
+			continue
+		}
+		cfg.Pricing[model] = modelPrice{InputPerMillion: in, OutputPerMillion: out}
+	}
+
+	// PROVIDERS=nano=gpt-5-nano-2025-08-07,backup=gpt-4o-mini@https://llm.example.com/v1
+	if raw := strings.TrimSpace(os.Getenv("PROVIDERS")); raw != "" {
+		cfg.Providers = nil
+		for _, entry := range strings.Split(raw, ",") {
+			name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || name == "" || spec == "" {
+				problems = append(problems, fmt.Sprintf("PROVIDERS: invalid entry %q, expected name=model[@baseURL]", entry))
+				continue
+			}
+			model, baseURL, _ := strings.Cut(spec, "@")
+			cfg.Providers = append(cfg.Providers, providerConfig{Name: name, Model: model, BaseURL: baseURL})
+		}
+	}
+	// PROVIDER_<NAAM>_API_KEY voor providers met een eigen endpoint
+	for i := range cfg.Providers {
+		setString("PROVIDER_"+strings.ToUpper(cfg.Providers[i].Name)+"_API_KEY", &cfg.Providers[i].APIKey)
+	}
+	if raw := os.Getenv("PROVIDER_CHAIN"); raw != "" {
+		cfg.ProviderChain = splitList(raw)
+	}
+
+	// Per check: CHECK_MODEL_<checkId>, PROVIDER_CHAIN_<checkId>, IMAGE_DETAIL_<checkId>, ...
+	// (ook CHECK_MODEL_relevance en PROVIDER_CHAIN_relevance voor de classificatie)
+	for _, id := range append(checkIDs(), relevanceCheckID) {
+		check := cfg.Checks[id]
+		setString("CHECK_MODEL_"+id, &check.Model)
+		if raw := os.Getenv("PROVIDER_CHAIN_" + id); raw != "" {
+			check.Providers = splitList(raw)
+		}
+		setInt("IMAGE_MAX_LONG_EDGE_"+id, &check.MaxLongEdge)
+		setInt("IMAGE_JPEG_QUALITY_"+id, &check.JPEGQuality)
+		setString("IMAGE_DETAIL_"+id, &check.Detail)
+		setInt("IMAGE_TILES_"+id, &check.Tiles)
+		setString("IMAGE_TILE_MERGE_"+id, &check.TileMerge)
+		setString("PHOTO_MODE_"+id, &check.PhotoMode)
+		setString("PHOTO_MERGE_"+id, &check.PhotoMerge)
+		setDuration("PHOTO_PAIR_MIN_GAP_"+id, &check.PairMinGap)
+		if check.Model != "" || len(check.Providers) > 0 || check.MaxLongEdge > 0 || check.JPEGQuality > 0 || check.Detail != "" || check.Tiles > 0 || check.TileMerge != "" ||
+			check.PhotoMode != "" || check.PhotoMerge != "" || check.PairMinGap > 0 {
+			cfg.Checks[id] = check
+		}
+	}
+
+	return problems
+}
+
+// splitList maakt van "a, b,c" een lijst [a b c]
+func splitList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// validate controleert de config en geeft ALLE problemen tegelijk terug
+func (c config) validate() []string {
+	var problems []string
+
+	providerNames := make(map[string]bool)
+	for i, p := range c.Providers {
+		switch {
+		case p.Name == "":
+			problems = append(problems, fmt.Sprintf("providers[%d]: name is required", i))
+		case providerNames[p.Name]:
+			problems = append(problems, fmt.Sprintf("providers[%d]: duplicate provider name %q", i, p.Name))
+		}
+		providerNames[p.Name] = true
+		if p.Model == "" {
+			problems = append(problems, fmt.Sprintf("providers[%d] (%s): model is required", i, p.Name))
+		}
+		if p.APIKey == "" && c.OpenAIAPIKey == "" {
+			problems = append(problems, fmt.Sprintf("providers[%d] (%s): no API key (set OPENAI_API_KEY or PROVIDER_%s_API_KEY)", i, p.Name, strings.ToUpper(p.Name)))
+		}
+	}
+
+	for _, name := range c.ProviderChain {
+		if !providerNames[name] {
+			problems = append(problems, fmt.Sprintf("providerChain: unknown provider %q", name))
+		}
+	}
+
+	for id, check := range c.Checks {
+		if _, ok := findCheck(id); !ok && id != relevanceCheckID {
+			problems = append(problems, fmt.Sprintf("checks: unknown check %q (valid: %s, %s)", id, strings.Join(checkIDs(), ", "), relevanceCheckID))
+		}
+		for _, name := range check.Providers {
+			if !providerNames[name] {
+				problems = append(problems, fmt.Sprintf("checks.%s.providers: unknown provider %q", id, name))
+			}
+		}
+		problems = append(problems, validateImageSettings("checks."+id, check.MaxLongEdge, check.JPEGQuality, check.Detail, true)...)
+		problems = append(problems, validateTileSettings("checks."+id, check.Tiles, check.TileMerge, true)...)
+		switch definition, _ := findCheck(id); check.PhotoMode {
+		case "", photoModeIndividual:
+		case photoModeTogether:
+			// Together heeft één antwoordregel per foto; de extra regels (waterpas, HOSE_*) zijn per foto
+			if definition.GoldExtra != nil {
+				problems = append(problems, fmt.Sprintf("checks.%s.photoMode: together is not supported by this check (it reads each photo on its own)", id))
+			}
+		case photoModePair:
+			if definition.PairPrompt == "" {
+				problems = append(problems, fmt.Sprintf("checks.%s.photoMode: pair is not supported by this check", id))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("checks.%s.photoMode: %q must be individual, together or pair", id, check.PhotoMode))
+		}
+		// Together en pair sturen de hele foto's in één call, zonder uitsneden of aangewezen gebied
+		tiles := check.Tiles
+		if tiles == 0 {
+			tiles = c.Image.Tiles
+		}
+		if tiles > 1 && (check.PhotoMode == photoModeTogether || check.PhotoMode == photoModePair) {
+			problems = append(problems, fmt.Sprintf("checks.%s.tiles: %s mode sends whole photos without tiles (set checks.%s.tiles to 1)", id, check.PhotoMode, id))
+		}
+		if check.PairMinGap < 0 {
+			problems = append(problems, fmt.Sprintf("checks.%s.pairMinGap: must not be negative", id))
+		}
+		if check.PhotoMerge != "" && check.PhotoMerge != "any" && check.PhotoMerge != "all" && check.PhotoMerge != "majority" {
+			problems = append(problems, fmt.Sprintf("checks.%s.photoMerge: %q must be any, all or majority", id, check.PhotoMerge))
+		}
+	}
+	problems = append(problems, validateImageSettings("image", c.Image.MaxLongEdge, c.Image.JPEGQuality, c.Image.Detail, false)...)
+	problems = append(problems, validateTileSettings("image", c.Image.Tiles, c.Image.TileMerge, false)...)
+	if c.Image.TileOverlap < 0 || c.Image.TileOverlap > 0.5 {
+		problems = append(problems, "image.tileOverlap: must be between 0 and 0.5")
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port: %q is not a valid port", c.Server.Port))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		problems = append(problems, "server: both tlsCertFile and tlsKeyFile must be set to enable TLS")
+	}
+	for name, d := range map[string]duration{
+		"server.readHeaderTimeout":     c.Server.ReadHeaderTimeout,
+		"server.readTimeout":           c.Server.ReadTimeout,
+		"server.writeTimeout":          c.Server.WriteTimeout,
+		"server.idleTimeout":           c.Server.IdleTimeout,
+		"server.shutdownTimeout":       c.Server.ShutdownTimeout,
+		"retry.baseDelay":              c.Retry.BaseDelay,
+		"retry.maxDelay":               c.Retry.MaxDelay,
+		"circuitBreaker.cooldown":      c.CircuitBreaker.Cooldown,
+		"tiers.silver.analysisTimeout": c.Tiers.Silver.AnalysisTimeout,
+		"tiers.gold.analysisTimeout":   c.Tiers.Gold.AnalysisTimeout,
+		"idempotency.ttl":              c.Idempotency.TTL,
+		"upload.inFlightWait":          c.Upload.InFlightWait,
+	} {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: must be greater than 0", name))
+		}
+	}
+	if c.Tiers.Gold.AnalysisTimeout > c.Server.WriteTimeout || c.Tiers.Silver.AnalysisTimeout > c.Server.WriteTimeout {
+		problems = append(problems, "tiers: analysisTimeout must not exceed server.writeTimeout")
+	}
+
+	if c.Storage.MaxRecentInspections < 1 {
+		problems = append(problems, "storage.maxRecentInspections: must be at least 1")
+	}
+	if c.Server.DrainDelay < 0 {
+		problems = append(problems, "server.drainDelay: must not be negative")
+	}
+	if c.Retry.MaxAttempts < 1 {
+		problems = append(problems, "retry.maxAttempts: must be at least 1")
+	}
+	if c.Retry.AttemptTimeout < 0 {
+		problems = append(problems, "retry.attemptTimeout: must not be negative")
+	}
+	if c.CircuitBreaker.Threshold < 1 {
+		problems = append(problems, "circuitBreaker.threshold: must be at least 1")
+	}
+	if c.Upload.MaxPhotoBytes <= 0 {
+		problems = append(problems, "upload.maxPhotoBytes: must be greater than 0")
+	}
+	if c.Upload.MaxPhotos < 1 {
+		problems = append(problems, "upload.maxPhotos: must be at least 1")
+	}
+	if c.Upload.ClassifyConcurrency < 1 {
+		problems = append(problems, "upload.classifyConcurrency: must be at least 1")
+	}
+	if c.Upload.MaxInFlightBytes < c.Upload.MaxPhotoBytes*3 {
+		problems = append(problems, "upload.maxInFlightBytes: must be at least 3x upload.maxPhotoBytes")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		problems = append(problems, fmt.Sprintf("logging.level: %q is not one of debug, info, warn, error", c.Logging.Level))
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		problems = append(problems, fmt.Sprintf("logging.format: %q must be json or text", c.Logging.Format))
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sampleRatio: must be between 0 and 1")
+	}
+	if c.Tracing.Enabled && c.Tracing.ServiceName == "" {
+		problems = append(problems, "tracing.serviceName: required when tracing is enabled")
+	}
+
+	tenantIDs := make(map[string]bool)
+	apiKeys := make(map[string]bool)
+	for i, t := range c.Tenants {
+		switch {
+		case t.ID == "":
+			problems = append(problems, fmt.Sprintf("tenants[%d]: id is required", i))
+		case tenantIDs[t.ID]:
+			problems = append(problems, fmt.Sprintf("tenants[%d]: duplicate tenant id %q", i, t.ID))
+		}
+		tenantIDs[t.ID] = true
+		if len(t.APIKeys) == 0 {
+			problems = append(problems, fmt.Sprintf("tenants[%d] (%s): at least one API key is required", i, t.ID))
+		}
+		if t.MonthlyInspections < 0 || t.MonthlyBudgetUSD < 0 {
+			problems = append(problems, fmt.Sprintf("tenants[%d] (%s): monthly quotas must not be negative", i, t.ID))
+		}
+		if t.RejectRiskScore < 0 || t.RejectRiskScore > 1 {
+			problems = append(problems, fmt.Sprintf("tenants[%d] (%s): rejectRiskScore must be between 0 and 1", i, t.ID))
+		}
+		for _, key := range t.APIKeys {
+			if c.Quotas.AdminAPIKey != "" && key == c.Quotas.AdminAPIKey {
+				problems = append(problems, fmt.Sprintf("tenants[%d] (%s): API key must differ from quotas.adminApiKey", i, t.ID))
+			}
+			if apiKeys[key] {
+				problems = append(problems, fmt.Sprintf("tenants[%d] (%s): duplicate API key", i, t.ID))
+			}
+			apiKeys[key] = true
+		}
+	}
+
+	if c.Cache.Enabled {
+		if c.Cache.TTL <= 0 {
+			problems = append(problems, "cache.ttl: must be greater than 0")
+		}
+		if c.Cache.MaxEntries < 1 {
+			problems = append(problems, "cache.maxEntries: must be at least 1")
+		}
+	}
+
+	if c.Quotas.SoftLimitRatio <= 0 || c.Quotas.SoftLimitRatio > 1 {
+		problems = append(problems, "quotas.softLimitRatio: must be between 0 and 1")
+	}
+	if c.Quotas.WebhookURL != "" && !strings.HasPrefix(c.Quotas.WebhookURL, "http://") && !strings.HasPrefix(c.Quotas.WebhookURL, "https://") {
+		problems = append(problems, "quotas.webhookUrl: must be an http(s) URL")
+	}
+	if c.Quotas.EstimatedCostUSD < 0 {
+		problems = append(problems, "quotas.estimatedCostUsd: must not be negative")
+	}
+
+	if c.Projects.CapturePolicy != "flag" && c.Projects.CapturePolicy != "reject" {
+		problems = append(problems, fmt.Sprintf("projects.capturePolicy: %q must be flag or reject", c.Projects.CapturePolicy))
+	}
+	if c.Projects.CaptureTolerance < 0 {
+		problems = append(problems, "projects.captureTolerance: must not be negative")
+	}
+	if _, err := time.LoadLocation(c.Projects.TimeZone); err != nil || c.Projects.TimeZone == "" {
+		problems = append(problems, fmt.Sprintf("projects.timeZone: %q is not a known time zone", c.Projects.TimeZone))
+	}
+	if c.Projects.GeofenceRadiusMeters <= 0 || c.Projects.GeofenceRadiusMeters > maxGeofenceRadiusMeters {
+		problems = append(problems, fmt.Sprintf("projects.geofenceRadiusMeters: must be greater than 0 and at most %d", maxGeofenceRadiusMeters))
+	}
+	if c.Reuse.MaxDistance < 0 || c.Reuse.MaxDistance > 16 {
+		problems = append(problems, "reuse.maxDistance: must be between 0 and 16")
+	}
+	if c.Level.Tolerance <= 0 || c.Level.Tolerance > 2 {
+		problems = append(problems, "level.tolerance: must be greater than 0 and at most 2")
+	}
+
+	for model, price := range c.Pricing {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			problems = append(problems, fmt.Sprintf("pricing.%s: prices must not be negative", model))
+		}
+	}
+
+	return problems
+}
+
+// validateImageSettings controleert de foto instellingen (globaal of per check, waar 0/leeg "niet gezet" is)
+func validateImageSettings(prefix string, maxLongEdge, quality int, detail string, optional bool) []string {
+	var problems []string
+	if (!optional || maxLongEdge != 0) && (maxLongEdge < 256 || maxLongEdge > 8192) {
+		problems = append(problems, fmt.Sprintf("%s.maxLongEdge: must be between 256 and 8192", prefix))
+	}
+	if (!optional || quality != 0) && (quality < 1 || quality > 100) {
+		problems = append(problems, fmt.Sprintf("%s.jpegQuality: must be between 1 and 100", prefix))
+	}
+	if (!optional || detail != "") && detail != "low" && detail != "high" && detail != "auto" {
+		problems = append(problems, fmt.Sprintf("%s.detail: %q must be low, high or auto", prefix, detail))
+	}
+	return problems
+}
+
+// validateTileSettings controleert het aantal uitsneden en de manier van combineren
+func validateTileSettings(prefix string, tiles int, merge string, optional bool) []string {
+	var problems []string
+	if tiles < 0 || tiles > 4 {
+		problems = append(problems, fmt.Sprintf("%s.tiles: must be between 0 and 4", prefix))
+	}
+	if (!optional || merge != "") && merge != "any" && merge != "all" && merge != "majority" {
+		problems = append(problems, fmt.Sprintf("%s.tileMerge: %q must be any, all or majority", prefix, merge))
+	}
+	return problems
+}
+
+// redacted geeft een kopie van de config zonder secrets (voor --print-config)
+func (c config) redacted() config {
+	c.OpenAIAPIKey = redactSecret(c.OpenAIAPIKey)
+
+	providers := make([]providerConfig, len(c.Providers))
+	for i, p := range c.Providers {
+		p.APIKey = redactSecret(p.APIKey)
+		providers[i] = p
+	}
+	c.Providers = providers
+
+	tenants := make([]tenantConfig, len(c.Tenants))
+	for i, t := range c.Tenants {
+		keys := make([]string, len(t.APIKeys))
+		for j, key := range t.APIKeys {
+			keys[j] = redactSecret(key)
+		}
+		t.APIKeys = keys
+		tenants[i] = t
+	}
+	c.Tenants = tenants
+	c.Quotas.AdminAPIKey = redactSecret(c.Quotas.AdminAPIKey)
+	return c
+}
+
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***redacted***"
+}
+
+// ========================================
+// DURATION (leesbaar in JSON, bijv. "30s")
+// ========================================
+
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
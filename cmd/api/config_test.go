@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// layerEnv zijn de env vars die TestLoadConfigLayers zet; leeg telt als niet gezet
+var layerEnv = []string{"CONFIG_FILE", "PORT", "BIND_ADDRESS", "MAX_PHOTO_BYTES", "LOG_LEVEL", "LOG_FORMAT", "RETRY_MAX_ATTEMPTS", "RETRY_BASE_DELAY"}
+
+// writeConfigFile schrijft een JSON config file en geeft het pad
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	file := writeConfigFile(t, `{"server":{"port":"7001","bindAddress":"10.0.0.1"},"upload":{"maxPhotoBytes":2000000},"logging":{"level":"warn"},"retry":{"maxAttempts":5}}`)
+	other := writeConfigFile(t, `{"server":{"port":"7101"}}`)
+
+	type values struct {
+		port, bind, level, format string
+		maxPhotoBytes             int64
+		maxAttempts               int
+	}
+	defaults := values{"8080", "", "info", "json", 10 << 20, 3}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want values
+	}{
+		{"defaults", nil, nil, defaults},
+		{"file over defaults", nil, []string{"-config", file},
+			values{"7001", "10.0.0.1", "warn", "json", 2000000, 5}},
+		{"file from CONFIG_FILE", map[string]string{"CONFIG_FILE": file}, nil,
+			values{"7001", "10.0.0.1", "warn", "json", 2000000, 5}},
+		{"-config over CONFIG_FILE", map[string]string{"CONFIG_FILE": file}, []string{"-config", other},
+			values{"7101", "", "info", "json", 10 << 20, 3}},
+		{"env over file", map[string]string{"PORT": "7002", "MAX_PHOTO_BYTES": "3000000", "LOG_FORMAT": "text"}, []string{"-config", file},
+			values{"7002", "10.0.0.1", "warn", "text", 3000000, 5}},
+		{"flags over env", map[string]string{"PORT": "7002", "BIND_ADDRESS": "10.0.0.2", "MAX_PHOTO_BYTES": "3000000"}, []string{"-config", file, "-port", "7003", "-max-photo-bytes", "4000000"},
+			values{"7003", "10.0.0.2", "warn", "json", 4000000, 5}},
+		// Een flag die niet meegegeven is, overschrijft niets (ook niet met zijn lege standaardwaarde)
+		{"flags over file without env", nil, []string{"-config", file, "-bind", "127.0.0.1"},
+			values{"7001", "127.0.0.1", "warn", "json", 2000000, 5}},
+		{"empty env is not set", map[string]string{"PORT": "", "LOG_LEVEL": ""}, []string{"-config", file},
+			values{"7001", "10.0.0.1", "warn", "json", 2000000, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range layerEnv {
+				t.Setenv(key, tt.env[key])
+			}
+			cfg, printOnly, envProblems, err := loadConfig(tt.args)
+			if err != nil || len(envProblems) > 0 || printOnly {
+				t.Fatalf("loadConfig: err %v, env problems %v, print only %v", err, envProblems, printOnly)
+			}
+			got := values{cfg.Server.Port, cfg.Server.BindAddress, cfg.Logging.Level, cfg.Logging.Format, cfg.Upload.MaxPhotoBytes, cfg.Retry.MaxAttempts}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, key := range layerEnv {
+		t.Setenv(key, "")
+	}
+
+	// Onleesbare env vars: allemaal tegelijk, naast de problemen van validate
+	t.Setenv("MAX_PHOTO_BYTES", "10MB")
+	t.Setenv("RETRY_BASE_DELAY", "500")
+	t.Setenv("RETRY_MAX_ATTEMPTS", "three")
+	cfg, _, envProblems, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`MAX_PHOTO_BYTES: "10MB" is not a number`,
+		`RETRY_BASE_DELAY: "500" is not a duration (e.g. 30s)`,
+		`RETRY_MAX_ATTEMPTS: "three" is not a number`,
+	}
+	slices.Sort(envProblems)
+	if !slices.Equal(envProblems, want) {
+		t.Errorf("env problems %q, want %q", envProblems, want)
+	}
+	// De laag eronder blijft staan
+	if cfg.Upload.MaxPhotoBytes != 10<<20 || cfg.Retry.MaxAttempts != 3 {
+		t.Errorf("unreadable env changed the config: %d, %d", cfg.Upload.MaxPhotoBytes, cfg.Retry.MaxAttempts)
+	}
+
+	for _, key := range layerEnv {
+		t.Setenv(key, "")
+	}
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown field", []string{"-config", writeConfigFile(t, `{"server":{"prot":"7001"}}`)}, `unknown field "prot"`},
+		{"bad duration", []string{"-config", writeConfigFile(t, `{"retry":{"baseDelay":500}}`)}, `duration must be a string like "30s"`},
+		{"broken JSON", []string{"-config", writeConfigFile(t, `{"server":`)}, "parse config file"},
+		{"missing file", []string{"-config", filepath.Join(t.TempDir(), "none.json")}, "open config file"},
+		{"unknown flag", []string{"-prot", "7001"}, "flag provided but not defined: -prot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := loadConfig(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// validConfig is de standaard config zoals loadConfig hem zonder instellingen geeft, met een API key
+func validConfig() config {
+	cfg := defaultConfig()
+	cfg.OpenAIAPIKey = "sk-test"
+	cfg.Providers = []providerConfig{{Name: "primary", Model: "gpt-5-nano-2025-08-07"}}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if problems := validConfig().validate(); len(problems) > 0 {
+		t.Fatalf("default config has problems: %q", problems)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*config)
+		want   []string
+	}{
+		{"no API key", func(c *config) { c.OpenAIAPIKey = "" },
+			[]string{"providers[0] (primary): no API key (set OPENAI_API_KEY or PROVIDER_PRIMARY_API_KEY)"}},
+		{"duplicate provider", func(c *config) { c.Providers = append(c.Providers, providerConfig{Name: "primary"}) },
+			[]string{`providers[1]: duplicate provider name "primary"`, "providers[1] (primary): model is required"}},
+		{"unknown provider in chain", func(c *config) { c.ProviderChain = []string{"backup"} },
+			[]string{`providerChain: unknown provider "backup"`}},
+		{"unknown check", func(c *config) { c.Checks["dishwasherIsOn"] = checkConfig{} },
+			[]string{`checks: unknown check "dishwasherIsOn" (valid: ` + strings.Join(checkIDs(), ", ") + ", " + relevanceCheckID + ")"}},
+		{"bad port", func(c *config) { c.Server.Port = "80a" }, []string{`server.port: "80a" is not a valid port`}},
+		{"port out of range", func(c *config) { c.Server.Port = "70000" }, []string{`server.port: "70000" is not a valid port`}},
+		{"half TLS", func(c *config) { c.Server.TLSCertFile = "cert.pem" }, []string{"server: both tlsCertFile and tlsKeyFile must be set to enable TLS"}},
+		{"zero timeout", func(c *config) { c.Idempotency.TTL = 0 }, []string{"idempotency.ttl: must be greater than 0"}},
+		{"analysis longer than write", func(c *config) { c.Tiers.Gold.AnalysisTimeout = duration(5 * time.Minute) },
+			[]string{"tiers: analysisTimeout must not exceed server.writeTimeout"}},
+		{"in flight below 3 photos", func(c *config) { c.Upload.MaxInFlightBytes = c.Upload.MaxPhotoBytes * 2 },
+			[]string{"upload.maxInFlightBytes: must be at least 3x upload.maxPhotoBytes"}},
+		{"log level", func(c *config) { c.Logging.Level = "verbose" }, []string{`logging.level: "verbose" is not one of debug, info, warn, error`}},
+		{"tenant key equals admin key", func(c *config) {
+			c.Quotas.AdminAPIKey = "admin"
+			c.Tenants = []tenantConfig{{ID: "acme", APIKeys: []string{"admin"}}}
+		}, []string{"tenants[0] (acme): API key must differ from quotas.adminApiKey"}},
+		{"duplicate tenant key", func(c *config) {
+			c.Tenants = []tenantConfig{{ID: "acme", APIKeys: []string{"k1"}}, {ID: "bouwbv", APIKeys: []string{"k1"}}}
+		}, []string{"tenants[1] (bouwbv): duplicate API key"}},
+		{"time zone", func(c *config) { c.Projects.TimeZone = "Mars/Olympus" }, []string{`projects.timeZone: "Mars/Olympus" is not a known time zone`}},
+		// Alle problemen tegelijk, niet alleen het eerste
+		{"several at once", func(c *config) {
+			c.Retry.MaxAttempts = 0
+			c.Image.JPEGQuality = 101
+			c.Reuse.MaxDistance = 17
+		}, []string{"retry.maxAttempts: must be at least 1", "image.jpegQuality: must be between 1 and 100", "reuse.maxDistance: must be between 0 and 16"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+			problems := cfg.validate()
+			for _, want := range tt.want {
+				if !slices.Contains(problems, want) {
+					t.Errorf("problems %q, want %q", problems, want)
+				}
+			}
+			if len(problems) != len(tt.want) {
+				t.Errorf("%d problems %q, want %d", len(problems), problems, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	secrets := []string{"sk-openai-secret", "sk-backup-secret", "tenant-key-1", "tenant-key-2", "admin-secret"}
+	cfg := validConfig()
+	cfg.OpenAIAPIKey = secrets[0]
+	cfg.Providers = append(cfg.Providers, providerConfig{Name: "backup", Model: "gpt-4o-mini", APIKey: secrets[1]}, providerConfig{Name: "local", Model: "llava"})
+	cfg.Tenants = []tenantConfig{{ID: "acme", APIKeys: []string{secrets[2], secrets[3]}}}
+	cfg.Quotas.AdminAPIKey = secrets[4]
+
+	out, err := json.Marshal(cfg.redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("redacted config contains %q", secret)
+		}
+	}
+	redacted := cfg.redacted()
+	if redacted.Providers[2].APIKey != "" || redacted.Providers[1].APIKey != "***redacted***" || len(redacted.Tenants[0].APIKeys) != 2 {
+		t.Errorf("providers %+v, tenants %+v: want set keys redacted and empty keys empty", redacted.Providers, redacted.Tenants)
+	}
+	if redacted.Providers[1].Model != "gpt-4o-mini" || redacted.Tenants[0].ID != "acme" {
+		t.Error("redacted also hid values that are not secret")
+	}
+	// Een kopie: de echte config houdt zijn keys
+	if cfg.OpenAIAPIKey != secrets[0] || cfg.Providers[1].APIKey != secrets[1] || cfg.Tenants[0].APIKeys[0] != secrets[2] || cfg.Quotas.AdminAPIKey != secrets[4] {
+		t.Error("redacted changed the original config")
+	}
+
+	// -print-config geeft printOnly
+	for _, key := range layerEnv {
+		t.Setenv(key, "")
+	}
+	if _, printOnly, _, err := loadConfig([]string{"-print-config"}); err != nil || !printOnly {
+		t.Errorf("-print-config: print only %v, err %v", printOnly, err)
+	}
+}
+
+func TestValidateRejectsTogetherForChecksWithExtraLines(t *testing.T) {
+	for _, id := range []string{levelCheckID, "drainHoseInDrain"} {
+		cfg := defaultConfig()
+		cfg.Checks = map[string]checkConfig{id: {PhotoMode: photoModeTogether}}
+		want := "checks." + id + ".photoMode: together is not supported"
+		found := false
+		for _, problem := range cfg.validate() {
+			found = found || strings.HasPrefix(problem, want)
+		}
+		if !found {
+			t.Errorf("%s: photoMode together was accepted", id)
+		}
+	}
+
+	cfg := defaultConfig()
+	cfg.Checks = map[string]checkConfig{"shippingBoltsRemoved": {PhotoMode: photoModeTogether}}
+	for _, problem := range cfg.validate() {
+		if strings.Contains(problem, "photoMode") {
+			t.Errorf("shippingBoltsRemoved: %s", problem)
+		}
+	}
+}
+
+func TestValidateRejectsTilesForOneCallModes(t *testing.T) {
+	for _, mode := range []string{photoModeTogether, photoModePair} {
+		cfg := defaultConfig()
+		cfg.Image.Tiles = 2
+		cfg.Checks = map[string]checkConfig{"rinseCycleMachineIsOn": {PhotoMode: mode}}
+		want := "checks.rinseCycleMachineIsOn.tiles: " + mode + " mode sends whole photos without tiles"
+		found := false
+		for _, problem := range cfg.validate() {
+			found = found || strings.HasPrefix(problem, want)
+		}
+		if !found {
+			t.Errorf("%s: tiles from image.tiles were accepted", mode)
+		}
+
+		cfg.Checks = map[string]checkConfig{"rinseCycleMachineIsOn": {PhotoMode: mode, Tiles: 1}}
+		for _, problem := range cfg.validate() {
+			if strings.Contains(problem, ".tiles") {
+				t.Errorf("%s with tiles 1: %s", mode, problem)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+)
+
+// ========================================
+// AFVOERSLANG: SCHADE EN AANSLUITING (drainHoseInDrain, gold)
+// ========================================
+
+// Deelbevindingen van drainHoseInDrain; elk met een eigen PASS, FAIL of UNKNOWN
+const (
+	codeHoseDamage    = "HOSE_DAMAGE"    // slang afgesneden, geknikt of kapot, of de afvoerbuis is kapot
+	codeHoseSupport   = "HOSE_SUPPORT"   // geen slanghouder of zwanenhals (anti-hevel)
+	codeHoseInsertion = "HOSE_INSERTION" // slang te ver in de standpijp geduwd
+)
+
+// drainSubFindingCodes in de volgorde van het antwoord
+var drainSubFindingCodes = []string{codeHoseDamage, codeHoseSupport, codeHoseInsertion}
+
+// subFinding is één los beoordeeld onderdeel van een check, naast het oordeel over de check zelf
+type subFinding struct {
+	Photo  string `json:"photo,omitempty"` // bij meer foto's, bijv. "photo 2"
+	Code   string `json:"code"`
+	Result string `json:"result"` // PASS, FAIL of UNKNOWN (niet te zien op de foto)
+	Reason string `json:"reason,omitempty"`
+}
+
+// readDrainFindings leest de HOSE_* regels van het gold antwoord (GoldExtra van drainHoseInDrain).
+// Een afgekeurd onderdeel maakt een PASS van de check FAIL.
+func readDrainFindings(content string, _ config, v *verdict) {
+	answers := make(map[string]subFinding)
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		code := strings.ToUpper(strings.Trim(strings.TrimSpace(key), "-*` "))
+		// "FAIL - hose cut off", ook met een ander streepje of een komma
+		result, reason, _ := strings.Cut(strings.TrimSpace(value), " ")
+		reason = strings.TrimLeft(reason, " -–—,:")
+		switch result = strings.ToUpper(strings.Trim(result, "`\"'.,:")); result {
+		case "PASS", "FAIL":
+		default:
+			result = "UNKNOWN"
+		}
+		answers[code] = subFinding{Code: code, Result: result, Reason: strings.TrimSpace(reason)}
+	}
+
+	v.SubFindings = make([]subFinding, 0, len(drainSubFindingCodes))
+	for _, code := range drainSubFindingCodes {
+		finding, ok := answers[code]
+		if !ok {
+			finding = subFinding{Code: code, Result: "UNKNOWN", Reason: "Not assessed"}
+		}
+		subFindingsTotal.WithLabelValues("drainHoseInDrain", code, finding.Result).Inc()
+		v.SubFindings = append(v.SubFindings, finding)
+	}
+	failSubFindings(v)
+}
+
+// failSubFindings maakt een PASS FAIL als een deelbevinding FAIL is, met die reden
+func failSubFindings(v *verdict) {
+	if v.Result != "PASS" {
+		return
+	}
+	for _, finding := range v.SubFindings {
+		if finding.Result != "FAIL" {
+			continue
+		}
+		reason := finding.Reason
+		if reason == "" {
+			reason = finding.Code
+		}
+		if finding.Photo != "" {
+			reason = finding.Photo + ": " + reason
+		}
+		v.Result, v.Reason = "FAIL", reason
+		return
+	}
+}
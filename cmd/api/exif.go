@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// ========================================
+// EXIF (metadata uit JPEG foto's, zonder externe library)
+// ========================================
+
+// exifData zijn de EXIF velden die we gebruiken (en bij de inspectie opslaan)
+type exifData struct {
+	CaptureTime *time.Time   `json:"captureTime,omitempty"` // DateTimeOriginal, anders DateTime
+	Make        string       `json:"make,omitempty"`
+	Model       string       `json:"model,omitempty"`
+	Software    string       `json:"software,omitempty"`    // app of firmware die de foto schreef
+	Orientation int          `json:"orientation,omitempty"` // 1 = normaal, 2-8 = gespiegeld en/of gedraaid (0 = onbekend)
+	GPS         *gpsPosition `json:"gps,omitempty"`
+	PixelWidth  int          `json:"pixelWidth,omitempty"` // afmetingen volgens de camera (zie fraud.go)
+	PixelHeight int          `json:"pixelHeight,omitempty"`
+}
+
+// gpsPosition is een positie in decimale graden (WGS84, zoals de camera hem opslaat)
+type gpsPosition struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// EXIF tags
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOrig   = 0x9011
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+var errNoEXIF = errors.New("no EXIF data")
+
+// parseEXIF zoekt het APP1 "Exif" segment in een JPEG en leest IFD0, de Exif IFD (opnametijd)
+// en de GPS IFD. Een opnametijd zonder tijdzone in de EXIF wordt gelezen in zone.
+func parseEXIF(data []byte, zone *time.Location) (exifData, error) {
+	tiff, err := findEXIFSegment(data)
+	if err != nil {
+		return exifData{}, err
+	}
+	if len(tiff) < 8 {
+		return exifData{}, errors.New("EXIF header too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return exifData{}, errors.New("invalid EXIF byte order")
+	}
+
+	var exif exifData
+	var exifIFD, gpsIFD uint32
+	var dateTime, dateTimeOriginal, offsetTime string
+	err = readIFD(tiff, order, order.Uint32(tiff[4:]), func(tag, typ uint16, count uint32, value []byte) {
+		switch tag {
+		case tagOrientation:
+			if typ == 3 && count >= 1 { // SHORT
+				exif.Orientation = int(order.Uint16(value))
+			}
+		case tagMake:
+			exif.Make = exifString(typ, value)
+		case tagModel:
+			exif.Model = exifString(typ, value)
+		case tagSoftware:
+			exif.Software = exifString(typ, value)
+		case tagDateTime:
+			dateTime = exifString(typ, value)
+		case tagExifIFD:
+			exifIFD = exifLong(order, typ, value)
+		case tagGPSIFD:
+			gpsIFD = exifLong(order, typ, value)
+		}
+	})
+	if err != nil {
+		return exif, err
+	}
+
+	// Fouten in de sub-IFDs negeren we: wat in IFD0 stond is nog steeds bruikbaar
+	if exifIFD > 0 {
+		readIFD(tiff, order, exifIFD, func(tag, typ uint16, count uint32, value []byte) {
+			switch tag {
+			case tagDateTimeOriginal:
+				dateTimeOriginal = exifString(typ, value)
+			case tagOffsetTimeOrig:
+				offsetTime = exifString(typ, value)
+			case tagPixelXDimension:
+				exif.PixelWidth = int(exifUint(order, typ, value))
+			case tagPixelYDimension:
+				exif.PixelHeight = int(exifUint(order, typ, value))
+			}
+		})
+	}
+	if gpsIFD > 0 {
+		var latRef, lonRef string
+		var lat, lon []float64
+		readIFD(tiff, order, gpsIFD, func(tag, typ uint16, count uint32, value []byte) {
+			switch tag {
+			case tagGPSLatitudeRef:
+				latRef = exifString(typ, value)
+			case tagGPSLatitude:
+				lat = exifRationals(order, typ, count, value)
+			case tagGPSLongitudeRef:
+				lonRef = exifString(typ, value)
+			case tagGPSLongitude:
+				lon = exifRationals(order, typ, count, value)
+			}
+		})
+		exif.GPS = gpsFromDMS(lat, latRef, lon, lonRef)
+	}
+
+	if dateTimeOriginal == "" {
+		dateTimeOriginal = dateTime
+	}
+	exif.CaptureTime = exifTime(dateTimeOriginal, offsetTime, zone)
+	return exif, nil
+}
+
+// exifString leest een ASCII waarde zonder de afsluitende NUL en spaties
+func exifString(typ uint16, value []byte) string {
+	if typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
+
+// exifLong leest een offset (LONG) naar een sub-IFD
+func exifLong(order binary.ByteOrder, typ uint16, value []byte) uint32 {
+	if typ != 4 || len(value) < 4 {
+		return 0
+	}
+	return order.Uint32(value)
+}
+
+// exifUint leest een getal dat als SHORT of LONG opgeslagen mag zijn
+func exifUint(order binary.ByteOrder, typ uint16, value []byte) uint32 {
+	if typ == 3 && len(value) >= 2 {
+		return uint32(order.Uint16(value))
+	}
+	return exifLong(order, typ, value)
+}
+
+// exifRationals leest count RATIONAL waarden (teller/noemer)
+func exifRationals(order binary.ByteOrder, typ uint16, count uint32, value []byte) []float64 {
+	if typ != 5 || len(value) < int(count)*8 {
+		return nil
+	}
+	values := make([]float64, count)
+	for i := range values {
+		numerator, denominator := order.Uint32(value[i*8:]), order.Uint32(value[i*8+4:])
+		if denominator == 0 {
+			return nil
+		}
+		values[i] = float64(numerator) / float64(denominator)
+	}
+	return values
+}
+
+// gpsFromDMS maakt decimale graden van graden/minuten/seconden plus N/S en E/W
+func gpsFromDMS(lat []float64, latRef string, lon []float64, lonRef string) *gpsPosition {
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil
+	}
+	position := &gpsPosition{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lon[0] + lon[1]/60 + lon[2]/3600,
+	}
+	if latRef == "S" {
+		position.Latitude = -position.Latitude
+	}
+	if lonRef == "W" {
+		position.Longitude = -position.Longitude
+	}
+	if math.Abs(position.Latitude) > 90 || math.Abs(position.Longitude) > 180 || (position.Latitude == 0 && position.Longitude == 0) {
+		return nil // onzin of een lege GPS fix
+	}
+	return position
+}
+
+// exifTime leest "2006:01:02 15:04:05" met de offset uit OffsetTimeOriginal ("+02:00"),
+// of anders in zone (camera's slaan meestal lokale tijd op zonder zone)
+func exifTime(value, offset string, zone *time.Location) *time.Time {
+	if value == "" {
+		return nil
+	}
+	var t time.Time
+	var err error
+	if offset != "" {
+		t, err = time.Parse("2006:01:02 15:04:05-07:00", value+offset)
+	} else {
+		t, err = time.ParseInLocation("2006:01:02 15:04:05", value, zone)
+	}
+	if err != nil || t.Year() < 2000 {
+		return nil // "0000:00:00 00:00:00" of een kapotte klok
+	}
+	t = t.UTC()
+	return &t
+}
+
+// findEXIFSegment geeft de TIFF data uit het APP1 segment (na "Exif\0\0")
+func findEXIFSegment(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errNoEXIF
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) || marker == 0xDA {
+			break
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:], nil
+		}
+		pos = end
+	}
+	return nil, errNoEXIF
+}
+
+// readIFD roept fn aan voor elke tag in de IFD op offset. value is de waarde
+// zelf (max 4 bytes, inline) of de data waar de offset naar wijst.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, fn func(tag, typ uint16, count uint32, value []byte)) error {
+	if int(offset)+2 > len(tiff) {
+		return errors.New("EXIF IFD offset out of range")
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	for i := 0; i < entries; i++ {
+		if pos+12 > len(tiff) {
+			return errors.New("EXIF IFD truncated")
+		}
+		entry := tiff[pos : pos+12]
+		pos += 12
+
+		tag := order.Uint16(entry[0:])
+		typ := order.Uint16(entry[2:])
+		count := order.Uint32(entry[4:])
+		size := exifTypeSize(typ) * int(count)
+		if size <= 0 || count > 1<<20 {
+			continue // onbekend type of onzinnige lengte: overslaan
+		}
+
+		value := entry[8:12]
+		if size > 4 {
+			start := int(order.Uint32(entry[8:]))
+			if start < 0 || start+size > len(tiff) {
+				continue
+			}
+			value = tiff[start : start+size]
+		}
+		fn(tag, typ, count, value)
+	}
+	return nil
+}
+
+// exifTypeSize is de grootte in bytes van één waarde van een TIFF type
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// tiffEntry is één tag in een IFD die buildTIFF wegschrijft
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiTag(tag uint16, value string) tiffEntry {
+	data := append([]byte(value), 0)
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(data)), data: data}
+}
+
+func shortTag(order binary.ByteOrder, tag, value uint16) tiffEntry {
+	data := make([]byte, 2)
+	order.PutUint16(data, value)
+	return tiffEntry{tag: tag, typ: 3, count: 1, data: data}
+}
+
+// dmsTag is een GPS positie als drie RATIONALs: graden, minuten en seconden (x100)
+func dmsTag(order binary.ByteOrder, tag uint16, degrees, minutes, centiSeconds uint32) tiffEntry {
+	data := make([]byte, 24)
+	for i, v := range [][2]uint32{{degrees, 1}, {minutes, 1}, {centiSeconds, 100}} {
+		order.PutUint32(data[i*8:], v[0])
+		order.PutUint32(data[i*8+4:], v[1])
+	}
+	return tiffEntry{tag: tag, typ: 5, count: 3, data: data}
+}
+
+// buildTIFF maakt de TIFF data van een EXIF segment: IFD0 met (als ze er zijn) verwijzingen
+// naar de Exif en GPS IFD, en daarachter alle waarden van meer dan 4 bytes
+func buildTIFF(order binary.ByteOrder, ifd0, exifIFD, gpsIFD []tiffEntry) []byte {
+	ifd0 = append([]tiffEntry(nil), ifd0...)
+	if exifIFD != nil {
+		ifd0 = append(ifd0, tiffEntry{tag: tagExifIFD, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	if gpsIFD != nil {
+		ifd0 = append(ifd0, tiffEntry{tag: tagGPSIFD, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	size := func(entries []tiffEntry) int {
+		if entries == nil {
+			return 0
+		}
+		return 2 + 12*len(entries) + 4
+	}
+	exifOffset := 8 + size(ifd0)
+	gpsOffset := exifOffset + size(exifIFD)
+	dataOffset := gpsOffset + size(gpsIFD)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			order.PutUint32(ifd0[i].data, uint32(exifOffset))
+		case tagGPSIFD:
+			order.PutUint32(ifd0[i].data, uint32(gpsOffset))
+		}
+	}
+
+	out := make([]byte, dataOffset)
+	if order == binary.LittleEndian {
+		copy(out, "II")
+	} else {
+		copy(out, "MM")
+	}
+	order.PutUint16(out[2:], 42)
+	order.PutUint32(out[4:], 8)
+	var data []byte
+	for _, ifd := range []struct {
+		offset  int
+		entries []tiffEntry
+	}{{8, ifd0}, {exifOffset, exifIFD}, {gpsOffset, gpsIFD}} {
+		if ifd.entries == nil {
+			continue
+		}
+		order.PutUint16(out[ifd.offset:], uint16(len(ifd.entries)))
+		for i, entry := range ifd.entries {
+			pos := ifd.offset + 2 + 12*i
+			order.PutUint16(out[pos:], entry.tag)
+			order.PutUint16(out[pos+2:], entry.typ)
+			order.PutUint32(out[pos+4:], entry.count)
+			if len(entry.data) <= 4 {
+				copy(out[pos+8:], entry.data)
+				continue
+			}
+			order.PutUint32(out[pos+8:], uint32(dataOffset+len(data)))
+			data = append(data, entry.data...)
+		}
+	}
+	return append(out, data...)
+}
+
+// exifJPEG is een JPEG met de TIFF data in een APP1 "Exif" segment
+func exifJPEG(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	return withAPP1(testJPEG(t, 32, 24), append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestParseEXIF(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	full := func(order binary.ByteOrder) []byte {
+		return buildTIFF(order,
+			[]tiffEntry{asciiTag(tagMake, "Apple"), asciiTag(tagModel, "iPhone 15"), shortTag(order, tagOrientation, 6), asciiTag(tagDateTime, "2026:10:01 09:00:00")},
+			[]tiffEntry{asciiTag(tagDateTimeOriginal, "2026:10:01 10:30:00"), asciiTag(tagOffsetTimeOrig, "+02:00"), shortTag(order, tagPixelXDimension, 4032)},
+			[]tiffEntry{asciiTag(tagGPSLatitudeRef, "N"), dmsTag(order, tagGPSLatitude, 52, 22, 1800), asciiTag(tagGPSLongitudeRef, "E"), dmsTag(order, tagGPSLongitude, 4, 54, 0)},
+		)
+	}
+
+	tests := []struct {
+		name        string
+		photo       []byte
+		wantErr     bool
+		make        string
+		orientation int
+		captured    string // UTC, leeg = geen opnametijd
+		gps         bool
+		pixelWidth  int
+	}{
+		{"little endian", exifJPEG(t, full(binary.LittleEndian)), false, "Apple", 6, "2026-10-01T08:30:00Z", true, 4032},
+		{"big endian", exifJPEG(t, full(binary.BigEndian)), false, "Apple", 6, "2026-10-01T08:30:00Z", true, 4032},
+		// Zonder Exif IFD: DateTime uit IFD0, zonder offset gelezen in de zone van de projecten
+		{"DateTime in zone", exifJPEG(t, buildTIFF(binary.LittleEndian, []tiffEntry{asciiTag(tagDateTime, "2026:01:15 12:00:00")}, nil, nil)), false, "", 0, "2026-01-15T11:00:00Z", false, 0},
+		{"zeroed clock", exifJPEG(t, buildTIFF(binary.LittleEndian, []tiffEntry{asciiTag(tagDateTime, "0000:00:00 00:00:00")}, nil, nil)), false, "", 0, "", false, 0},
+		{"no EXIF", testJPEG(t, 32, 24), true, "", 0, "", false, 0},
+		{"not a JPEG", []byte("GIF89a"), true, "", 0, "", false, 0},
+		{"bad byte order", exifJPEG(t, []byte("XX\x00\x2a\x00\x00\x00\x08")), true, "", 0, "", false, 0},
+		{"IFD out of range", exifJPEG(t, []byte("II\x2a\x00\xff\x00\x00\x00")), true, "", 0, "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exif, err := parseEXIF(tt.photo, amsterdam)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if exif.Make != tt.make || exif.Orientation != tt.orientation || exif.PixelWidth != tt.pixelWidth {
+				t.Errorf("make %q, orientation %d, pixel width %d, want %q, %d, %d", exif.Make, exif.Orientation, exif.PixelWidth, tt.make, tt.orientation, tt.pixelWidth)
+			}
+			switch {
+			case tt.captured == "" && exif.CaptureTime != nil:
+				t.Errorf("capture time %v, want none", exif.CaptureTime)
+			case tt.captured != "" && (exif.CaptureTime == nil || exif.CaptureTime.Format(time.RFC3339) != tt.captured):
+				t.Errorf("capture time %v, want %s", exif.CaptureTime, tt.captured)
+			}
+			if (exif.GPS != nil) != tt.gps {
+				t.Fatalf("gps = %+v, want present %v", exif.GPS, tt.gps)
+			}
+			if tt.gps && (math.Abs(exif.GPS.Latitude-52.3716667) > 1e-6 || math.Abs(exif.GPS.Longitude-4.9) > 1e-6) {
+				t.Errorf("gps = %+v, want 52.3716667, 4.9", exif.GPS)
+			}
+		})
+	}
+}
+
+func TestEXIFTime(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	tests := []struct {
+		name, value, offset string
+		zone                *time.Location
+		want                string // UTC, leeg = nil
+	}{
+		{"offset wins over zone", "2026:07:01 12:00:00", "-05:00", amsterdam, "2026-07-01T17:00:00Z"},
+		{"zone in summer", "2026:07:01 12:00:00", "", amsterdam, "2026-07-01T10:00:00Z"},
+		{"zone in winter", "2026:01:01 12:00:00", "", amsterdam, "2026-01-01T11:00:00Z"},
+		{"UTC zone", "2026:01:01 12:00:00", "", time.UTC, "2026-01-01T12:00:00Z"},
+		{"empty", "", "+02:00", amsterdam, ""},
+		{"before 2000", "1999:12:31 23:59:59", "", time.UTC, ""},
+		{"malformed", "2026-01-01 12:00:00", "", time.UTC, ""},
+		{"malformed offset", "2026:01:01 12:00:00", "CET", time.UTC, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exifTime(tt.value, tt.offset, tt.zone)
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("exifTime = %v, want nil", got)
+			case tt.want != "" && (got == nil || got.Format(time.RFC3339) != tt.want):
+				t.Errorf("exifTime = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGPSFromDMS(t *testing.T) {
+	tests := []struct {
+		name            string
+		lat             []float64
+		latRef          string
+		lon             []float64
+		lonRef          string
+		wantLat, wantLo float64
+		wantNil         bool
+	}{
+		{"north east", []float64{52, 22, 18}, "N", []float64{4, 54, 0}, "E", 52.371667, 4.9, false},
+		{"south west", []float64{33, 51, 54}, "S", []float64{151, 12, 36}, "W", -33.865, -151.21, false},
+		{"missing seconds", []float64{52, 22}, "N", []float64{4, 54, 0}, "E", 0, 0, true},
+		{"latitude over 90", []float64{91, 0, 0}, "N", []float64{4, 54, 0}, "E", 0, 0, true},
+		{"longitude over 180", []float64{52, 0, 0}, "N", []float64{181, 0, 0}, "E", 0, 0, true},
+		{"empty fix", []float64{0, 0, 0}, "N", []float64{0, 0, 0}, "E", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gpsFromDMS(tt.lat, tt.latRef, tt.lon, tt.lonRef)
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("gpsFromDMS = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || math.Abs(got.Latitude-tt.wantLat) > 1e-5 || math.Abs(got.Longitude-tt.wantLo) > 1e-5 {
+				t.Errorf("gpsFromDMS = %+v, want %v, %v", got, tt.wantLat, tt.wantLo)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ========================================
+// FRAUDESIGNALEN (bewerkte foto's, screenshots, foto van een scherm)
+// ========================================
+
+// codePhotoIntegrityRisk: de tenant weigert foto's vanaf een bepaalde risicoscore
+const codePhotoIntegrityRisk = "PHOTO_INTEGRITY_RISK"
+
+// Signalen met hun gewicht (kans dat de foto niet rechtstreeks van de camera komt)
+var riskSignalWeights = map[string]float64{
+	"EDITING_SOFTWARE":        0.5,  // EXIF software tag van een bewerkings app
+	"SCREENSHOT":              0.5,  // PNG zonder camera metadata
+	"MOIRE_PATTERN":           0.45, // periodiek patroon van de pixels van een scherm
+	"DIMENSIONS_MISMATCH":     0.35, // afmetingen wijken af van wat de camera in de EXIF schreef
+	"NO_CAMERA_METADATA":      0.25, // JPEG zonder merk en model van het toestel
+	"DOUBLE_COMPRESSION_HINT": 0.15, // camera EXIF maar standaard libjpeg tabellen op een lage kwaliteit: opnieuw opgeslagen
+	"LOW_JPEG_QUALITY":        0.15, // sterk gecomprimeerd, bijv. doorgestuurd via een chat app
+}
+
+// resaveMaxQuality: telefoons die de standaard libjpeg tabellen gebruiken slaan op vanaf ~92 op;
+// dezelfde tabellen op deze kwaliteit of lager wijzen op opnieuw opslaan (bewerker, chat app)
+const resaveMaxQuality = 90
+
+// editingSoftware zijn (delen van) software tags van bewerkings apps
+var editingSoftware = []string{"photoshop", "lightroom", "gimp", "snapseed", "picsart", "facetune", "pixelmator", "affinity", "canva", "vsco", "paint.net", "photoroom", "airbrush"}
+
+// photoRisk is de risicoscore (0-1) met de signalen die afgingen
+type photoRisk struct {
+	Score   float64      `json:"score"`
+	Signals []riskSignal `json:"signals,omitempty"`
+}
+
+type riskSignal struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// add voegt een signaal toe; de score combineert de gewichten als onafhankelijke kansen
+func (p *photoRisk) add(code, detail string) {
+	p.Signals = append(p.Signals, riskSignal{Code: code, Detail: detail})
+	p.Score = 1 - (1-p.Score)*(1-riskSignalWeights[code])
+	p.Score = math.Round(p.Score*100) / 100
+}
+
+// assessPhoto zoekt de signalen in de ruwe foto, de EXIF en (als die er is) de gedecodeerde foto
+func assessPhoto(photoBytes []byte, contentType string, exif exifData, decoded *decodedPhoto) photoRisk {
+	var risk photoRisk
+
+	software := strings.ToLower(exif.Software)
+	for _, editor := range editingSoftware {
+		if strings.Contains(software, editor) {
+			risk.add("EDITING_SOFTWARE", exif.Software)
+			break
+		}
+	}
+
+	// EXIF lezen we alleen uit JPEG (zie findEXIFSegment); bij HEIC, WebP e.d. zegt een lege EXIF niets
+	hasCamera := exif.Make != "" || exif.Model != ""
+	isJPEG := len(photoBytes) >= 2 && photoBytes[0] == 0xFF && photoBytes[1] == 0xD8
+	switch {
+	case !hasCamera && contentType == "image/png":
+		risk.add("SCREENSHOT", "PNG without camera metadata")
+	case !hasCamera && isJPEG:
+		risk.add("NO_CAMERA_METADATA", "")
+	}
+
+	if decoded != nil && exif.PixelWidth > 0 && exif.PixelHeight > 0 {
+		width, height := decoded.img.Bounds().Dx(), decoded.img.Bounds().Dy()
+		if !(width == exif.PixelWidth && height == exif.PixelHeight) && !(width == exif.PixelHeight && height == exif.PixelWidth) {
+			risk.add("DIMENSIONS_MISMATCH", fmt.Sprintf("EXIF %dx%d, image %dx%d", exif.PixelWidth, exif.PixelHeight, width, height))
+		}
+	}
+
+	if table, ok := jpegLuminanceTable(photoBytes); ok {
+		quality, standard := jpegQuality(table)
+		if quality < 60 {
+			risk.add("LOW_JPEG_QUALITY", "quality "+strconv.Itoa(quality))
+		}
+		if standard && hasCamera && quality <= resaveMaxQuality {
+			risk.add("DOUBLE_COMPRESSION_HINT", "standard tables at quality "+strconv.Itoa(quality))
+		}
+	}
+
+	if decoded != nil {
+		if periodicity, lag := moireScore(decoded.img); periodicity >= moireThreshold {
+			risk.add("MOIRE_PATTERN", fmt.Sprintf("periodicity %.2f at %d px", periodicity, lag))
+		}
+	}
+
+	for _, signal := range risk.Signals {
+		photoRiskSignalsTotal.WithLabelValues(signal.Code).Inc()
+	}
+	return risk
+}
+
+// ========================================
+// JPEG KWANTISATIE (kwaliteit en herkomst van de tabellen)
+// ========================================
+
+// stdLuminanceTable is de luminantie tabel uit de JPEG standaard (Annex K), in zigzag volgorde
+// zoals hij in het DQT segment staat
+var stdLuminanceTable = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14, 13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37, 29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68, 87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113, 121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// jpegLuminanceTable leest kwantisatie tabel 0 uit de DQT segmenten (tot de start van de scan)
+func jpegLuminanceTable(data []byte) (table [64]int, ok bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return table, false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return table, false
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return table, false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return table, false
+		}
+		if marker == 0xDB {
+			segment := data[i+4 : i+2+length]
+			for len(segment) > 0 {
+				precision, id := segment[0]>>4, segment[0]&0x0F
+				size := 64 * (1 + int(precision))
+				if len(segment) < 1+size {
+					return table, false
+				}
+				if id == 0 {
+					for j := range table {
+						if precision == 0 {
+							table[j] = int(segment[1+j])
+						} else {
+							table[j] = int(binary.BigEndian.Uint16(segment[1+2*j:]))
+						}
+					}
+					return table, true
+				}
+				segment = segment[1+size:]
+			}
+		}
+		i += 2 + length
+	}
+	return table, false
+}
+
+// jpegQuality schat de kwaliteit (1-100) zoals libjpeg hem gebruikt, en of de tabel precies
+// de geschaalde standaard tabel is (zoals libjpeg en de meeste bewerkings software hem schrijven)
+func jpegQuality(table [64]int) (quality int, standard bool) {
+	var scale float64
+	for i, q := range table {
+		scale += float64(q) * 100 / float64(stdLuminanceTable[i])
+	}
+	scale /= 64
+
+	if scale <= 100 {
+		quality = int(math.Round((200 - scale) / 2))
+	} else {
+		quality = int(math.Round(5000 / scale))
+	}
+	quality = min(max(quality, 1), 100)
+
+	// De tabel die libjpeg bij deze kwaliteit zou maken
+	libjpegScale := 200 - 2*quality
+	if quality < 50 {
+		libjpegScale = 5000 / quality
+	}
+	for i, q := range table {
+		if min(max((stdLuminanceTable[i]*libjpegScale+50)/100, 1), 255) != q {
+			return quality, false
+		}
+	}
+	return quality, true
+}
+
+// ========================================
+// MOIRÉ (foto van een beeldscherm)
+// ========================================
+
+const (
+	moireCrop      = 512  // we kijken naar het midden van de foto op volle resolutie
+	moireMaxLag    = 16   // periodes tot 16 pixels
+	moireThreshold = 0.35 // natuurlijke foto's blijven ruim onder deze autocorrelatie
+)
+
+// moireScore zoekt een periodiek patroon in de helderheid: de autocorrelatie van de verschillen
+// tussen buurpixels, over rijen en kolommen. Bij een natuurlijke foto valt die snel weg, bij het
+// raster van een scherm komt hij terug bij de periode van het raster. Periode 2 slaan we over,
+// die laat de demosaicing van de Bayer sensor in gewone camera foto's achter, en 8 en 16 ook,
+// daar zitten de 8x8 blokken van de JPEG compressie.
+func moireScore(img image.Image) (periodicity float64, lag int) {
+	bounds := img.Bounds()
+	size := min(moireCrop, bounds.Dx(), bounds.Dy())
+	if size < 4*moireMaxLag {
+		return 0, 0
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-size)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-size)/2
+
+	// Helderheid van het midden
+	gray := make([]float64, size*size)
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if isYCbCr {
+				gray[y*size+x] = float64(ycbcr.Y[ycbcr.YOffset(x0+x, y0+y)])
+			} else {
+				gray[y*size+x] = float64(color.GrayModel.Convert(img.At(x0+x, y0+y)).(color.Gray).Y)
+			}
+		}
+	}
+
+	// Autocorrelatie van de verschillen, over rijen (dx=1) en kolommen (dx=size)
+	var energy float64
+	correlation := make([]float64, moireMaxLag+1)
+	for _, stride := range [2][2]int{{1, size}, {size, 1}} {
+		step, next := stride[0], stride[1]
+		for line := 0; line < size; line++ {
+			start := line * next
+			diff := make([]float64, size-1)
+			for i := range diff {
+				diff[i] = gray[start+(i+1)*step] - gray[start+i*step]
+				energy += diff[i] * diff[i]
+			}
+			for k := 3; k <= moireMaxLag; k++ {
+				for i := 0; i+k < len(diff); i++ {
+					correlation[k] += diff[i] * diff[i+k]
+				}
+			}
+		}
+	}
+	if energy == 0 {
+		return 0, 0
+	}
+	for k := 3; k <= moireMaxLag; k++ {
+		if k%8 == 0 {
+			continue
+		}
+		if c := correlation[k] / energy; c > periodicity {
+			periodicity, lag = c, k
+		}
+	}
+	return periodicity, lag
+}
+
+// ========================================
+// WEIGEREN (alleen als de tenant dat wil)
+// ========================================
+
+// checkPhotoRisk zet de risicoscore van de meest verdachte foto in de headers en weigert de
+// request als de tenant een rejectRiskScore heeft en de score die haalt. Bij een weigering is
+// 422 al verstuurd.
+func (a *app) checkPhotoRisk(w http.ResponseWriter, r *http.Request, photos []uploadedPhoto) bool {
+	risk := highestRisk(photos)
+	w.Header().Set("X-Photo-Risk-Score", strconv.FormatFloat(risk.Score, 'f', 2, 64))
+	if len(risk.Signals) > 0 {
+		codes := make([]string, len(risk.Signals))
+		for i, signal := range risk.Signals {
+			codes[i] = signal.Code
+		}
+		addLogAttrs(r.Context(), slog.Float64("riskScore", risk.Score), slog.Any("riskSignals", codes))
+	}
+
+	threshold := a.tenants.settings(tenantFrom(r.Context())).RejectRiskScore
+	if threshold <= 0 || risk.Score < threshold {
+		return true
+	}
+
+	addLogAttrs(r.Context(), slog.String("errorCode", codePhotoIntegrityRisk))
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":   "Photo does not appear to come straight from the camera",
+		"code":    codePhotoIntegrityRisk,
+		"score":   risk.Score,
+		"signals": risk.Signals,
+	})
+	return false
+}
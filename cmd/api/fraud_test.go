@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+// cameraPhoto is een echte foto van een installateur (telefoon, eigen kwantisatie tabellen)
+func cameraPhoto(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../../testmap/1waterpas/test.JPG")
+	if err != nil {
+		t.Skipf("test photo not available: %v", err)
+	}
+	return data
+}
+
+// reencode slaat een foto opnieuw op met de standaard libjpeg tabellen (zoals Go en de meeste apps)
+func reencode(t *testing.T, data []byte, quality int) []byte {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// screenPhoto is een foto van een beeldscherm: het raster van de subpixels (elke 3 px) door het beeld heen
+func screenPhoto(t *testing.T) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewGray(image.Rect(0, 0, 800, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 800; x++ {
+			level := 90 + x/10 + rng.Intn(12)
+			if x%3 == 0 || y%3 == 0 {
+				level += 70
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(min(level, 255))})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssessPhoto(t *testing.T) {
+	camera := cameraPhoto(t)
+	phone := exifData{Make: "samsung", Model: "SM-A546B"}
+
+	var screenshot bytes.Buffer
+	img, _, _ := image.Decode(bytes.NewReader(camera))
+	png.Encode(&screenshot, img)
+
+	tests := []struct {
+		name        string
+		photo       []byte
+		contentType string
+		exif        exifData
+		want        []string // signalen die af moeten gaan
+		notWant     []string // signalen die juist niet af mogen gaan
+	}{
+		{"camera JPEG", camera, "image/jpeg", phone, nil, []string{"DOUBLE_COMPRESSION_HINT", "NO_CAMERA_METADATA", "MOIRE_PATTERN"}},
+		{"phone writing standard libjpeg tables", reencode(t, camera, 95), "image/jpeg", phone, nil, []string{"DOUBLE_COMPRESSION_HINT"}},
+		{"re-saved JPEG", reencode(t, camera, 80), "image/jpeg", phone, []string{"DOUBLE_COMPRESSION_HINT"}, nil},
+		{"edited JPEG", camera, "image/jpeg", exifData{Make: "Apple", Model: "iPhone 13", Software: "Snapseed 2.0"}, []string{"EDITING_SOFTWARE"}, nil},
+		{"forwarded via chat app", reencode(t, camera, 50), "image/jpeg", exifData{}, []string{"LOW_JPEG_QUALITY", "NO_CAMERA_METADATA"}, nil},
+		{"screenshot", screenshot.Bytes(), "image/png", exifData{}, []string{"SCREENSHOT"}, []string{"NO_CAMERA_METADATA"}},
+		{"photographed screen", screenPhoto(t), "image/jpeg", phone, []string{"MOIRE_PATTERN"}, nil},
+		{"HEIC without parsed EXIF", []byte("\x00\x00\x00\x18ftypheic"), "image/heic", exifData{}, nil, []string{"NO_CAMERA_METADATA", "SCREENSHOT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded *decodedPhoto
+			if d, err := decodePhoto(bytes.NewReader(tt.photo), 0); err == nil {
+				decoded = &d
+			}
+			risk := assessPhoto(tt.photo, tt.contentType, tt.exif, decoded)
+
+			var codes []string
+			for _, signal := range risk.Signals {
+				codes = append(codes, signal.Code)
+			}
+			for _, code := range tt.want {
+				if !slices.Contains(codes, code) {
+					t.Errorf("signals %v, missing %s", codes, code)
+				}
+			}
+			for _, code := range tt.notWant {
+				if slices.Contains(codes, code) {
+					t.Errorf("signals %v, unexpected %s", codes, code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+// ========================================
+// GEOFENCE (was de installateur op het adres?)
+// ========================================
+
+// Waarden van locationVerified in gold responses
+const (
+	locationVerified   = "true"
+	locationNotOnSite  = "false"
+	locationUnverified = "unknown" // project zonder geofence of foto zonder GPS
+)
+
+// Flags bij een inspectie
+const (
+	flagLocationOutsideGeofence = "LOCATION_OUTSIDE_GEOFENCE" // GPS van de foto ligt buiten de straal rond het adres
+	flagLocationUnknown         = "LOCATION_UNKNOWN"          // wel een geofence, maar geen GPS in de EXIF
+)
+
+const (
+	earthRadiusMeters       = 6371000 // gemiddelde straal van de aarde (haversine)
+	maxGeofenceRadiusMeters = 50000   // grotere geofences bewijzen niets meer
+)
+
+// distanceMeters is de afstand over het aardoppervlak tussen twee posities (haversine)
+func distanceMeters(a, b gpsPosition) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// checkLocation vergelijkt de GPS positie uit de EXIF met de geofence van het project.
+// Geeft locationVerified, de afstand tot het adres (nil als onbekend) en de flags.
+func (a *app) checkLocation(r *http.Request, p project, photo uploadedPhoto) (verified string, distance *float64, flags []string) {
+	if p.Location == nil {
+		return locationUnverified, nil, nil
+	}
+	if photo.EXIF.GPS == nil {
+		geofenceChecksTotal.WithLabelValues("unknown").Inc()
+		return locationUnverified, nil, []string{flagLocationUnknown}
+	}
+
+	meters := math.Round(distanceMeters(*photo.EXIF.GPS, *p.Location))
+	radius := p.RadiusMeters
+	if radius == 0 {
+		radius = a.cfg.Projects.GeofenceRadiusMeters
+	}
+	if meters <= radius {
+		geofenceChecksTotal.WithLabelValues("inside").Inc()
+		return locationVerified, &meters, nil
+	}
+	geofenceChecksTotal.WithLabelValues("outside").Inc()
+	addLogAttrs(r.Context(), slog.Float64("distanceMeters", meters))
+	return locationNotOnSite, &meters, []string{flagLocationOutsideGeofence}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b gpsPosition
+		want float64 // meters, haversine met een straal van 6371 km
+	}{
+		{"same point", gpsPosition{52.3791, 4.9003}, gpsPosition{52.3791, 4.9003}, 0},
+		{"one degree of latitude", gpsPosition{0, 0}, gpsPosition{1, 0}, 111194.93},
+		{"one degree of longitude at 60N", gpsPosition{60, 0}, gpsPosition{60, 1}, 55596.93},
+		{"Amsterdam to Rotterdam", gpsPosition{52.3791, 4.9003}, gpsPosition{51.9244, 4.4690}, 58499.60},
+		{"Paris to London", gpsPosition{48.8566, 2.3522}, gpsPosition{51.5074, -0.1278}, 343556.06},
+		{"across the date line", gpsPosition{0, 179.9995}, gpsPosition{0, -179.9995}, 111.19},
+		{"antipodes", gpsPosition{0, 0}, gpsPosition{0, 180}, math.Pi * earthRadiusMeters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := distanceMeters(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("distanceMeters = %.2f, want %.2f", got, tt.want)
+			}
+			if back := distanceMeters(tt.b, tt.a); math.Abs(back-got) > 1e-6 {
+				t.Errorf("distance back = %.2f, want %.2f", back, got)
+			}
+		})
+	}
+}
+
+func TestCheckLocation(t *testing.T) {
+	site := gpsPosition{52.3791, 4.9003}
+	// north ligt het gegeven aantal meters ten noorden van het adres
+	north := func(meters float64) *gpsPosition {
+		return &gpsPosition{Latitude: site.Latitude + meters/earthRadiusMeters*180/math.Pi, Longitude: site.Longitude}
+	}
+
+	tests := []struct {
+		name         string
+		location     *gpsPosition
+		radius       float64 // van het project, 0 = projects.geofenceRadiusMeters (250)
+		gps          *gpsPosition
+		wantVerified string
+		wantDistance float64 // -1 = geen afstand
+		wantFlags    []string
+	}{
+		{"no geofence", nil, 0, north(10), locationUnverified, -1, nil},
+		{"no GPS", &site, 100, nil, locationUnverified, -1, []string{flagLocationUnknown}},
+		{"on the address", &site, 100, &site, locationVerified, 0, nil},
+		{"inside", &site, 100, north(60), locationVerified, 60, nil},
+		{"on the radius", &site, 100, north(100), locationVerified, 100, nil},
+		{"rounds to the radius", &site, 100, north(100.4), locationVerified, 100, nil},
+		{"just outside", &site, 100, north(101), locationNotOnSite, 101, []string{flagLocationOutsideGeofence}},
+		{"far away", &site, 100, &gpsPosition{51.9244, 4.4690}, locationNotOnSite, 58500, []string{flagLocationOutsideGeofence}},
+		{"default radius inside", &site, 0, north(250), locationVerified, 250, nil},
+		{"default radius outside", &site, 0, north(251), locationNotOnSite, 251, []string{flagLocationOutsideGeofence}},
+		{"own radius beats the default", &site, 1000, north(600), locationVerified, 600, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			a.cfg.Projects.GeofenceRadiusMeters = 250
+			p := project{Location: tt.location, RadiusMeters: tt.radius}
+
+			verified, distance, flags := a.checkLocation(httptest.NewRequest(http.MethodPost, "/", nil), p, uploadedPhoto{EXIF: exifData{GPS: tt.gps}})
+			if verified != tt.wantVerified || !slices.Equal(flags, tt.wantFlags) {
+				t.Errorf("verified %q, flags %v, want %q, %v", verified, flags, tt.wantVerified, tt.wantFlags)
+			}
+			switch {
+			case tt.wantDistance < 0 && distance != nil:
+				t.Errorf("distance %v, want none", *distance)
+			case tt.wantDistance >= 0 && (distance == nil || *distance != tt.wantDistance):
+				t.Errorf("distance %v, want %v", distance, tt.wantDistance)
+			}
+		})
+	}
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Eenvoudige response struct voor alleen result (Silver tier)
+type QualityResponse struct {
+	Result         string `json:"result"`                   // PASS of FAIL
+	Cached         bool   `json:"cached,omitempty"`         // true = eerder oordeel over dezelfde foto
+	ReasonCode     string `json:"reasonCode,omitempty"`     // WRONG_SUBJECT als de foto iets anders toont (zie relevance.go)
+	SuggestedCheck string `json:"suggestedCheck,omitempty"` // check waar de foto wel bewijs voor is
+}
+
+// Uitgebreide response struct voor Gold tier
+type GoldResponse struct {
+	Result           string         `json:"result"`        // PASS of FAIL
+	ProjectNumber    string         `json:"projectNumber"` // Project identifier
+	Reason           string         `json:"reason"`        // Uitleg waarom PASS/FAIL
+	Provider         string         `json:"provider"`      // Welke AI provider het antwoord gaf
+	InspectionID     string         `json:"inspectionId"`  // Id voor de usage/billing administratie
+	Cached           bool           `json:"cached,omitempty"`
+	Findings         []imageFinding `json:"findings,omitempty"` // oordeel per beeld als de foto in uitsneden beoordeeld is
+	Flags            []string       `json:"flags,omitempty"`    // bijv. CAPTURE_TIME_OUTSIDE_WINDOW (zie projects.go)
+	LocationVerified string         `json:"locationVerified"`   // true, false of unknown (zie geofence.go)
+	SuspectedReuse   bool           `json:"suspectedReuse"`     // zelfde foto al bij een ander project gebruikt, binnen de laatste storage.maxRecentInspections (zie phash.go)
+	ReuseMatches     []reuseMatch   `json:"reuseMatches,omitempty"`
+	Risk             photoRisk      `json:"risk"`                     // risicoscore en signalen van bewerking of een screenshot (zie fraud.go)
+	ReasonCode       string         `json:"reasonCode,omitempty"`     // WRONG_SUBJECT als de foto iets anders toont (zie relevance.go)
+	SuggestedCheck   string         `json:"suggestedCheck,omitempty"` // check waar de foto wel bewijs voor is
+	Level            *levelReport   `json:"level,omitempty"`          // aflezing van de waterpas (alleen applianceIsLevel, zie level.go)
+	SubFindings      []subFinding   `json:"subFindings,omitempty"`    // los beoordeelde onderdelen, bijv. schade aan de afvoerslang (zie drain.go)
+}
+
+// app bundelt alles wat de handlers nodig hebben
+type app struct {
+	cfg         config
+	vision      *visionRouter
+	tenants     *tenantDirectory
+	inspections *inspectionStore
+	quotas      *quotaGuard
+	cache       *resultCache // nil = cache uit
+	idempotency *idempotencyStore
+	uploads     *byteLimiter // begrenst het geheugen van alle uploads samen
+	projects    *projectStore
+}
+
+// registerRoutes registreert de silver en gold routes voor alle checks
+func (a *app) registerRoutes(mux *http.ServeMux) {
+	// ========================================
+	// LAUNDRY INSTALLATION CHECK ROUTES
+	// ========================================
+	for _, check := range laundryChecks {
+		if check.GoldOnly {
+			continue
+		}
+		// POST /api/laundry/silver/v1/{check}
+		mux.HandleFunc("/api/laundry/silver/v1/"+check.ID, a.tenants.requireTenant(a.idempotency.withIdempotency(a.silverHandler(check))))
+	}
+
+	// ========================================
+	// GOLD TIER ROUTES (met projectNumber en reasoning)
+	// ========================================
+
+	// POST /api/laundry/gold/v1/{projectNumber}/{check}
+	mux.HandleFunc("/api/laundry/gold/v1/", a.tenants.requireTenant(a.idempotency.withIdempotency(a.goldHandler)))
+
+	// GET/PUT/DELETE /api/projects/v1/{projectNumber} (afspraakvenster van een project)
+	mux.HandleFunc("/api/projects/v1/", a.tenants.requireTenant(a.projectHandler))
+
+	// GET /api/usage/v1 (tokens en kosten van de eigen tenant)
+	mux.HandleFunc("/api/usage/v1", a.tenants.requireTenant(a.usageHandler))
+}
+
+// silverHandler geeft alleen PASS of FAIL terug
+func (a *app) silverHandler(check checkDefinition) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Controleer of het een POST request is
+		if r.Method != "POST" {
+			writeError(w, http.StatusMethodNotAllowed, "ONLY POST REQUESTS ARE ALLOWED")
+			return
+		}
+		if !a.cfg.Tiers.Silver.Enabled {
+			writeError(w, http.StatusNotFound, "Silver tier is not enabled")
+			return
+		}
+
+		photos, releasePhotos, ok := a.readPhotos(w, r, "silver", a.cfg.imageSettingsFor(check.ID), a.cfg.Upload.MaxPhotos, false)
+		if !ok {
+			return
+		}
+		defer releasePhotos()
+
+		// Zonder Content-Length pas nu op de foto's geclaimd (zie withIdempotency)
+		if !a.idempotency.claim(w, r, photosKey(photos)) {
+			return
+		}
+
+		// Bewerkt of een screenshot? Alleen weigeren als de tenant dat wil
+		if !a.checkPhotoRisk(w, r, photos) {
+			return
+		}
+		// Together en pair: geen aangewezen gebied, en in pair mode twee foto's met genoeg tijd ertussen (zie photos.go)
+		if !a.checkPhotoRegions(w, r, check, photos) {
+			return
+		}
+		photos, ok = a.checkPhotoPair(w, r, check, photos)
+		if !ok {
+			return
+		}
+
+		// Quota's vóór de model call
+		release, ok := a.quotas.reserve(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+
+		v, ok := a.judgePhotos(w, r, "silver", check, photos)
+		if !ok {
+			return
+		}
+		region, note, hints := inspectionHints(photos)
+		a.recordInspection(w, r, inspection{
+			Check:      check.ID,
+			Tier:       "silver",
+			Result:     v.Result,
+			Provider:   v.Provider,
+			Model:      v.Model,
+			Usage:      v.Usage,
+			Cached:     v.Cached,
+			Findings:   v.Findings, // oordeel per foto bij meer foto's
+			Region:     region,
+			Note:       note,
+			Hints:      hints,
+			Reason:     v.Reason, // alleen gevuld bij WRONG_SUBJECT of meer foto's
+			ReasonCode: v.ReasonCode,
+			Relevance:  v.Relevance,
+
+			ClassifierModel: v.ClassifierModel,
+			ClassifierUsage: v.classifierUsage(),
+		}, photos)
+		verdictsTotal.WithLabelValues(check.ID, "silver", v.Result).Inc()
+
+		// Stuur response terug
+		json.NewEncoder(w).Encode(QualityResponse{Result: v.Result, Cached: v.Cached, ReasonCode: v.ReasonCode, SuggestedCheck: v.SuggestedCheck})
+	}
+}
+
+// goldHandler geeft PASS/FAIL plus projectNumber en uitleg terug
+func (a *app) goldHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Controleer of het een POST request is
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "ONLY POST REQUESTS ARE ALLOWED")
+		return
+	}
+	if !a.cfg.Tiers.Gold.Enabled {
+		writeError(w, http.StatusNotFound, "Gold tier is not enabled")
+		return
+	}
+
+	// Parse URL path om projectNumber en endpoint te extraheren
+	path := strings.TrimPrefix(r.URL.Path, "/api/laundry/gold/v1/")
+	pathParts := strings.Split(path, "/")
+
+	if len(pathParts) != 2 {
+		writeError(w, http.StatusBadRequest, "Invalid URL format. Expected: /api/laundry/gold/v1/{projectNumber}/{endpoint}")
+		return
+	}
+
+	projectNumber := pathParts[0]
+	endpoint := pathParts[1]
+
+	// Valideer projectNumber
+	if !isValidProjectNumber(projectNumber) {
+		writeError(w, http.StatusBadRequest, "Invalid projectNumber. Only letters, numbers, underscores and hyphens allowed (max 50 chars)")
+		return
+	}
+
+	addLogAttrs(r.Context(), slog.String("projectNumber", projectNumber))
+
+	// Een stapel foto's zonder check: die zoekt classify zelf uit (zie classify.go)
+	if endpoint == classifyEndpoint {
+		a.classifyHandler(w, r, projectNumber)
+		return
+	}
+
+	// Controleer of endpoint geldig is
+	check, ok := findCheck(endpoint)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid endpoint. Valid endpoints: "+strings.Join(append(checkIDs(), classifyEndpoint), ", "))
+		return
+	}
+
+	photos, releasePhotos, ok := a.readPhotos(w, r, "gold", a.cfg.imageSettingsFor(check.ID), a.cfg.Upload.MaxPhotos, false)
+	if !ok {
+		return
+	}
+	defer releasePhotos()
+
+	// Zonder Content-Length pas nu op de foto's geclaimd (zie withIdempotency)
+	if !a.idempotency.claim(w, r, photosKey(photos)) {
+		return
+	}
+
+	// Bewerkt of een screenshot? Alleen weigeren als de tenant dat wil
+	if !a.checkPhotoRisk(w, r, photos) {
+		return
+	}
+	// Together en pair: geen aangewezen gebied, en in pair mode twee foto's met genoeg tijd ertussen (zie photos.go)
+	if !a.checkPhotoRegions(w, r, check, photos) {
+		return
+	}
+	photos, ok = a.checkPhotoPair(w, r, check, photos)
+	if !ok {
+		return
+	}
+
+	// Per foto tegen het project, daarna samen (zie mergeGoldSignals)
+	perPhoto := make([]goldSignals, len(photos))
+	for i, photo := range photos {
+		if perPhoto[i], ok = a.goldSignals(w, r, projectNumber, photo); !ok {
+			return
+		}
+	}
+	signals := mergeGoldSignals(perPhoto)
+	if len(signals.Flags) > 0 {
+		w.Header().Set("X-Inspection-Flags", strings.Join(signals.Flags, ","))
+		addLogAttrs(r.Context(), slog.Any("flags", signals.Flags))
+	}
+
+	// Quota's vóór de model call
+	release, ok := a.quotas.reserve(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	v, ok := a.judgePhotos(w, r, "gold", check, photos)
+	if !ok {
+		return
+	}
+
+	// Stuur Gold response terug
+	response, _ := a.recordGold(w, r, projectNumber, check.ID, photos, signals, v)
+	json.NewEncoder(w).Encode(response)
+}
+
+// goldSignals is wat we vóór de model call over een gold foto weten: de EXIF tegen het
+// project en eerdere inspecties met dezelfde foto
+type goldSignals struct {
+	Flags            []string
+	LocationVerified string
+	DistanceMeters   *float64
+	ReuseMatches     []reuseMatch
+}
+
+// goldSignals controleert de foto tegen het project. Bij false is de weigering (422) al verstuurd.
+func (a *app) goldSignals(w http.ResponseWriter, r *http.Request, projectNumber string, photo uploadedPhoto) (goldSignals, bool) {
+	// Opnametijd en GPS uit de EXIF tegen het afspraakvenster en de geofence van het project
+	proj, _ := a.projects.get(tenantFrom(r.Context()), projectNumber)
+	flags, ok := a.checkCaptureTime(w, r, proj, photo)
+	if !ok {
+		return goldSignals{}, false
+	}
+	location, distance, locationFlags := a.checkLocation(r, proj, photo)
+	flags = append(flags, locationFlags...)
+
+	// Dezelfde foto al eerder bij een ander project ingestuurd?
+	reuseMatches, reuseFlags := a.findReuse(r, projectNumber, photo)
+	flags = append(flags, reuseFlags...)
+
+	return goldSignals{Flags: flags, LocationVerified: location, DistanceMeters: distance, ReuseMatches: reuseMatches}, true
+}
+
+// recordGold slaat het oordeel over de gold foto('s) van een check op en maakt de response
+func (a *app) recordGold(w http.ResponseWriter, r *http.Request, projectNumber, checkID string, photos []uploadedPhoto, signals goldSignals, v verdict) (GoldResponse, inspection) {
+	region, note, hints := inspectionHints(photos)
+	recorded := a.recordInspection(w, r, inspection{
+		ProjectNumber:    projectNumber,
+		Check:            checkID,
+		Tier:             "gold",
+		Result:           v.Result,
+		Reason:           v.Reason,
+		Provider:         v.Provider,
+		Model:            v.Model,
+		Usage:            v.Usage,
+		Cached:           v.Cached,
+		Findings:         v.Findings,
+		Region:           region,
+		Note:             note,
+		Hints:            hints,
+		Flags:            signals.Flags,
+		LocationVerified: signals.LocationVerified,
+		DistanceMeters:   signals.DistanceMeters,
+		ReuseMatches:     signals.ReuseMatches,
+		ReasonCode:       v.ReasonCode,
+		Relevance:        v.Relevance,
+		Level:            v.LevelReport,
+		SubFindings:      v.SubFindings,
+		ClassifierModel:  v.ClassifierModel,
+		ClassifierUsage:  v.classifierUsage(),
+	}, photos)
+	verdictsTotal.WithLabelValues(checkLabel(checkID), "gold", v.Result).Inc()
+
+	return GoldResponse{
+		Result:           v.Result,
+		ProjectNumber:    projectNumber,
+		Reason:           v.Reason,
+		Provider:         v.Provider,
+		InspectionID:     recorded.ID,
+		Cached:           v.Cached,
+		Findings:         v.Findings,
+		Flags:            signals.Flags,
+		LocationVerified: signals.LocationVerified,
+		SuspectedReuse:   len(signals.ReuseMatches) > 0,
+		ReuseMatches:     signals.ReuseMatches,
+		Risk:             highestRisk(photos),
+		ReasonCode:       v.ReasonCode,
+		SuggestedCheck:   v.SuggestedCheck,
+		Level:            v.LevelReport,
+		SubFindings:      v.SubFindings,
+	}, recorded
+}
+
+// verdict is het oordeel over een foto, van het model of uit de cache
+type verdict struct {
+	Result   string
+	Reason   string // alleen gold
+	Provider string
+	Model    string
+	Usage    tokenUsage
+	Cached   bool
+	Findings []imageFinding // alleen bij uitsneden: het oordeel per beeld
+
+	ReasonCode     string     // WRONG_SUBJECT als de classificatie de foto afkeurde
+	SuggestedCheck string     // check waar de foto volgens de classificatie wel bewijs voor is (hint)
+	Relevance      *relevance // nil = geen classificatie gedaan
+
+	ClassifierModel string     // model van de classificatie; dat deel van Usage kost de prijs van dit model
+	ClassifierUsage tokenUsage // deel van Usage dat de classificatie kostte
+
+	Level       []levelReading // aflezing van de waterpas per foto (GoldExtra van applianceIsLevel)
+	LevelReport *levelReport   // de aflezingen naast de tolerantie (applyLevelReport), nil = geen
+	SubFindings []subFinding   // los beoordeelde onderdelen (GoldExtra van drainHoseInDrain)
+}
+
+// classifierUsage is ClassifierUsage voor de inspectie, nil = geen classificatie gedaan
+func (v verdict) classifierUsage() *tokenUsage {
+	if v.ClassifierModel == "" {
+		return nil
+	}
+	usage := v.ClassifierUsage
+	return &usage
+}
+
+// judge laat de foto beoordelen voor een check en tier. Een eerder oordeel over
+// dezelfde foto komt uit de cache. Bij een fout is de error response al verstuurd.
+func (a *app) judge(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photo uploadedPhoto) (verdict, bool) {
+	v, ok := a.judgeClassified(w, r, tier, check, photo, nil)
+	if !ok {
+		return verdict{}, false
+	}
+	return a.finishVerdict(r, a.applyLevelReport(check.ID, v)), true
+}
+
+// judgeClassified is judge voor een foto die al geclassificeerd is (zie classify.go); nil =
+// classificeren als relevance aan staat. Zonder finishVerdict: dat doet de caller.
+func (a *app) judgeClassified(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photo uploadedPhoto, known *classification) (verdict, bool) {
+	settings := photo.Settings
+	tenant := tenantFrom(r.Context())
+	cacheKey := resultCacheKey(tenant, tier, check, photo.Hash+"/"+settings.key()+photo.hintKey()+a.relevanceKey(tenant))
+	if v, ok := a.fromCache(w, tier, cacheKey); ok {
+		if known != nil {
+			// De classificatie is wel gedaan
+			v.Usage, v.ClassifierModel, v.ClassifierUsage = known.Usage, known.Model, known.Usage
+		}
+		return v, true
+	}
+
+	req, timeout := a.visionRequestFor(tier, check, photo)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Eerst (als de tenant dat wil): staat er een installatie op de foto? Zo niet, dan is de
+	// check zelf niet nodig. Hoort de foto bij een andere check, dan voeren we deze check toch
+	// uit en geven die andere check mee als hint (SuggestedCheck).
+	var v verdict
+	if known != nil {
+		relevanceResultsTotal.WithLabelValues(check.ID, "relevant").Inc()
+		v.Usage, v.Relevance = known.Usage, &known.relevance
+		v.ClassifierModel, v.ClassifierUsage = known.Model, known.Usage
+	} else if a.relevanceEnabled(tenant) {
+		classified, answer, err := a.classifyPhoto(ctx, photo)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			writeAnalysisError(w, r, err)
+			return verdict{}, false
+		case err != nil:
+			// Niet fataal: dan beoordelen we de foto gewoon
+			loggerFrom(r.Context()).Warn("relevance check failed, judging photo anyway", "error", err)
+			relevanceResultsTotal.WithLabelValues(check.ID, "error").Inc()
+		case !classified.Installation:
+			relevanceResultsTotal.WithLabelValues(check.ID, "off_topic").Inc()
+			w.Header().Set("X-Provider", answer.Provider)
+			v = verdict{
+				Result: "FAIL", Reason: classified.noCheckReason(), ReasonCode: codeWrongSubject,
+				Provider: answer.Provider, Model: answer.Model, Usage: answer.Usage, Relevance: &classified,
+				ClassifierModel: answer.Model, ClassifierUsage: answer.Usage,
+			}
+			a.cacheVerdict(r, cacheKey, v)
+			return v, true
+		default:
+			outcome := "relevant"
+			if classified.Check != "" && classified.Check != check.classID() {
+				outcome, v.SuggestedCheck = "wrong_check", classified.Check
+			}
+			relevanceResultsTotal.WithLabelValues(check.ID, outcome).Inc()
+			v.Usage, v.Relevance = answer.Usage, &classified
+			v.ClassifierModel, v.ClassifierUsage = answer.Model, answer.Usage
+		}
+	}
+
+	// Laat de foto (en eventuele uitsneden) beoordelen door het AI model (met retries bij tijdelijke fouten)
+	answers, err := a.analyzeWithTiles(ctx, req, photo)
+	if err != nil {
+		writeAnalysisError(w, r, err)
+		return verdict{}, false
+	}
+	overview := answers[0]
+	w.Header().Set("X-Provider", overview.Provider)
+
+	// Wat de voorbewerking bespaarde ten opzichte van het origineel op detail "high"
+	imageBytesSavedTotal.WithLabelValues(check.ID).Add(float64(max(photo.Size-photo.ModelBytes, 0)))
+	imageTokensSavedTotal.WithLabelValues(check.ID).Add(float64(max(photo.OriginalTokens-estimateImageTokens(photo.Width, photo.Height, photo.Detail), 0)))
+
+	v.Provider, v.Model = overview.Provider, overview.Model
+	findings := make([]imageFinding, len(answers))
+	for i, answer := range answers {
+		v.Usage.PromptTokens += answer.Usage.PromptTokens
+		v.Usage.CompletionTokens += answer.Usage.CompletionTokens
+
+		findings[i].Image = "overview"
+		width, height := photo.Width, photo.Height
+		if i > 0 {
+			tile := photo.Tiles[i-1]
+			findings[i].Image, width, height = tile.Label, tile.Width, tile.Height
+		}
+		v.Usage.ImageTokens += estimateImageTokens(width, height, photo.Detail)
+		if tier == "gold" {
+			findings[i].Result, findings[i].Reason = parseGoldResponse(answer.Content)
+		} else if strings.TrimSpace(answer.Content) == "PASS" {
+			findings[i].Result = "PASS"
+		} else {
+			findings[i].Result = "FAIL" // Default voor alles wat niet PASS is
+		}
+	}
+	v.Result, v.Reason = findings[0].Result, findings[0].Reason
+	if len(findings) > 1 {
+		v.Result, v.Reason = mergeFindings(settings.TileMerge, findings)
+		v.Findings = findings
+		tiledVerdictsTotal.WithLabelValues(check.ID, findings[0].Result, v.Result).Inc()
+	}
+	if tier == "gold" && check.GoldExtra != nil {
+		check.GoldExtra(overview.Content, a.cfg, &v)
+	}
+
+	a.cacheVerdict(r, cacheKey, v)
+	return v, true
+}
+
+// visionRequestFor is de vraag aan het model voor een check en tier, met de timeout van de tier
+func (a *app) visionRequestFor(tier string, check checkDefinition, photo uploadedPhoto) (visionRequest, time.Duration) {
+	req := visionRequest{
+		Check:        check.ID,
+		SystemPrompt: check.SilverPrompt,
+		UserText:     check.SilverUserText,
+		ImageURL:     photo.DataURL,
+		ImageDetail:  photo.Detail,
+	}
+	timeout := a.cfg.Tiers.Silver.AnalysisTimeout
+	if tier == "gold" {
+		req.SystemPrompt, req.UserText = check.GoldPrompt, goldUserText
+		timeout = a.cfg.Tiers.Gold.AnalysisTimeout
+	}
+	return req, time.Duration(timeout)
+}
+
+// fromCache geeft een eerder oordeel uit de cache (als die aan staat) en zet X-Cache en X-Provider
+func (a *app) fromCache(w http.ResponseWriter, tier, cacheKey string) (verdict, bool) {
+	if a.cache == nil {
+		return verdict{}, false
+	}
+	cached, ok := a.cache.get(cacheKey)
+	if !ok {
+		cacheLookupsTotal.WithLabelValues(tier, "miss").Inc()
+		w.Header().Set("X-Cache", "MISS")
+		return verdict{}, false
+	}
+	cacheLookupsTotal.WithLabelValues(tier, "hit").Inc()
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("X-Provider", cached.Provider)
+	return verdict{
+		Result: cached.Result, Reason: cached.Reason, Provider: cached.Provider, Model: cached.Model, Findings: cached.Findings, Cached: true,
+		ReasonCode: cached.ReasonCode, SuggestedCheck: cached.SuggestedCheck, Relevance: cached.Relevance, Level: cached.Level,
+		SubFindings: cached.SubFindings,
+	}, true
+}
+
+// cacheVerdict bewaart een oordeel van het model in de cache (als die aan staat)
+func (a *app) cacheVerdict(r *http.Request, cacheKey string, v verdict) {
+	if a.cache == nil {
+		return
+	}
+	cached := cachedVerdict{
+		Key: cacheKey, Result: v.Result, Reason: v.Reason, Provider: v.Provider, Model: v.Model, Findings: v.Findings,
+		ReasonCode: v.ReasonCode, SuggestedCheck: v.SuggestedCheck, Relevance: v.Relevance, Level: v.Level,
+		SubFindings: v.SubFindings,
+	}
+	if err := a.cache.put(cached); err != nil {
+		loggerFrom(r.Context()).Warn("could not store cached verdict", "error", err)
+	}
+}
+
+// finishVerdict zet het oordeel in de request log en de trace
+func (a *app) finishVerdict(r *http.Request, v verdict) verdict {
+	addLogAttrs(r.Context(), slog.String("verdict", v.Result), slog.String("provider", v.Provider), slog.Bool("cached", v.Cached))
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("apiq.verdict", v.Result), attribute.Bool("apiq.cached", v.Cached))
+	return v
+}
+
+// parseGoldResponse leest het AI antwoord (verwacht 2 regels: result en reason)
+func parseGoldResponse(aiResponse string) (result, reason string) {
+	lines := strings.Split(strings.TrimSpace(aiResponse), "\n")
+
+	if len(lines) >= 2 {
+		result = strings.TrimSpace(lines[0])
+		reason = strings.TrimSpace(lines[1])
+	} else if len(lines) == 1 {
+		// Fallback voor oude format
+		result = strings.TrimSpace(lines[0])
+		reason = "No detailed reason provided"
+	} else {
+		result = "FAIL"
+		reason = "Invalid AI response format"
+	}
+
+	// Normaliseer result naar PASS/FAIL
+	if strings.ToUpper(result) == "PASS" {
+		result = "PASS"
+	} else {
+		result = "FAIL"
+	}
+	return result, reason
+}
+
+// writeError stuurt een JSON foutmelding terug
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// Validatie functie voor projectNumber (letters, cijfers, underscore, hyphen)
+func isValidProjectNumber(projectNumber string) bool {
+	if projectNumber == "" || len(projectNumber) > 50 {
+		return false
+	}
+	// Regex: alleen letters, cijfers, underscore en hyphen
+	matched, _ := regexp.MatchString(`^[a-zA-Z0-9_-]+$`, projectNumber)
+	return matched
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ========================================
+// IDEMPOTENCY-KEY (veilige retries van mobiele clients)
+// ========================================
+
+// idempotentResponse is een opgeslagen antwoord voor een Idempotency-Key
+type idempotentResponse struct {
+	fingerprint string        // route + grootte, of route + foto hash + hints: zelfde key met andere foto/check = 422
+	done        chan struct{} // dicht zodra het eerste request klaar is
+	status      int
+	header      http.Header
+	body        []byte
+	expiresAt   time.Time
+}
+
+// idempotencyStore bewaart de antwoorden per tenant + key (in memory)
+type idempotencyStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, responses: make(map[string]*idempotentResponse), lastSweep: time.Now()}
+}
+
+type idempotencyKey struct{}
+
+// idempotentCall is de Idempotency-Key van deze request en, na claim, het antwoord dat we vullen
+type idempotentCall struct {
+	key      string
+	response *idempotentResponse
+}
+
+// withIdempotency leest de Idempotency-Key header en slaat het antwoord op als de key
+// geclaimd is. Met Content-Length claimen we meteen op route + grootte: een duplicaat krijgt
+// het antwoord dan zonder dat zijn foto's gelezen en voorbewerkt worden. Zonder (chunked)
+// claimt de handler na het lezen op de foto hash (zie claim). Zonder header verandert er niets.
+func (s *idempotencyStore) withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(key) > 255 {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key too long (max 255 characters)")
+			return
+		}
+
+		call := &idempotentCall{key: tenantFrom(r.Context()) + "\x00" + key}
+		recorder := &responseCapture{ResponseWriter: w}
+		completed := false
+		defer func() {
+			// Handler paniekte na claim: wachtende requests niet laten hangen
+			if call.response != nil && !completed {
+				s.abort(call)
+			}
+		}()
+		if r.ContentLength > 0 && !s.claimFingerprint(w, r, call, r.URL.Path+"\x00size:"+strconv.FormatInt(r.ContentLength, 10)) {
+			return
+		}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), idempotencyKey{}, call)))
+		completed = true
+
+		if call.response != nil {
+			s.finish(call, recorder)
+		}
+	}
+}
+
+// claim wordt door de handler aangeroepen zodra de foto gelezen is, voor requests zonder
+// Content-Length (de rest is al geclaimd door withIdempotency). Geeft false als het antwoord
+// al verstuurd is: een eerder antwoord opnieuw, of 422 bij een andere foto/check.
+func (s *idempotencyStore) claim(w http.ResponseWriter, r *http.Request, photoKey string) bool {
+	call, ok := r.Context().Value(idempotencyKey{}).(*idempotentCall)
+	if !ok || call.response != nil {
+		return true
+	}
+	return s.claimFingerprint(w, r, call, r.URL.Path+"\x00"+photoKey)
+}
+
+// claimFingerprint claimt de key voor deze request, of wacht op het antwoord van de eerste
+// request met dezelfde key en stuurt dat opnieuw. Bij false is het antwoord al verstuurd.
+func (s *idempotencyStore) claimFingerprint(w http.ResponseWriter, r *http.Request, call *idempotentCall, fingerprint string) bool {
+	for {
+		s.mu.Lock()
+		s.sweepLocked()
+		existing, ok := s.responses[call.key]
+		if ok && existing.expired(time.Now()) {
+			delete(s.responses, call.key)
+			ok = false
+		}
+		if !ok {
+			// Eerste request met deze key: wij voeren hem uit, de rest wacht
+			call.response = &idempotentResponse{fingerprint: fingerprint, done: make(chan struct{})}
+			s.responses[call.key] = call.response
+			s.mu.Unlock()
+			return true
+		}
+		s.mu.Unlock()
+
+		if existing.fingerprint != fingerprint {
+			addLogAttrs(r.Context(), slog.String("errorCode", "IDEMPOTENCY_KEY_REUSED"))
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Idempotency-Key was already used for a different photo or check",
+				"code":  "IDEMPOTENCY_KEY_REUSED",
+			})
+			return false
+		}
+
+		// Zelfde request loopt nog: wachten op het antwoord
+		select {
+		case <-existing.done:
+		case <-r.Context().Done():
+			writeError(w, http.StatusRequestTimeout, "Request cancelled while waiting for the original request")
+			return false
+		}
+
+		s.mu.Lock()
+		stored, ok := s.responses[call.key]
+		s.mu.Unlock()
+		if !ok || stored != existing {
+			continue // eerste poging mislukte tijdelijk (niet opgeslagen): opnieuw claimen
+		}
+
+		for name, values := range stored.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		addLogAttrs(r.Context(), slog.Bool("idempotentReplay", true))
+		w.WriteHeader(stored.status)
+		w.Write(stored.body)
+		return false
+	}
+}
+
+// finish bewaart het antwoord (standaard 24 uur). Tijdelijke fouten (429, 5xx) bewaren we
+// niet, zodat een retry met dezelfde key het gewoon opnieuw probeert.
+func (s *idempotencyStore) finish(call *idempotentCall, recorder *responseCapture) {
+	response := call.response
+	response.status = recorder.status
+	if response.status == 0 {
+		response.status = http.StatusOK
+	}
+	response.header = recorder.header
+	response.body = recorder.body.Bytes()
+	response.expiresAt = time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	if response.status == http.StatusTooManyRequests || response.status >= 500 {
+		delete(s.responses, call.key)
+	}
+	s.mu.Unlock()
+	close(response.done)
+}
+
+// abort haalt een claim weg zonder antwoord; wachtende requests claimen de key dan zelf opnieuw
+func (s *idempotencyStore) abort(call *idempotentCall) {
+	s.mu.Lock()
+	if s.responses[call.key] == call.response {
+		delete(s.responses, call.key)
+	}
+	s.mu.Unlock()
+	close(call.response.done)
+}
+
+// sweepLocked ruimt verlopen antwoorden op, hooguit één keer per minuut (s.mu moet vast zijn)
+func (s *idempotencyStore) sweepLocked() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, response := range s.responses {
+		if response.expired(now) {
+			delete(s.responses, key)
+		}
+	}
+}
+
+// expired is true als het antwoord klaar is en de TTL voorbij is (lopende requests verlopen niet)
+func (r *idempotentResponse) expired(now time.Time) bool {
+	select {
+	case <-r.done:
+		return now.After(r.expiresAt)
+	default:
+		return false
+	}
+}
+
+// responseCapture schrijft het antwoord door naar de client en houdt een kopie bij
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.status != 0 {
+		return
+	}
+	rc.status = status
+	rc.header = rc.ResponseWriter.Header().Clone()
+	rc.header.Del("X-Request-ID") // hoort bij deze request, niet bij de replay
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.WriteHeader(http.StatusOK)
+	}
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBody telt hoeveel bytes de handler van de body leest
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// gateProvider antwoordt PASS zodra release dicht is; started gaat dicht bij de eerste call
+type gateProvider struct {
+	started, release chan struct{}
+	calls            atomic.Int32
+}
+
+func (g *gateProvider) name() string { return "gate" }
+
+func (g *gateProvider) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	if g.calls.Add(1) == 1 {
+		close(g.started)
+	}
+	select {
+	case <-g.release:
+		return providerAnswer{Content: "PASS\nPlug in the socket", Model: "gate-model"}, nil
+	case <-ctx.Done():
+		return providerAnswer{}, ctx.Err()
+	}
+}
+
+// idempotentSend stuurt photo met Idempotency-Key naar url en geeft het antwoord en de gelezen bytes
+func idempotentSend(t *testing.T, handler http.Handler, url string, photo []byte, chunked bool) (*httptest.ResponseRecorder, int64) {
+	t.Helper()
+	req := photoRequest(t, url, photo)
+	req.Header.Set("Idempotency-Key", "upload-1")
+	if chunked {
+		req.ContentLength = -1
+	}
+	body := &countingBody{ReadCloser: req.Body}
+	req.Body = body
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, body.n.Load()
+}
+
+func TestIdempotencyWaiterRetriesAfterPanic(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+	claimed := make(chan struct{})
+	first := true
+	handler := store.withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		if !store.claim(w, r, "photo") {
+			return
+		}
+		if first {
+			first = false
+			close(claimed)
+			time.Sleep(20 * time.Millisecond) // de tweede request wacht nu op ons
+			panic("handler bug")
+		}
+		w.Write([]byte(`{"result":"PASS"}`))
+	})
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/laundry/gold/v1/powerCordInSocket", nil)
+		r.Header.Set("Idempotency-Key", "retry-1")
+		return r.WithContext(context.WithValue(r.Context(), tenantKey{}, "acme"))
+	}
+
+	go func() {
+		defer func() { recover() }()
+		handler(httptest.NewRecorder(), request())
+	}()
+	<-claimed
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler(rec, request())
+		done <- rec
+	}()
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"result":"PASS"}` {
+			t.Errorf("waiting request got %d %s, want its own PASS", rec.Code, rec.Body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting request hangs after the first handler panicked")
+	}
+}
+
+// Een duplicaat met dezelfde grootte krijgt het antwoord zonder dat zijn foto gelezen of
+// voorbewerkt wordt; een andere grootte meteen 422.
+func TestIdempotencyReplayDoesNotReadPhotos(t *testing.T) {
+	photo, other := testJPEG(t, 64, 48), testJPEG(t, 96, 72)
+	if len(photo) == len(other) {
+		t.Fatal("test photos have the same size")
+	}
+	tests := []struct {
+		url       string
+		wantCalls int // model calls van de eerste request
+	}{
+		{"/api/laundry/silver/v1/powerCordInSocket", 1},
+		{"/api/laundry/gold/v1/P1/powerCordInSocket", 1},
+		{"/api/laundry/gold/v1/P1/classify", 2}, // classificatie plus de gevonden check
+	}
+	for _, tt := range tests {
+		url := tt.url
+		t.Run(url, func(t *testing.T) {
+			checker := &fakeProvider{id: "checker", content: "PASS\nPlug in the socket"}
+			a := newTestApp(t, checker)
+			classifier := &scriptedProvider{id: "classifier", answers: []string{"INSTALLATION\npowerCordInSocket\nplug in a socket"}}
+			a.vision.chains[relevanceCheckID] = []visionProvider{classifier}
+			mux := http.NewServeMux()
+			a.registerRoutes(mux)
+
+			first, _ := idempotentSend(t, mux, url, photo, false)
+			if first.Code != http.StatusOK {
+				t.Fatalf("first: status = %d, body %s", first.Code, first.Body)
+			}
+
+			replay, read := idempotentSend(t, mux, url, photo, false)
+			if replay.Code != http.StatusOK || !bytes.Equal(replay.Body.Bytes(), first.Body.Bytes()) || replay.Header().Get("Idempotent-Replayed") != "true" {
+				t.Errorf("replay: %d %s, want the first answer replayed", replay.Code, replay.Body)
+			}
+			if read != 0 {
+				t.Errorf("replay read %d bytes of the photo, want none", read)
+			}
+
+			reused, read := idempotentSend(t, mux, url, other, false)
+			if reused.Code != http.StatusUnprocessableEntity || !strings.Contains(reused.Body.String(), "IDEMPOTENCY_KEY_REUSED") || read != 0 {
+				t.Errorf("other photo: %d %s after reading %d bytes, want 422 IDEMPOTENCY_KEY_REUSED without reading", reused.Code, reused.Body, read)
+			}
+			if calls := int(checker.calls.Load()) + len(classifier.seen); calls != tt.wantCalls {
+				t.Errorf("%d model calls, want %d of the first request only", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyDuplicateWaitsBeforeReading(t *testing.T) {
+	gate := &gateProvider{started: make(chan struct{}), release: make(chan struct{})}
+	a := newTestApp(t, gate)
+	mux := http.NewServeMux()
+	a.registerRoutes(mux)
+	url, photo := "/api/laundry/gold/v1/P1/powerCordInSocket", testJPEG(t, 64, 48)
+
+	firstDone := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec, _ := idempotentSend(t, mux, url, photo, false)
+		firstDone <- rec
+	}()
+	<-gate.started
+
+	type result struct {
+		rec  *httptest.ResponseRecorder
+		read int64
+	}
+	duplicateDone := make(chan result)
+	go func() {
+		rec, read := idempotentSend(t, mux, url, photo, false)
+		duplicateDone <- result{rec, read}
+	}()
+	select {
+	case <-duplicateDone:
+		t.Fatal("duplicate finished before the first request")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gate.release)
+
+	first := <-firstDone
+	duplicate := <-duplicateDone
+	if duplicate.rec.Code != http.StatusOK || !bytes.Equal(duplicate.rec.Body.Bytes(), first.Body.Bytes()) || duplicate.read != 0 {
+		t.Errorf("duplicate: %d %s after reading %d bytes, want the first answer without reading", duplicate.rec.Code, duplicate.rec.Body, duplicate.read)
+	}
+	if calls := gate.calls.Load(); calls != 1 {
+		t.Errorf("%d model calls, want 1", calls)
+	}
+}
+
+// Zonder Content-Length claimt de handler pas na het lezen, op de foto zelf
+func TestIdempotencyWithoutContentLength(t *testing.T) {
+	checker := &fakeProvider{id: "checker", content: "PASS\nPlug in the socket"}
+	a := newTestApp(t, checker)
+	mux := http.NewServeMux()
+	a.registerRoutes(mux)
+	url, photo := "/api/laundry/gold/v1/P1/powerCordInSocket", testJPEG(t, 64, 48)
+
+	first, _ := idempotentSend(t, mux, url, photo, true)
+	replay, _ := idempotentSend(t, mux, url, photo, true)
+	if first.Code != http.StatusOK || replay.Code != http.StatusOK || !bytes.Equal(replay.Body.Bytes(), first.Body.Bytes()) || replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay: %d %s, want the first answer %d %s", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if reused, _ := idempotentSend(t, mux, url, testJPEG(t, 48, 64), true); reused.Code != http.StatusUnprocessableEntity {
+		t.Errorf("other photo: status = %d, want 422", reused.Code)
+	}
+	if calls := checker.calls.Load(); calls != 1 {
+		t.Errorf("%d model calls, want 1", calls)
+	}
+}
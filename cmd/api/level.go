@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ========================================
+// WATERPAS AFLEZEN (applianceIsLevel, strengere gold variant)
+// ========================================
+
+// levelCheckID leest de bel van de waterpas af, waar levelIndicatorPresent alleen kijkt of er een ligt
+const levelCheckID = "applianceIsLevel"
+
+// Richtingen van de waterpas op het apparaat
+const (
+	levelAxisLeftRight = "left-right" // langs de voorkant
+	levelAxisFrontBack = "front-back" // langs de zijkant
+	levelAxisUnknown   = "unknown"
+)
+
+// levelReading is wat het model van één waterpas afleest
+type levelReading struct {
+	Photo           string   `json:"photo,omitempty"` // bij meer foto's, bijv. "photo 2"
+	Axis            string   `json:"axis"`            // left-right, front-back of unknown
+	BubbleOffset    *float64 `json:"bubbleOffset"`    // afstand van de bel tot het midden in bellengtes, null = niet af te lezen
+	WithinTolerance bool     `json:"withinTolerance"`
+}
+
+// levelReport staat in de gold response: per foto de aflezing en of het apparaat waterpas staat
+type levelReport struct {
+	Level     bool           `json:"level"`            // alle aflezingen binnen de tolerantie, bij meer foto's in beide richtingen
+	Tolerance float64        `json:"tolerance"`        // max bubbleOffset (LEVEL_TOLERANCE)
+	Reason    string         `json:"reason,omitempty"` // bijv. als meer foto's niet beide richtingen aflezen
+	Readings  []levelReading `json:"readings"`
+}
+
+// bothAxesReason is de uitleg als meer foto's niet samen beide richtingen aflezen
+const bothAxesReason = "Spirit level must be read both left-right and front-back"
+
+// readLevel leest de AXIS en OFFSET regels van het gold antwoord (GoldExtra van applianceIsLevel).
+// Hier telt levelReadingsTotal, zodat een oordeel uit de cache niet nog eens meetelt.
+func readLevel(content string, cfg config, v *verdict) {
+	reading := levelReading{Axis: levelAxisUnknown}
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(strings.Trim(strings.TrimSpace(value), "`\"'."))
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "AXIS":
+			if value == levelAxisLeftRight || value == levelAxisFrontBack {
+				reading.Axis = value
+			}
+		case "OFFSET":
+			// "0.2" of "0.2 bubble lengths"; een richting (-0.3) maakt voor de tolerantie niet uit
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				continue
+			}
+			if offset, err := strconv.ParseFloat(fields[0], 64); err == nil && !math.IsNaN(offset) && !math.IsInf(offset, 0) {
+				offset = math.Abs(offset)
+				reading.BubbleOffset = &offset
+			}
+		}
+	}
+	levelReadingsTotal.WithLabelValues(reading.Axis, reading.outcome(cfg.Level.Tolerance)).Inc()
+	v.Level = []levelReading{reading}
+}
+
+// outcome is within, outside of unreadable, zoals in levelReadingsTotal
+func (reading levelReading) outcome(tolerance float64) string {
+	switch {
+	case reading.BubbleOffset == nil:
+		return "unreadable"
+	case *reading.BubbleOffset > tolerance:
+		return "outside"
+	}
+	return "within"
+}
+
+// applyLevelReport zet het rapport op het oordeel, vóór finishVerdict: zo zien de log, de
+// trace, de inspectie en de response hetzelfde resultaat
+func (a *app) applyLevelReport(checkID string, v verdict) verdict {
+	v.LevelReport = a.levelReport(checkID, &v)
+	return v
+}
+
+// levelReport legt de aflezingen naast de tolerantie. Een bel buiten de tolerantie of een
+// onleesbare bel maakt een PASS van het model alsnog FAIL, net als meer foto's die niet samen
+// left-right en front-back aflezen. Nil = geen aflezingen (andere check, of de foto toonde
+// iets anders).
+func (a *app) levelReport(checkID string, v *verdict) *levelReport {
+	if checkID != levelCheckID || len(v.Level) == 0 {
+		return nil
+	}
+	tolerance := a.cfg.Level.Tolerance
+	report := &levelReport{Level: true, Tolerance: tolerance, Readings: make([]levelReading, len(v.Level))}
+
+	// Kopieën: de aflezingen en findings kunnen uit de cache komen
+	findings := append([]imageFinding(nil), v.Findings...)
+	axes := make(map[string]bool)
+	for i, reading := range v.Level {
+		reading.WithinTolerance = reading.outcome(tolerance) == "within"
+		report.Readings[i] = reading
+		axes[reading.Axis] = true
+		if reading.WithinTolerance {
+			continue
+		}
+		report.Level = false
+
+		reason := reading.failReason(tolerance)
+		for j := range findings {
+			if findings[j].Image == reading.Photo && findings[j].Result == "PASS" {
+				findings[j].Result, findings[j].Reason = "FAIL", reason
+			}
+		}
+		if v.Result == "PASS" {
+			if reading.Photo != "" {
+				reason = reading.Photo + ": " + reason
+			}
+			v.Result, v.Reason = "FAIL", reason
+		}
+	}
+	if len(v.Findings) > 0 {
+		v.Findings = findings
+	}
+
+	// Eén foto kan maar één richting laten zien; bij meer foto's moeten ze samen beide dekken
+	if len(v.Level) > 1 && !(axes[levelAxisLeftRight] && axes[levelAxisFrontBack]) {
+		report.Reason = bothAxesReason
+		if report.Level && v.Result == "PASS" {
+			v.Result, v.Reason = "FAIL", bothAxesReason
+		}
+		report.Level = false
+	}
+	return report
+}
+
+// failReason is de uitleg bij een aflezing buiten de tolerantie
+func (reading levelReading) failReason(tolerance float64) string {
+	if reading.BubbleOffset == nil {
+		return "Bubble of the spirit level is not readable"
+	}
+	axis := ""
+	if reading.Axis != levelAxisUnknown {
+		axis = " (" + reading.Axis + ")"
+	}
+	return fmt.Sprintf("Bubble is %.2g bubble lengths off-centre%s, max %.2g", *reading.BubbleOffset, axis, tolerance)
+}
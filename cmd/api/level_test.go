@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterValue leest de stand van een counter uit de registry, met de labels als naam/waarde
+// paren; 0 als de serie er (nog) niet is
+func counterValue(t *testing.T, name string, labels ...string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range family.GetMetric() {
+			values := make(map[string]string)
+			for _, pair := range m.GetLabel() {
+				values[pair.GetName()] = pair.GetValue()
+			}
+			for i := 0; i+1 < len(labels); i += 2 {
+				if values[labels[i]] != labels[i+1] {
+					continue series
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestLevelReportNeedsBothAxes(t *testing.T) {
+	a := newTestApp(t)
+	offset := 0.1
+	reading := func(photo, axis string) levelReading {
+		return levelReading{Photo: photo, Axis: axis, BubbleOffset: &offset}
+	}
+
+	tests := []struct {
+		name     string
+		readings []levelReading
+		level    bool
+	}{
+		{"one photo", []levelReading{reading("", levelAxisLeftRight)}, true},
+		{"both axes", []levelReading{reading("photo 1", levelAxisLeftRight), reading("photo 2", levelAxisFrontBack)}, true},
+		{"same axis twice", []levelReading{reading("photo 1", levelAxisLeftRight), reading("photo 2", levelAxisLeftRight)}, false},
+		{"unknown axis", []levelReading{reading("photo 1", levelAxisLeftRight), reading("photo 2", levelAxisUnknown)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := verdict{Result: "PASS", Level: tt.readings}
+			report := a.levelReport(levelCheckID, &v)
+			if report.Level != tt.level {
+				t.Fatalf("level = %v, want %v", report.Level, tt.level)
+			}
+			if tt.level {
+				if v.Result != "PASS" || report.Reason != "" {
+					t.Errorf("result %s, reason %q, want PASS without a reason", v.Result, report.Reason)
+				}
+				return
+			}
+			if v.Result != "FAIL" || v.Reason != bothAxesReason || report.Reason != bothAxesReason {
+				t.Errorf("result %s (%q), report reason %q, want FAIL because both axes are needed", v.Result, v.Reason, report.Reason)
+			}
+		})
+	}
+}
+
+func TestLevelReadingsCountedOnce(t *testing.T) {
+	a := newTestApp(t)
+	labels := []string{"axis", levelAxisFrontBack, "outcome", "outside"}
+	before := counterValue(t, "apiq_level_readings_total", labels...)
+
+	var v verdict
+	readLevel("PASS\nLooks level\nAXIS: front-back\nOFFSET: 0.9", a.cfg, &v)
+	// Het rapport draait ook voor een oordeel uit de cache en telt dus niet
+	a.levelReport(levelCheckID, &v)
+	a.levelReport(levelCheckID, &v)
+
+	if got := counterValue(t, "apiq_level_readings_total", labels...) - before; got != 1 {
+		t.Errorf("counted %v readings, want 1", got)
+	}
+}
+
+func TestLevelOutsideToleranceFailsEverywhere(t *testing.T) {
+	a := newTestApp(t, &fakeProvider{id: "checker", content: "PASS\nLooks level\nAXIS: front-back\nOFFSET: 0.9"})
+	var logs bytes.Buffer
+	handler := withRequestLogging(slog.New(slog.NewJSONHandler(&logs, nil)), http.HandlerFunc(a.goldHandler))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, photoRequest(t, "/api/laundry/gold/v1/P1/"+levelCheckID, testJPEG(t, 64, 48)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var response GoldResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "FAIL" || response.Level == nil || response.Level.Level {
+		t.Errorf("response %s with level %+v, want FAIL outside the tolerance", response.Result, response.Level)
+	}
+	recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+	if len(recorded) != 1 || recorded[0].Result != "FAIL" {
+		t.Errorf("recorded %+v, want one FAIL inspection", recorded)
+	}
+	// De request log krijgt het oordeel na het rapport, niet de PASS van het model
+	if !strings.Contains(logs.String(), `"verdict":"FAIL"`) {
+		t.Errorf("log %s does not say FAIL", logs.String())
+	}
+}
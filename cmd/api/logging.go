@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ========================================
+// STRUCTURED LOGGING (log/slog, JSON)
+// ========================================
+
+// newLogger maakt de JSON (of text) logger. Alle attributen gaan door redactAttr,
+// zodat foto data en API keys nooit in de logs terechtkomen.
+func newLogger(w io.Writer, cfg loggingConfig) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+var (
+	// OpenAI keys (sk-..., sk-proj-...) en Bearer tokens
+	secretPattern = regexp.MustCompile(`(sk-[A-Za-z0-9_-]{8,}|Bearer\s+[A-Za-z0-9._-]{8,})`)
+	// data URLs met base64 foto data
+	dataURLPattern = regexp.MustCompile(`data:[a-zA-Z0-9/+.-]*;base64,[A-Za-z0-9+/=]*`)
+	// lange base64 reeksen (ruwe foto data zonder data: prefix)
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9+/]{200,}={0,2}`)
+)
+
+// sensitiveKeys zijn attribuutnamen waarvan de waarde altijd verborgen wordt
+var sensitiveKeys = map[string]bool{
+	"apikey": true, "api_key": true, "openaiapikey": true, "authorization": true,
+	"token": true, "secret": true, "password": true,
+	"photo": true, "photobase64": true, "image": true, "imageurl": true,
+}
+
+// redactAttr verbergt secrets en foto data in log attributen. Groepen, LogValuers en andere
+// waarden (structs, maps, slices) gaan er ook doorheen, anders zou een key of foto in een
+// struct veld alsnog in de log komen.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			redacted[i] = redactAttr(nil, attr)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Any(a.Key, redactValue(a.Value.Any()))
+	}
+	return a
+}
+
+// redactValue geeft een willekeurige waarde terug zonder secrets: een error als tekst, de
+// rest via JSON, met dezelfde regels voor keys en teksten als redactAttr
+func redactValue(v any) any {
+	if err, ok := v.(error); ok {
+		return redactString(err.Error())
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return redactString(fmt.Sprintf("%+v", v))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return redactString(string(data))
+	}
+	return redactJSON(decoded)
+}
+
+// redactJSON verbergt gevoelige keys en teksten in een gedecodeerde JSON waarde
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case string:
+		return redactString(v)
+	case []any:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveKeys[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redactJSON(value)
+			}
+		}
+	}
+	return v
+}
+
+// redactString haalt API keys en base64 data uit een tekst
+func redactString(s string) string {
+	s = dataURLPattern.ReplaceAllString(s, "data:[REDACTED]")
+	s = base64Pattern.ReplaceAllString(s, "[REDACTED BASE64]")
+	return secretPattern.ReplaceAllString(s, "[REDACTED]")
+}
+
+// ========================================
+// REQUEST ID + REQUEST LOG
+// ========================================
+
+type requestLogKey struct{}
+
+// requestLog verzamelt tijdens een request velden (check, verdict, ...) voor de eindregel
+type requestLog struct {
+	id     string
+	logger *slog.Logger
+	mu     sync.Mutex
+	attrs  []slog.Attr
+}
+
+// requestIDPattern beperkt wat we van een client als X-Request-ID accepteren
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID geeft het request id uit de context (leeg buiten een request)
+func requestID(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.id
+	}
+	return ""
+}
+
+// loggerFrom geeft een logger met het request id van deze request
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// addLogAttrs voegt velden toe aan de logregel die aan het einde van de request geschreven wordt
+func addLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		rl.attrs = append(rl.attrs, attrs...)
+		rl.mu.Unlock()
+	}
+}
+
+// withRequestLogging geeft elke request een id (X-Request-ID) en schrijft na afloop één logregel
+func withRequestLogging(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		rl := &requestLog{id: id, logger: logger.With(slog.String("requestId", id))}
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		route, check, tier := routeLabels(r.URL.Path)
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.Int("status", recorder.status),
+			slog.Int64("latencyMs", time.Since(started).Milliseconds()),
+		}
+		if check != "" {
+			attrs = append(attrs, slog.String("check", check), slog.String("tier", tier))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			attrs = append(attrs, slog.String("traceId", spanContext.TraceID().String()))
+		}
+		rl.mu.Lock()
+		attrs = append(attrs, rl.attrs...)
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		switch {
+		case recorder.status >= 500:
+			level = slog.LevelError
+		case recorder.status >= 400:
+			level = slog.LevelWarn
+		}
+		// Health checks en metrics scrapes alleen op debug niveau
+		if route == "/healthz" || route == "/readyz" || route == "/metrics" {
+			level = slog.LevelDebug
+		}
+
+		rl.logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testSecret  = "sk-proj-abcdefghijklmnop1234"
+	testDataURL = "data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD"
+	testPlain   = "hunter2" // geen patroon: alleen de key verraadt dat het een secret is
+)
+
+// secretValuer is een LogValuer die een groep met secrets oplevert
+type secretValuer struct{}
+
+func (secretValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("url", testDataURL), slog.String("apiKey", testPlain))
+}
+
+// leakyRequest heeft secrets in struct velden, zoals een request aan de provider
+type leakyRequest struct {
+	Check    string            `json:"check"`
+	ImageURL string            `json:"imageUrl"`
+	Header   map[string]string `json:"header"`
+	Notes    []string          `json:"notes"`
+}
+
+func TestLoggerRedactsEveryAttrKind(t *testing.T) {
+	attrs := []slog.Attr{
+		slog.String("note", "key "+testSecret+" and photo "+testDataURL),
+		slog.String("apiKey", testPlain),
+		slog.Any("error", errors.New("upstream said: "+testSecret)),
+		slog.Any("request", leakyRequest{Check: "powerCordInSocket", ImageURL: testDataURL, Header: map[string]string{"Authorization": testPlain}, Notes: []string{testSecret}}),
+		slog.Any("pointer", &leakyRequest{ImageURL: testDataURL}),
+		slog.Any("header", map[string]any{"token": testPlain, "nested": map[string]string{"password": testPlain, "text": testSecret}}),
+		slog.Any("urls", []string{testDataURL, "Bearer " + testSecret}),
+		slog.Group("upstream", slog.String("body", testSecret), slog.Group("deeper", slog.String("secret", testPlain), slog.String("image_data", testDataURL))),
+		slog.Any("valuer", secretValuer{}),
+		slog.Any("channel", make(chan string)), // geen JSON: valt terug op tekst
+	}
+
+	for _, format := range []string{"json", "text"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newLogger(&buf, loggingConfig{Level: "debug", Format: format})
+			logger.LogAttrs(context.Background(), slog.LevelInfo, "attrs", attrs...)
+			slog.New(logger.Handler().WithAttrs(attrs)).Info("with")
+			logger.WithGroup("group").Info("in group", "note", testSecret, "password", testPlain)
+			logger.Info("args", "provider", secretValuer{}, "req", leakyRequest{ImageURL: testDataURL})
+
+			out := buf.String()
+			for _, leak := range []string{testSecret, testDataURL, "base64,/9j", testPlain} {
+				if strings.Contains(out, leak) {
+					t.Errorf("log contains %q:\n%s", leak, out)
+				}
+			}
+			// Het gewone deel blijft leesbaar
+			if !strings.Contains(out, "powerCordInSocket") || !strings.Contains(out, "[REDACTED]") {
+				t.Errorf("log lost the safe values or has no redaction marker:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		sent string
+		keep bool
+	}{
+		{"valid", "req-123.abc:XYZ_9", true},
+		{"none", "", false},
+		{"spaces", "req 123", false},
+		{"newline", "req\nfake=entry", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var seen string
+			handler := withRequestLogging(newLogger(&buf, loggingConfig{Level: "info"}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestID(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/usage/v1", nil)
+			if tt.sent != "" {
+				req.Header.Set("X-Request-ID", tt.sent)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get("X-Request-ID")
+			if id != seen || !requestIDPattern.MatchString(id) {
+				t.Fatalf("X-Request-ID %q, in context %q, want the same valid id", id, seen)
+			}
+			if tt.keep != (id == tt.sent) {
+				t.Errorf("X-Request-ID = %q for %q, want kept %v", id, tt.sent, tt.keep)
+			}
+			if !strings.Contains(buf.String(), `"requestId":"`+id+`"`) {
+				t.Errorf("log line without request id %q: %s", id, buf.String())
+			}
+			if !tt.keep && tt.sent != "" && strings.Contains(buf.String(), tt.sent) {
+				t.Errorf("rejected request id %q reached the log", tt.sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ========================================
+// PROMETHEUS METRICS (GET /metrics)
+// ========================================
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_http_requests_total",
+		Help: "HTTP requests by route, check, tier and status code.",
+	}, []string{"route", "check", "tier", "status"})
+
+	verdictsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_verdicts_total",
+		Help: "Inspection verdicts (PASS/FAIL) by check and tier.",
+	}, []string{"check", "tier", "result"})
+
+	providerLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "apiq_provider_request_duration_seconds",
+		Help:    "Duration of a single call to an AI provider.",
+		Buckets: []float64{0.5, 1, 2, 3, 5, 8, 13, 20, 30, 60},
+	}, []string{"provider", "check", "outcome"})
+
+	providerTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_provider_tokens_total",
+		Help: "Tokens used at the AI provider by type (prompt/completion).",
+	}, []string{"provider", "check", "type"})
+
+	providerRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_provider_retries_total",
+		Help: "Retries of AI provider calls by error code.",
+	}, []string{"provider", "code"})
+
+	breakerRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_circuit_breaker_rejections_total",
+		Help: "Calls rejected because the provider circuit breaker was open.",
+	}, []string{"provider"})
+
+	photoSizeBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "apiq_photo_size_bytes",
+		Help:    "Size of uploaded photos.",
+		Buckets: prometheus.ExponentialBuckets(64<<10, 2, 9), // 64 KB .. 16 MB
+	}, []string{"tier"})
+
+	analysesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apiq_analyses_in_flight",
+		Help: "AI analyses currently running.",
+	})
+
+	uploadBytesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apiq_upload_bytes_in_flight",
+		Help: "Memory reserved for photo uploads currently being processed.",
+	})
+
+	imageBytesSavedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_image_bytes_saved_total",
+		Help: "Bytes not sent to the AI provider thanks to downscaling and re-encoding.",
+	}, []string{"check"})
+
+	imageTokensSavedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_image_tokens_saved_total",
+		Help: "Estimated image tokens saved by preprocessing and the detail level, compared to the original photo at detail high.",
+	}, []string{"check"})
+
+	tiledVerdictsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_tiled_verdicts_total",
+		Help: "Verdicts judged on the whole photo plus crops, by the overview result and the merged result.",
+	}, []string{"check", "overview", "result"})
+
+	captureWindowChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_capture_window_checks_total",
+		Help: "Gold photos checked against the appointment window of their project, by result (inside/outside/unknown).",
+	}, []string{"result"})
+
+	relevanceResultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_relevance_results_total",
+		Help: "Relevance pre-classifications by check and result (relevant/wrong_check/off_topic/error).",
+	}, []string{"check", "result"})
+
+	multiPhotoVerdictsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_multi_photo_verdicts_total",
+		Help: "Verdicts on more than one photo for the same check, by mode (individual/together) and merged result.",
+	}, []string{"check", "mode", "result"})
+
+	photoPairChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_photo_pair_checks_total",
+		Help: "Photo pairs checked for pair mode, by check and result (ok or the rejection code).",
+	}, []string{"check", "result"})
+
+	levelReadingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_level_readings_total",
+		Help: "Spirit level readings of applianceIsLevel, by axis and outcome (within, outside or unreadable).",
+	}, []string{"axis", "outcome"})
+
+	subFindingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_sub_findings_total",
+		Help: "Sub-findings judged next to a check (e.g. drain hose damage), by check, code and result (PASS, FAIL or UNKNOWN).",
+	}, []string{"check", "code", "result"})
+
+	classifiedPhotosTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_classified_photos_total",
+		Help: "Photos sent to the classify endpoint, by the check they were matched to (none = no check).",
+	}, []string{"check"})
+
+	photoRiskSignalsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_photo_risk_signals_total",
+		Help: "Tampering and screenshot signals found in uploaded photos, by signal.",
+	}, []string{"signal"})
+
+	reuseChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_reuse_checks_total",
+		Help: "Gold photos compared with earlier photos of other projects, by result (unique/suspected).",
+	}, []string{"result"})
+
+	geofenceChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_geofence_checks_total",
+		Help: "Gold photos checked against the geofence of their project, by result (inside/outside/unknown).",
+	}, []string{"result"})
+
+	cacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_cache_lookups_total",
+		Help: "Result cache lookups by tier and result (hit/miss).",
+	}, []string{"tier", "result"})
+
+	quotaRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apiq_quota_rejections_total",
+		Help: "Requests rejected because a tenant exceeded its monthly quota or budget.",
+	}, []string{"tenant", "code"})
+)
+
+// registerBreakerMetrics maakt per provider een gauge met de breaker status (0=closed, 1=open, 2=half-open)
+func registerBreakerMetrics(vr *visionRouter) {
+	seen := make(map[string]bool)
+	for _, chain := range append([][]visionProvider{vr.defaultChain}, chainsOf(vr)...) {
+		for _, p := range chain {
+			client, ok := p.(*visionClient)
+			if !ok || seen[client.name()] {
+				continue
+			}
+			seen[client.name()] = true
+			promauto.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "apiq_circuit_breaker_state",
+				Help:        "Circuit breaker state per provider (0=closed, 1=open, 2=half-open).",
+				ConstLabels: prometheus.Labels{"provider": client.name()},
+			}, func() float64 { return float64(client.breaker.currentState()) })
+		}
+	}
+}
+
+func chainsOf(vr *visionRouter) [][]visionProvider {
+	var chains [][]visionProvider
+	for _, chain := range vr.chains {
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// registerMetricsRoute voegt GET /metrics toe
+func registerMetricsRoute(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// routeLabels haalt route, check en tier uit het pad zonder projectNumber (beperkt het aantal series)
+func routeLabels(path string) (route, check, tier string) {
+	switch {
+	case strings.HasPrefix(path, "/api/laundry/silver/v1/"):
+		check = strings.TrimPrefix(path, "/api/laundry/silver/v1/")
+		route, tier = "/api/laundry/silver/v1/{check}", "silver"
+	case strings.HasPrefix(path, "/api/laundry/gold/v1/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/api/laundry/gold/v1/"), "/")
+		check = parts[len(parts)-1]
+		if check == classifyEndpoint {
+			return "/api/laundry/gold/v1/{projectNumber}/classify", "", "gold"
+		}
+		route, tier = "/api/laundry/gold/v1/{projectNumber}/{check}", "gold"
+	case path == "/metrics" || path == "/healthz" || path == "/readyz" || path == "/api/usage/v1":
+		return path, "", ""
+	case strings.HasPrefix(path, "/api/admin/v1/quotas/"):
+		return "/api/admin/v1/quotas/{tenant}", "", ""
+	case strings.HasPrefix(path, "/api/projects/v1/"):
+		return "/api/projects/v1/{projectNumber}", "", ""
+	default:
+		return "other", "", ""
+	}
+
+	if _, ok := findCheck(check); !ok {
+		check = "unknown"
+	}
+	return route, check, tier
+}
+
+// checkLabel is de waarde voor een check label: alleen ids uit laundryChecks en de classificatie.
+// Al het andere (een antwoord van het model, een onbekend pad) wordt "unknown", zodat er geen
+// nieuwe series bij kunnen komen.
+func checkLabel(id string) string {
+	if _, ok := findCheck(id); ok || id == relevanceCheckID {
+		return id
+	}
+	return "unknown"
+}
+
+// statusRecorder onthoudt de status code die een handler terugstuurt
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// withMetrics telt alle requests per route/check/tier/status
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route, check, tier := routeLabels(r.URL.Path)
+		httpRequestsTotal.WithLabelValues(route, check, tier, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+// observeProviderCall legt duur en uitkomst van één provider call vast
+func observeProviderCall(provider, check string, started time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = classifyUpstreamError(err).Code
+	}
+	providerLatency.WithLabelValues(provider, checkLabel(check), outcome).Observe(time.Since(started).Seconds())
+}
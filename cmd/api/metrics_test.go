@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsTestServer is de router zoals main hem opzet (zonder breaker gauges: die registreren
+// per provider naam maar één keer). De classificatie geeft een check die niet bestaat.
+func metricsTestServer(t *testing.T) (*app, http.Handler) {
+	t.Helper()
+	a := newTestApp(t, testClient("metrics", upstream(t, completion)))
+	a.vision.chains[relevanceCheckID] = []visionProvider{&scriptedProvider{id: "classifier", answers: []string{
+		"INSTALLATION\npowerCordInSocket\nplug in a socket",
+		"INSTALLATION\ndishwasherHack_1234\nsomething made up",
+		"INSTALLATION\ndishwasherHack_5678\nsomething made up",
+	}}}
+	a.cfg.Relevance.Enabled = true
+
+	mux := http.NewServeMux()
+	a.registerRoutes(mux)
+	registerMetricsRoute(mux)
+	return a, withMetrics(mux)
+}
+
+// labelNames geeft per metric family de namen van de labels van de eerste series
+func labelNames(t *testing.T) map[string][]string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string][]string)
+	for _, family := range families {
+		if len(family.GetMetric()) == 0 {
+			continue
+		}
+		labels := []string{}
+		for _, pair := range family.GetMetric()[0].GetLabel() {
+			labels = append(labels, pair.GetName())
+		}
+		names[family.GetName()] = labels
+	}
+	return names
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	_, handler := metricsTestServer(t)
+	for _, url := range []string{"/api/laundry/silver/v1/powerCordInSocket", "/api/laundry/gold/v1/P1/powerCordInSocket"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, photoRequest(t, url, testJPEG(t, 64, 48)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", url, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics: status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+
+	names := labelNames(t)
+	tests := []struct {
+		family string
+		kind   string
+		labels []string
+	}{
+		{"apiq_http_requests_total", "counter", []string{"check", "route", "status", "tier"}},
+		{"apiq_verdicts_total", "counter", []string{"check", "result", "tier"}},
+		{"apiq_provider_request_duration_seconds", "histogram", []string{"check", "outcome", "provider"}},
+		{"apiq_provider_tokens_total", "counter", []string{"check", "provider", "type"}},
+		{"apiq_relevance_results_total", "counter", []string{"check", "result"}},
+		{"apiq_photo_size_bytes", "histogram", []string{"tier"}},
+		{"apiq_image_bytes_saved_total", "counter", []string{"check"}},
+		{"apiq_image_tokens_saved_total", "counter", []string{"check"}},
+		{"apiq_analyses_in_flight", "gauge", []string{}},
+		{"apiq_upload_bytes_in_flight", "gauge", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			if !strings.Contains(body, "# TYPE "+tt.family+" "+tt.kind+"\n") {
+				t.Errorf("/metrics has no %s %s", tt.kind, tt.family)
+			}
+			if got, ok := names[tt.family]; !ok || !slices.Equal(got, tt.labels) {
+				t.Errorf("labels %v, want %v", got, tt.labels)
+			}
+		})
+	}
+
+	// Route labels zonder projectNumber
+	if !strings.Contains(body, `apiq_http_requests_total{check="powerCordInSocket",route="/api/laundry/gold/v1/{projectNumber}/{check}",status="200",tier="gold"}`) {
+		t.Error("/metrics has no gold request series without the project number")
+	}
+	if strings.Contains(body, "P1") {
+		t.Error("/metrics contains a project number")
+	}
+}
+
+func TestCheckLabel(t *testing.T) {
+	for _, id := range append(checkIDs(), relevanceCheckID) {
+		if got := checkLabel(id); got != id {
+			t.Errorf("checkLabel(%q) = %q", id, got)
+		}
+	}
+	for _, id := range []string{"", "unknown", "PowerCordInSocket", "dishwasherHack", "powerCordInSocket/../x", classifyEndpoint} {
+		if got := checkLabel(id); got != "unknown" {
+			t.Errorf("checkLabel(%q) = %q, want unknown", id, got)
+		}
+	}
+}
+
+// Een check label komt alleen uit laundryChecks: wat het model of de client verzint, maakt geen
+// nieuwe series (anders groeit /metrics zonder grens).
+func TestMetricsCheckLabelsAreBounded(t *testing.T) {
+	_, handler := metricsTestServer(t)
+
+	requests := []*http.Request{
+		photoRequest(t, "/api/laundry/gold/v1/P1/powerCordInSocket", testJPEG(t, 64, 48)),
+		// De classificatie noemt een check die niet bestaat
+		photoRequest(t, "/api/laundry/gold/v1/P1/drainHoseInDrain", testJPEG(t, 48, 64)),
+		photoRequest(t, "/api/laundry/gold/v1/P1/classify", testJPEG(t, 40, 40)),
+		// Een pad met een verzonnen check
+		photoRequest(t, "/api/laundry/gold/v1/P1/dishwasherHack_9012", testJPEG(t, 64, 48)),
+	}
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// Een provider call voor een check die niet bestaat
+	client := testClient("metrics-direct", upstream(t, completion))
+	if _, err := client.analyze(context.Background(), visionRequest{Check: "dishwasherHack_3456", UserText: "x", ImageURL: "data:image/jpeg;base64,AA=="}); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := append(checkIDs(), relevanceCheckID, "none", "unknown", "")
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "apiq_") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetName() == "check" && !slices.Contains(allowed, pair.GetValue()) {
+					t.Errorf("%s has check label %q", family.GetName(), pair.GetValue())
+				}
+				if strings.Contains(pair.GetValue(), "dishwasherHack") {
+					t.Errorf("%s has label %s=%q", family.GetName(), pair.GetName(), pair.GetValue())
+				}
+			}
+		}
+	}
+}
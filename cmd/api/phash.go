@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ========================================
+// HERGEBRUIKTE FOTO'S (dezelfde foto bij meerdere projecten)
+// ========================================
+
+// flagSuspectedReuse: een (bijna) gelijke foto is al eerder bij een ander project ingestuurd
+const flagSuspectedReuse = "SUSPECTED_REUSE"
+
+// maxReuseMatches: meer verwijzingen in de response helpen niemand
+const maxReuseMatches = 10
+
+// reuseMatch verwijst naar een eerdere inspectie met een (bijna) gelijke foto
+type reuseMatch struct {
+	InspectionID  string    `json:"inspectionId"`
+	ProjectNumber string    `json:"projectNumber"`
+	Check         string    `json:"check"`
+	Distance      int       `json:"distance"` // Hamming afstand tussen de hashes (0 = zelfde beeld)
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// perceptualHash is een dHash van 64 bits: de foto rechtop, verkleind naar 9x8 grijswaarden,
+// en per pixel of hij lichter is dan zijn rechterbuur. Opnieuw opslaan, verkleinen of een
+// andere EXIF verandert de hash niet of nauwelijks (in tegenstelling tot photoHash).
+func perceptualHash(photo decodedPhoto) uint64 {
+	// Eerst klein (goedkoop draaien), dan naar 9x8
+	small := resizeBox(orient(resizeBox(photo.img, 32, 32), photo.orientation), 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if luminance(small, x, y) > luminance(small, x+1, y) {
+				hash |= 1 << (y*8 + x)
+			}
+		}
+	}
+	return hash
+}
+
+// luminance is de helderheid van een pixel (ITU-R BT.601)
+func luminance(img *image.RGBA, x, y int) uint32 {
+	i := img.PixOffset(x, y)
+	return (299*uint32(img.Pix[i]) + 587*uint32(img.Pix[i+1]) + 114*uint32(img.Pix[i+2])) / 1000
+}
+
+// formatPHash en parsePHash: zo staat de hash bij de inspectie (16 hex tekens)
+func formatPHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+func parsePHash(value string) (uint64, bool) {
+	hash, err := strconv.ParseUint(value, 16, 64)
+	return hash, err == nil && len(value) == 16
+}
+
+// findReuse zoekt eerdere gold inspecties van de tenant bij andere projecten met een foto op
+// maximaal reuse.maxDistance bits afstand. Nieuwste eerst, maximaal maxReuseMatches. Alleen de
+// inspecties die de store in memory heeft (storage.maxRecentInspections per tenant), niet het hele bestand.
+func (a *app) findReuse(r *http.Request, projectNumber string, photo uploadedPhoto) (matches []reuseMatch, flags []string) {
+	if !a.cfg.Reuse.Enabled || photo.PHash == "" {
+		return nil, nil
+	}
+	hash, _ := parsePHash(photo.PHash)
+	tenant := tenantFrom(r.Context())
+
+	for _, in := range a.inspections.query(tenant, func(in inspection) bool {
+		return in.ProjectNumber != "" && in.ProjectNumber != projectNumber && (in.PHash != "" || len(in.PHashes) > 0)
+	}) {
+		// Bij meer foto's in één inspectie telt de dichtstbijzijnde
+		best := -1
+		for _, value := range append([]string{in.PHash}, in.PHashes...) {
+			other, ok := parsePHash(value)
+			if !ok {
+				continue
+			}
+			if distance := bits.OnesCount64(hash ^ other); best < 0 || distance < best {
+				best = distance
+			}
+		}
+		if best >= 0 && best <= a.cfg.Reuse.MaxDistance {
+			matches = append(matches, reuseMatch{InspectionID: in.ID, ProjectNumber: in.ProjectNumber, Check: in.Check, Distance: best, CreatedAt: in.CreatedAt})
+		}
+	}
+	if len(matches) == 0 {
+		reuseChecksTotal.WithLabelValues("unique").Inc()
+		return nil, nil
+	}
+
+	// query geeft de volgorde van opslaan, dus de laatste matches zijn de nieuwste
+	slices.Reverse(matches)
+	if len(matches) > maxReuseMatches {
+		matches = matches[:maxReuseMatches]
+	}
+	reuseChecksTotal.WithLabelValues("suspected").Inc()
+	addLogAttrs(r.Context(), slog.String("reusedFrom", matches[0].InspectionID))
+	return matches, []string{flagSuspectedReuse}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/bits"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// scene is een foto met structuur: vlakken van 40 px in willekeurige kleuren (vaste seed)
+func scene(seed int64) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for by := 0; by < 480; by += 40 {
+		for bx := 0; bx < 640; bx += 40 {
+			c := color.RGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255}
+			for y := by; y < by+40; y++ {
+				for x := bx; x < bx+40; x++ {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// hashOf slaat img op als JPEG van quality, decodeert hem weer en geeft de perceptuele hash
+func hashOf(t *testing.T, img image.Image, quality, orientation int) uint64 {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	photo, err := decodePhoto(&buf, orientation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return perceptualHash(photo)
+}
+
+func TestPerceptualHashStability(t *testing.T) {
+	original := scene(1)
+	hash := hashOf(t, original, 95, 1)
+	if hash == 0 || hash == ^uint64(0) {
+		t.Fatalf("hash %016x of a photo with structure has no information", hash)
+	}
+
+	tests := []struct {
+		name        string
+		img         image.Image
+		quality     int
+		orientation int
+		maxDistance int
+	}{
+		{"same photo", original, 95, 1, 0},
+		{"re-encoded at low quality", original, 30, 1, 2},
+		{"downscaled to half", resizeBox(original, 320, 240), 85, 1, 2},
+		{"downscaled and re-encoded", resizeBox(original, 160, 120), 40, 1, 3},
+		// Gedraaid opgeslagen met de EXIF orientation die hem weer rechtop zet
+		{"stored rotated with orientation 6", orient(original, 8), 95, 6, 2},
+		{"stored rotated with orientation 3", orient(original, 3), 95, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := bits.OnesCount64(hash ^ hashOf(t, tt.img, tt.quality, tt.orientation)); d > tt.maxDistance {
+				t.Errorf("distance %d to the original, want at most %d", d, tt.maxDistance)
+			}
+		})
+	}
+
+	// Een andere foto ligt ver buiten de standaard drempel (reuse.maxDistance 6)
+	for seed := int64(2); seed <= 6; seed++ {
+		if d := bits.OnesCount64(hash ^ hashOf(t, scene(seed), 95, 1)); d <= 16 {
+			t.Errorf("scene %d: distance %d to another photo, want more than 16", seed, d)
+		}
+	}
+}
+
+func TestPHashFormat(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0xdeadbeefcafe0042, ^uint64(0)} {
+		value := formatPHash(hash)
+		if got, ok := parsePHash(value); !ok || got != hash || len(value) != 16 {
+			t.Errorf("%016x: formatted %q, parsed %016x %v", hash, value, got, ok)
+		}
+	}
+	for _, value := range []string{"", "abc", "00000000000000000", "zzzzzzzzzzzzzzzz", "+000000000000001"} {
+		if _, ok := parsePHash(value); ok {
+			t.Errorf("parsePHash(%q) accepted", value)
+		}
+	}
+}
+
+func TestFindReuse(t *testing.T) {
+	const hash = 0x0f0f0f0f0f0f0f0f
+	// flip zet de laagste n bits om: een hash op n bits afstand
+	flip := func(n int) string { return formatPHash(hash ^ (1<<n - 1)) }
+	started := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		stored      []inspection // oudste eerst, zonder tenant = de standaard tenant
+		disabled    bool
+		wantMatches []string // inspectie ids, nieuwste eerst
+	}{
+		{"exact copy", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: flip(0)}}, false, []string{"i1"}},
+		{"on the threshold", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: flip(6)}}, false, []string{"i1"}},
+		{"over the threshold", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: flip(7)}}, false, nil},
+		{"same project", []inspection{{ID: "i1", ProjectNumber: "P1", PHash: flip(0)}}, false, nil},
+		{"silver without project", []inspection{{ID: "i1", PHash: flip(0)}}, false, nil},
+		{"other tenant", []inspection{{ID: "i1", Tenant: "other", ProjectNumber: "P2", PHash: flip(0)}}, false, nil},
+		{"unreadable hash", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: "not-a-hash"}}, false, nil},
+		// Bij meer foto's telt de dichtstbijzijnde
+		{"one of more photos", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: flip(12), PHashes: []string{flip(12), flip(3)}}}, false, []string{"i1"}},
+		{"newest first", []inspection{
+			{ID: "old", ProjectNumber: "P2", PHash: flip(1)},
+			{ID: "other photo", ProjectNumber: "P3", PHash: flip(20)},
+			{ID: "middle", ProjectNumber: "P3", PHash: flip(0)},
+			{ID: "new", ProjectNumber: "P4", PHash: flip(5)},
+		}, false, []string{"new", "middle", "old"}},
+		{"disabled", []inspection{{ID: "i1", ProjectNumber: "P2", PHash: flip(0)}}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			a.cfg.Reuse.Enabled, a.cfg.Reuse.MaxDistance = !tt.disabled, 6
+			for i, in := range tt.stored {
+				if in.Tenant == "" {
+					in.Tenant = defaultTenant
+				}
+				in.Check, in.CreatedAt = "shippingBoltsRemoved", started.Add(time.Duration(i)*time.Minute)
+				a.inspections.add(in)
+			}
+
+			matches, flags := a.findReuse(tenantRequest(defaultTenant), "P1", uploadedPhoto{PHash: formatPHash(hash)})
+			var ids []string
+			for _, match := range matches {
+				ids = append(ids, match.InspectionID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantMatches) {
+				t.Errorf("matches %v, want %v", ids, tt.wantMatches)
+			}
+			if (len(flags) == 1 && flags[0] == flagSuspectedReuse) != (len(tt.wantMatches) > 0) {
+				t.Errorf("flags %v, want %s only with matches", flags, flagSuspectedReuse)
+			}
+		})
+	}
+}
+
+func TestFindReuseLimits(t *testing.T) {
+	const hash = 0x0123456789abcdef
+	a := newTestApp(t)
+	a.cfg.Reuse.Enabled = true
+	started := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < maxReuseMatches+5; i++ {
+		a.inspections.add(inspection{ID: fmt.Sprintf("i%02d", i), Tenant: defaultTenant, ProjectNumber: fmt.Sprintf("P%d", i+2), Check: "shippingBoltsRemoved", PHash: formatPHash(hash), CreatedAt: started.Add(time.Duration(i) * time.Minute)})
+	}
+
+	// Maximaal maxReuseMatches, de nieuwste
+	matches, _ := a.findReuse(tenantRequest(defaultTenant), "P1", uploadedPhoto{PHash: formatPHash(hash)})
+	if len(matches) != maxReuseMatches || matches[0].InspectionID != "i14" || matches[maxReuseMatches-1].InspectionID != "i05" {
+		t.Errorf("%d matches from %s to %s, want %d from i14 to i05", len(matches), matches[0].InspectionID, matches[len(matches)-1].InspectionID, maxReuseMatches)
+	}
+
+	// Alleen de recente inspecties in memory (storage.maxRecentInspections): een oudere foto vinden we niet meer
+	inspections, err := openInspectionStore("", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.inspections = inspections
+	a.inspections.add(inspection{ID: "reused", Tenant: defaultTenant, ProjectNumber: "P2", PHash: formatPHash(hash), CreatedAt: started})
+	for i := 0; i < 6; i++ {
+		a.inspections.add(inspection{ID: fmt.Sprintf("later%d", i), Tenant: defaultTenant, ProjectNumber: "P3", PHash: formatPHash(^uint64(hash)), CreatedAt: started.Add(time.Hour)})
+	}
+	if matches, flags := a.findReuse(tenantRequest(defaultTenant), "P1", uploadedPhoto{PHash: formatPHash(hash)}); len(matches) != 0 || len(flags) != 0 {
+		t.Errorf("found %v beyond the recent inspections, want nothing", matches)
+	}
+}
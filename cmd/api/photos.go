@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ========================================
+// MEER FOTO'S PER CHECK (bijv. beide boutposities)
+// ========================================
+
+// Hoe meer foto's bij één check beoordeeld worden (checks.<id>.photoMode)
+const (
+	photoModeIndividual = "individual" // elke foto apart, met de cache en classificatie per foto
+	photoModeTogether   = "together"   // alle foto's in één call: het model ziet ze naast elkaar
+	photoModePair       = "pair"       // precies twee foto's met tijd ertussen: is er iets veranderd?
+)
+
+// Weigeringen in pair mode
+const (
+	codePhotoPairRequired    = "PHOTO_PAIR_REQUIRED"     // niet precies twee foto's
+	codePhotoPairTimeUnknown = "PHOTO_PAIR_TIME_UNKNOWN" // een foto zonder opnametijd in de EXIF
+	codePhotoPairTooClose    = "PHOTO_PAIR_TOO_CLOSE"    // foto's te kort na elkaar genomen
+	codeRegionNotSupported   = "REGION_NOT_SUPPORTED"    // together of pair mode: een aangewezen gebied gaat niet mee
+)
+
+// photoRules is hoe de foto's van een check beoordeeld en gecombineerd worden
+type photoRules struct {
+	Mode       string
+	Merge      string        // any, all of majority (individual en together)
+	PairMinGap time.Duration // pair: minimale tijd tussen de foto's
+}
+
+// photoRulesFor geeft de regels van een check: de config gaat voor de standaard van de check
+func (c config) photoRulesFor(check checkDefinition) photoRules {
+	rules := photoRules{Mode: photoModeIndividual, Merge: check.PhotoMerge, PairMinGap: check.PairMinGap}
+	if rules.Merge == "" {
+		rules.Merge = "any"
+	}
+	own := c.Checks[check.ID]
+	if own.PhotoMode != "" {
+		rules.Mode = own.PhotoMode
+	}
+	if own.PhotoMerge != "" {
+		rules.Merge = own.PhotoMerge
+	}
+	if own.PairMinGap > 0 {
+		rules.PairMinGap = time.Duration(own.PairMinGap)
+	}
+	return rules
+}
+
+// photoLabel is de naam van een foto in de findings, bijv. "photo 2"
+func photoLabel(i int) string {
+	return fmt.Sprintf("photo %d", i+1)
+}
+
+// photosNote is de notitie bij foto's die samen naar het model gaan: de gedeelde notitie, of
+// per foto met het label ervoor als ze verschillen
+func photosNote(photos []uploadedPhoto) string {
+	same := true
+	for _, photo := range photos[1:] {
+		same = same && photo.Note == photos[0].Note
+	}
+	if same {
+		return photos[0].Note
+	}
+	var notes []string
+	for i, photo := range photos {
+		if photo.Note != "" {
+			notes = append(notes, photoLabel(i)+": "+photo.Note)
+		}
+	}
+	return strings.Join(notes, "; ")
+}
+
+// photoHint is het aangewezen gebied en de notitie van één foto, bij meer foto's in de inspectie
+type photoHint struct {
+	Photo  string      `json:"photo"` // bijv. "photo 2", zoals in findings
+	Region *regionHint `json:"region,omitempty"`
+	Note   string      `json:"note,omitempty"`
+}
+
+// inspectionHints verdeelt de hints over de inspectie: bij één foto in Region en Note, bij meer
+// per foto in hints (alleen foto's met een hint)
+func inspectionHints(photos []uploadedPhoto) (region *regionHint, note string, hints []photoHint) {
+	if len(photos) == 1 {
+		return photos[0].Region, photos[0].Note, nil
+	}
+	for i, photo := range photos {
+		if photo.Region != nil || photo.Note != "" {
+			hints = append(hints, photoHint{Photo: photoLabel(i), Region: photo.Region, Note: photo.Note})
+		}
+	}
+	return nil, "", hints
+}
+
+// photosKey is de sleutel van alle foto's samen, in volgorde (idempotency)
+func photosKey(photos []uploadedPhoto) string {
+	var key strings.Builder
+	for i, photo := range photos {
+		if i > 0 {
+			key.WriteString("+")
+		}
+		key.WriteString(photo.Hash + photo.hintKey())
+	}
+	return key.String()
+}
+
+// highestRisk is de risicoscore van de meest verdachte foto
+func highestRisk(photos []uploadedPhoto) photoRisk {
+	risk := photos[0].Risk
+	for _, photo := range photos[1:] {
+		if photo.Risk.Score > risk.Score {
+			risk = photo.Risk
+		}
+	}
+	return risk
+}
+
+// judgePhotos is judge voor één of meer foto's bij dezelfde check. Bij meer foto's staat het
+// oordeel per foto in de findings en bepaalt de regel van de check (any, all of majority)
+// het resultaat; in pair mode gaat het oordeel over het paar. Bij een fout is de error
+// response al verstuurd.
+func (a *app) judgePhotos(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photos []uploadedPhoto) (verdict, bool) {
+	rules := a.cfg.photoRulesFor(check)
+	if len(photos) == 1 && rules.Mode != photoModePair {
+		return a.judge(w, r, tier, check, photos[0])
+	}
+
+	var v verdict
+	var ok bool
+	switch rules.Mode {
+	case photoModePair:
+		v, ok = a.judgePair(w, r, tier, check, photos)
+	case photoModeTogether:
+		v, ok = a.judgeTogether(w, r, tier, check, photos, rules.Merge)
+	default:
+		v, ok = a.judgeIndividually(w, r, tier, check, photos, rules.Merge)
+	}
+	if !ok {
+		return verdict{}, false
+	}
+	v = a.applyLevelReport(check.ID, v)
+	multiPhotoVerdictsTotal.WithLabelValues(check.ID, rules.Mode, v.Result).Inc()
+	return a.finishVerdict(r, v), true
+}
+
+// judgeIndividually beoordeelt de foto's één voor één en combineert de oordelen
+func (a *app) judgeIndividually(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photos []uploadedPhoto, merge string) (verdict, bool) {
+	v := verdict{Cached: true}
+	findings := make([]imageFinding, len(photos))
+	wrongSubject := 0
+	for i, photo := range photos {
+		one, ok := a.judgeClassified(w, r, tier, check, photo, nil)
+		if !ok {
+			return verdict{}, false
+		}
+		findings[i] = imageFinding{Image: photoLabel(i), Result: one.Result, Reason: one.Reason, ReasonCode: one.ReasonCode}
+		for _, reading := range one.Level {
+			reading.Photo = photoLabel(i)
+			v.Level = append(v.Level, reading)
+		}
+		for _, finding := range one.SubFindings {
+			finding.Photo = photoLabel(i)
+			v.SubFindings = append(v.SubFindings, finding)
+		}
+
+		v.Usage = v.Usage.plus(one.Usage)
+		v.ClassifierUsage = v.ClassifierUsage.plus(one.ClassifierUsage)
+		v.Cached = v.Cached && one.Cached
+		if v.Provider == "" {
+			v.Provider, v.Model = one.Provider, one.Model
+		}
+		if v.ClassifierModel == "" {
+			v.ClassifierModel = one.ClassifierModel
+		}
+		if one.ReasonCode == codeWrongSubject {
+			wrongSubject++
+		}
+		if v.SuggestedCheck == "" {
+			v.SuggestedCheck = one.SuggestedCheck
+		}
+	}
+
+	v.Result, v.Reason = mergeFindings(merge, findings)
+	v.Findings = findings
+	// Schade op één foto telt, ook als een andere foto de check goedkeurt
+	failSubFindings(&v)
+	// WRONG_SUBJECT alleen als geen enkele foto een installatie toont
+	if wrongSubject == len(photos) {
+		v.ReasonCode = codeWrongSubject
+	}
+	return v, true
+}
+
+// judgeTogether stuurt alle foto's in één call; het model geeft één regel per foto. Zonder
+// classificatie vooraf: het model ziet toch alle foto's.
+func (a *app) judgeTogether(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photos []uploadedPhoto, merge string) (verdict, bool) {
+	first := photos[0]
+	cacheKey := resultCacheKey(tenantFrom(r.Context()), tier, check, photosKey(photos)+"/"+first.Settings.key()+"/"+photoModeTogether+"/"+merge)
+	if v, ok := a.fromCache(w, tier, cacheKey); ok {
+		return v, true
+	}
+
+	req, timeout := a.visionRequestFor(tier, check, first)
+	req.UserText = noteUserText(togetherUserText(req.UserText, tier, len(photos)), photosNote(photos))
+	for _, photo := range photos[1:] {
+		req.MoreImageURLs = append(req.MoreImageURLs, photo.DataURL)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	answer, err := a.vision.analyze(ctx, req)
+	if err != nil {
+		writeAnalysisError(w, r, err)
+		return verdict{}, false
+	}
+	w.Header().Set("X-Provider", answer.Provider)
+
+	v := verdict{Provider: answer.Provider, Model: answer.Model, Usage: answer.Usage}
+	for _, photo := range photos {
+		v.Usage.ImageTokens += estimateImageTokens(photo.Width, photo.Height, first.Detail)
+	}
+	v.Findings = parsePhotoFindings(answer.Content, tier, len(photos))
+	v.Result, v.Reason = mergeFindings(merge, v.Findings)
+
+	a.cacheVerdict(r, cacheKey, v)
+	return v, true
+}
+
+// togetherUserText vraagt om één regel per foto in plaats van het formaat uit de system prompt
+func togetherUserText(userText, tier string, photos int) string {
+	format := `"PASS" or "FAIL"`
+	if tier == "gold" {
+		format = `"PASS" or "FAIL", then " - " and a brief explanation (max 100 characters)`
+	}
+	return fmt.Sprintf("%s These are %d photos of the same installation, taken from different angles. Use all photos as context, but judge each photo on what it shows.\n\n"+
+		"RESPONSE FORMAT FOR MULTIPLE PHOTOS (replaces the format above): exactly %d lines, one per photo in the order they were sent. Each line: %s",
+		userText, photos, photos, format)
+}
+
+// parsePhotoFindings leest het antwoord van judgeTogether: één regel per foto, bijv.
+// "PASS - Bolt removed" (een voorvoegsel als "Photo 2:" mag). Ontbrekende regels zijn FAIL.
+func parsePhotoFindings(content, tier string, photos int) []imageFinding {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	findings := make([]imageFinding, photos)
+	for i := range findings {
+		findings[i] = imageFinding{Image: photoLabel(i), Result: "FAIL"}
+		if i >= len(lines) {
+			findings[i].Reason = "No answer for this photo"
+			continue
+		}
+		line := lines[i]
+		if prefix, rest, found := strings.Cut(line, ":"); found && strings.HasPrefix(strings.ToLower(prefix), "photo") {
+			line = strings.TrimSpace(rest)
+		}
+		result, reason, _ := strings.Cut(line, " - ")
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(result), `*."`), "PASS") {
+			findings[i].Result = "PASS"
+		}
+		if tier == "gold" {
+			findings[i].Reason = strings.TrimSpace(reason)
+		}
+	}
+	return findings
+}
+
+// ========================================
+// PAIR MODE (bijv. draait het spoelprogramma echt?)
+// ========================================
+
+// checkPhotoPair controleert in pair mode of er twee foto's zijn die minstens PairMinGap na
+// elkaar genomen zijn (EXIF) en geeft ze terug op volgorde: de eerste foto is de vroegste.
+// photos zelf blijft zoals het binnenkwam. Zonder pair mode komt photos ongewijzigd terug.
+// Bij false is de weigering al verstuurd.
+//
+// De opnametijden komen van het toestel: wie de EXIF aanpast kan elke tijd ertussen opgeven,
+// en omdat beide foto's in één request zitten is er geen ontvangsttijd per foto om tegen te
+// houden. Een aangepaste EXIF zonder toestelgegevens valt wel op in de risicoscore (zie fraud.go).
+func (a *app) checkPhotoPair(w http.ResponseWriter, r *http.Request, check checkDefinition, photos []uploadedPhoto) (ordered []uploadedPhoto, ok bool) {
+	rules := a.cfg.photoRulesFor(check)
+	if rules.Mode != photoModePair {
+		return photos, true
+	}
+	reject := func(status int, code, message string, extra map[string]any) ([]uploadedPhoto, bool) {
+		photoPairChecksTotal.WithLabelValues(check.ID, code).Inc()
+		addLogAttrs(r.Context(), slog.String("errorCode", code))
+		body := map[string]any{"error": message, "code": code}
+		for key, value := range extra {
+			body[key] = value
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+		return nil, false
+	}
+
+	if len(photos) != 2 {
+		return reject(http.StatusBadRequest, codePhotoPairRequired,
+			fmt.Sprintf("This check needs two photos taken at least %s apart", rules.PairMinGap), nil)
+	}
+	if photos[0].EXIF.CaptureTime == nil || photos[1].EXIF.CaptureTime == nil {
+		return reject(http.StatusUnprocessableEntity, codePhotoPairTimeUnknown,
+			"Both photos need a capture time (EXIF) to prove the time between them", nil)
+	}
+
+	ordered = []uploadedPhoto{photos[0], photos[1]}
+	if ordered[1].EXIF.CaptureTime.Before(*ordered[0].EXIF.CaptureTime) {
+		ordered[0], ordered[1] = ordered[1], ordered[0]
+	}
+	gap := photoPairGap(ordered)
+	if gap < rules.PairMinGap {
+		return reject(http.StatusUnprocessableEntity, codePhotoPairTooClose,
+			fmt.Sprintf("Photos were taken %s apart, at least %s is needed", gap, rules.PairMinGap), map[string]any{
+				"captureTimes":  []time.Time{*ordered[0].EXIF.CaptureTime, *ordered[1].EXIF.CaptureTime},
+				"gapSeconds":    gap.Seconds(),
+				"minGapSeconds": rules.PairMinGap.Seconds(),
+			})
+	}
+	photoPairChecksTotal.WithLabelValues(check.ID, "ok").Inc()
+	addLogAttrs(r.Context(), slog.Float64("pairGapSeconds", gap.Seconds()))
+	return ordered, true
+}
+
+// photoPairGap is de tijd tussen de twee foto's (op volgorde, zie checkPhotoPair)
+func photoPairGap(photos []uploadedPhoto) time.Duration {
+	return photos[1].EXIF.CaptureTime.Sub(*photos[0].EXIF.CaptureTime)
+}
+
+// pairFormat is het antwoordformaat onder de PairPrompt, per tier
+var pairFormat = map[string]string{
+	"silver": `Respond with ONLY "PASS" or "FAIL"`,
+	"gold": `RESPONSE FORMAT - FOLLOW EXACTLY:
+- First line: "PASS" or "FAIL"
+- Second line: Brief explanation (max 100 characters) why it passed or failed`,
+}
+
+// judgePair stuurt beide foto's (vroegste eerst) in één call met de PairPrompt van de check.
+// Het oordeel gaat over het paar, dus er zijn geen findings per foto.
+func (a *app) judgePair(w http.ResponseWriter, r *http.Request, tier string, check checkDefinition, photos []uploadedPhoto) (verdict, bool) {
+	first, second := photos[0], photos[1]
+	gap := photoPairGap(photos).Round(time.Second)
+
+	prompt := check.PairPrompt + "\n\n" + pairFormat[tier]
+	sum := sha256.Sum256([]byte(prompt))
+	cacheKey := resultCacheKey(tenantFrom(r.Context()), tier, check,
+		photosKey(photos)+"/"+first.Settings.key()+"/"+photoModePair+"/"+hex.EncodeToString(sum[:6])+"/"+gap.String())
+	if v, ok := a.fromCache(w, tier, cacheKey); ok {
+		return v, true
+	}
+
+	req, timeout := a.visionRequestFor(tier, check, first)
+	req.SystemPrompt = prompt
+	req.UserText = noteUserText(fmt.Sprintf("Compare these two photos of the same machine. The second photo was taken %s after the first one.", gap), photosNote(photos))
+	req.MoreImageURLs = []string{second.DataURL}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	answer, err := a.vision.analyze(ctx, req)
+	if err != nil {
+		writeAnalysisError(w, r, err)
+		return verdict{}, false
+	}
+	w.Header().Set("X-Provider", answer.Provider)
+
+	v := verdict{Provider: answer.Provider, Model: answer.Model, Usage: answer.Usage}
+	v.Usage.ImageTokens = estimateImageTokens(first.Width, first.Height, first.Detail) + estimateImageTokens(second.Width, second.Height, first.Detail)
+	if tier == "gold" {
+		v.Result, v.Reason = parseGoldResponse(answer.Content)
+	} else if strings.TrimSpace(answer.Content) == "PASS" {
+		v.Result = "PASS"
+	} else {
+		v.Result = "FAIL"
+	}
+
+	a.cacheVerdict(r, cacheKey, v)
+	return v, true
+}
+
+// checkPhotoRegions weigert een aangewezen gebied (region, region[]) als de foto's samen in één
+// call gaan (together en pair): daar gaan alleen de hele foto's mee, zonder uitsneden. Bij false
+// is de weigering al verstuurd.
+func (a *app) checkPhotoRegions(w http.ResponseWriter, r *http.Request, check checkDefinition, photos []uploadedPhoto) bool {
+	rules := a.cfg.photoRulesFor(check)
+	if rules.Mode != photoModePair && (rules.Mode != photoModeTogether || len(photos) == 1) {
+		return true
+	}
+	for _, photo := range photos {
+		if photo.Region != nil {
+			addLogAttrs(r.Context(), slog.String("errorCode", codeRegionNotSupported))
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("This check judges all photos in one call (photo mode %s); it cannot use a region", rules.Mode),
+				"code":  codeRegionNotSupported,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// mergeGoldSignals combineert de signalen van meer foto's: alle flags, de verste afstand en
+// alle hergebruikte foto's. Eén foto buiten de geofence maakt locationVerified false; true
+// alleen als elke foto op de locatie is genomen, anders unknown.
+func mergeGoldSignals(all []goldSignals) goldSignals {
+	merged := goldSignals{LocationVerified: locationVerified}
+	seenFlags := make(map[string]bool)
+	seenMatches := make(map[string]bool)
+	for _, signals := range all {
+		for _, flag := range signals.Flags {
+			if !seenFlags[flag] {
+				seenFlags[flag] = true
+				merged.Flags = append(merged.Flags, flag)
+			}
+		}
+		switch {
+		case signals.LocationVerified == locationNotOnSite:
+			merged.LocationVerified = locationNotOnSite
+		case signals.LocationVerified != locationVerified && merged.LocationVerified == locationVerified:
+			merged.LocationVerified = locationUnverified
+		}
+		if signals.DistanceMeters != nil && (merged.DistanceMeters == nil || *signals.DistanceMeters > *merged.DistanceMeters) {
+			merged.DistanceMeters = signals.DistanceMeters
+		}
+		for _, match := range signals.ReuseMatches {
+			if !seenMatches[match.InspectionID] && len(merged.ReuseMatches) < maxReuseMatches {
+				seenMatches[match.InspectionID] = true
+				merged.ReuseMatches = append(merged.ReuseMatches, match)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hintRequest stuurt foto's met elk een eigen region[] en note[], vóór de foto (zie readPhotos);
+// notities die overblijven komen achteraan
+func hintRequest(t *testing.T, url string, photos [][]byte, regions, notes []string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for i, photo := range photos {
+		if i < len(regions) {
+			form.WriteField("region[]", regions[i])
+		}
+		if i < len(notes) {
+			form.WriteField("note[]", notes[i])
+		}
+		part, err := form.CreateFormFile("photo[]", "photo.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(photo)
+	}
+	for _, note := range notes[min(len(notes), len(photos)):] {
+		form.WriteField("note[]", note)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, url, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestGoldStoresHintsPerPhoto(t *testing.T) {
+	// Foto 2 heeft een gebied: de hele foto en de uitsnede gaan los naar het model
+	checker := &scriptedProvider{id: "checker", answers: []string{"PASS\nBolt removed", "PASS\nBolt removed", "PASS\nBolt removed"}}
+	a := newTestApp(t, checker)
+
+	rec := httptest.NewRecorder()
+	a.goldHandler(rec, hintRequest(t, "/api/laundry/gold/v1/P1/shippingBoltsRemoved",
+		[][]byte{testJPEG(t, 64, 48), testJPEG(t, 64, 48)},
+		[]string{"", "0.5,0.5"},
+		[]string{"Left side", "Right side"},
+	))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+	if len(recorded) != 1 {
+		t.Fatalf("recorded %d inspections, want 1", len(recorded))
+	}
+	in := recorded[0]
+	if in.Region != nil || in.Note != "" {
+		t.Errorf("inspection region %v, note %q, want both per photo in hints", in.Region, in.Note)
+	}
+	if len(in.Hints) != 2 {
+		t.Fatalf("hints = %+v, want one per photo", in.Hints)
+	}
+	if first := in.Hints[0]; first.Photo != "photo 1" || first.Region != nil || first.Note != "Left side" {
+		t.Errorf("hint 0 = %+v, want photo 1 with only its note", first)
+	}
+	if second := in.Hints[1]; second.Photo != "photo 2" || second.Region == nil || second.Note != "Right side" {
+		t.Errorf("hint 1 = %+v, want photo 2 with its region and note", second)
+	}
+	// Elke notitie gaat met zijn eigen foto mee naar het model
+	var notes []string
+	for _, req := range checker.seen {
+		for _, note := range []string{"Left side", "Right side"} {
+			if strings.Contains(req.UserText, note) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	if len(checker.seen) != 3 || len(notes) != 3 {
+		t.Errorf("%d calls with notes %v, want photo 1, photo 2 and its region each with one note", len(checker.seen), notes)
+	}
+}
+
+func TestOneCallModesRejectRegions(t *testing.T) {
+	for _, mode := range []string{photoModeTogether, photoModePair} {
+		t.Run(mode, func(t *testing.T) {
+			checker := &scriptedProvider{id: "checker"}
+			a := newTestApp(t, checker)
+			a.cfg.Checks = map[string]checkConfig{"rinseCycleMachineIsOn": {PhotoMode: mode}}
+
+			rec := httptest.NewRecorder()
+			a.goldHandler(rec, hintRequest(t, "/api/laundry/gold/v1/P1/rinseCycleMachineIsOn",
+				[][]byte{testJPEG(t, 64, 48), testJPEG(t, 64, 48)}, []string{"0.5,0.5"}, nil))
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), codeRegionNotSupported) {
+				t.Errorf("status = %d, body %s, want 400 %s", rec.Code, rec.Body, codeRegionNotSupported)
+			}
+			if len(checker.seen) != 0 {
+				t.Error("photos went to the model without their region")
+			}
+		})
+	}
+}
+
+func TestMergeGoldSignalsLocation(t *testing.T) {
+	tests := []struct {
+		photos []string
+		want   string
+	}{
+		{[]string{locationVerified}, locationVerified},
+		{[]string{locationVerified, locationVerified}, locationVerified},
+		{[]string{locationVerified, locationUnverified}, locationUnverified},
+		{[]string{locationUnverified, locationVerified}, locationUnverified},
+		{[]string{locationVerified, locationNotOnSite, locationUnverified}, locationNotOnSite},
+		{[]string{locationUnverified, locationUnverified}, locationUnverified},
+	}
+	for _, tt := range tests {
+		all := make([]goldSignals, len(tt.photos))
+		for i, location := range tt.photos {
+			all[i].LocationVerified = location
+		}
+		if got := mergeGoldSignals(all).LocationVerified; got != tt.want {
+			t.Errorf("mergeGoldSignals(%v) = %s, want %s", tt.photos, got, tt.want)
+		}
+	}
+}
+
+func TestReadPhotosRejectsMoreHintsThanPhotos(t *testing.T) {
+	a := newTestApp(t, &scriptedProvider{id: "checker"})
+
+	rec := httptest.NewRecorder()
+	a.goldHandler(rec, hintRequest(t, "/api/laundry/gold/v1/P1/shippingBoltsRemoved",
+		[][]byte{testJPEG(t, 64, 48)}, nil, []string{"one", "two"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for two notes with one photo", rec.Code)
+	}
+}
+
+func TestCheckPhotoPairLeavesCallerOrder(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.Checks = map[string]checkConfig{"rinseCycleMachineIsOn": {PhotoMode: photoModePair}}
+	check, _ := findCheck("rinseCycleMachineIsOn")
+
+	early, late := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 10, 5, 0, 0, time.UTC)
+	photos := []uploadedPhoto{{Hash: "late", EXIF: exifData{CaptureTime: &late}}, {Hash: "early", EXIF: exifData{CaptureTime: &early}}}
+
+	ordered, ok := a.checkPhotoPair(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil), check, photos)
+	if !ok {
+		t.Fatal("pair five minutes apart was rejected")
+	}
+	if ordered[0].Hash != "early" || ordered[1].Hash != "late" {
+		t.Errorf("ordered = %s, %s, want the earliest photo first", ordered[0].Hash, ordered[1].Hash)
+	}
+	if photos[0].Hash != "late" {
+		t.Error("checkPhotoPair reordered the caller's photos")
+	}
+}
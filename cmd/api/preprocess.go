@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+)
+
+// ========================================
+// FOTO VOORBEWERKING (kleiner = minder tokens)
+// ========================================
+
+// imageSettings bepalen hoe de foto van een check naar het model gaat
+type imageSettings struct {
+	Preprocess  bool
+	MaxLongEdge int     // langste zijde in pixels na verkleinen
+	JPEGQuality int     // 1-100
+	Detail      string  // low, high of auto (OpenAI "detail")
+	Tiles       int     // >1 = ook overlappende uitsneden van Tiles x Tiles beoordelen
+	TileOverlap float64 // overlap tussen de uitsneden, bijv. 0.2
+	TileMerge   string  // any, all of majority (zie mergeFindings)
+}
+
+// key is een korte beschrijving voor de cache key: andere instellingen = ander beeld voor het model
+func (s imageSettings) key() string {
+	key := "original/" + s.Detail
+	if s.Preprocess {
+		key = fmt.Sprintf("%d/%d/%s", s.MaxLongEdge, s.JPEGQuality, s.Detail)
+	}
+	if s.Tiles > 1 {
+		key += fmt.Sprintf("/tiles%d/%g/%s", s.Tiles, s.TileOverlap, s.TileMerge)
+	}
+	return key
+}
+
+// imageSettingsFor geeft de instellingen van een check: eigen waarden gaan voor de globale
+func (c config) imageSettingsFor(checkID string) imageSettings {
+	settings := imageSettings{
+		Preprocess:  c.Image.Preprocess,
+		MaxLongEdge: c.Image.MaxLongEdge,
+		JPEGQuality: c.Image.JPEGQuality,
+		Detail:      c.Image.Detail,
+		Tiles:       c.Image.Tiles,
+		TileOverlap: c.Image.TileOverlap,
+		TileMerge:   c.Image.TileMerge,
+	}
+	check := c.Checks[checkID]
+	if check.MaxLongEdge > 0 {
+		settings.MaxLongEdge = check.MaxLongEdge
+	}
+	if check.JPEGQuality > 0 {
+		settings.JPEGQuality = check.JPEGQuality
+	}
+	if check.Detail != "" {
+		settings.Detail = check.Detail
+	}
+	if check.Tiles > 0 {
+		settings.Tiles = check.Tiles
+	}
+	if check.TileMerge != "" {
+		settings.TileMerge = check.TileMerge
+	}
+	return settings
+}
+
+// decodedPhoto is een gedecodeerde foto plus de EXIF orientation (1-8)
+type decodedPhoto struct {
+	img         image.Image
+	orientation int
+}
+
+// decodePhoto decodeert de foto terwijl hij binnenkomt; orientation komt uit de EXIF (0 of ongeldig = rechtop)
+func decodePhoto(r io.Reader, orientation int) (decodedPhoto, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return decodedPhoto{}, err
+	}
+	photo := decodedPhoto{img: img, orientation: 1}
+	if orientation >= 2 && orientation <= 8 {
+		photo.orientation = orientation
+	}
+	return photo, nil
+}
+
+// size geeft breedte en hoogte zoals de foto rechtop staat
+func (p decodedPhoto) size() (width, height int) {
+	bounds := p.img.Bounds()
+	if p.orientation >= 5 { // 5-8 wisselen breedte en hoogte
+		return bounds.Dy(), bounds.Dx()
+	}
+	return bounds.Dx(), bounds.Dy()
+}
+
+// preprocessPhoto draait de foto rechtop (EXIF orientation), verkleint hem tot
+// MaxLongEdge en slaat hem op als JPEG. Geeft ok=false als het origineel beter is
+// (de nieuwe versie is niet kleiner en niet gedraaid of verkleind).
+func preprocessPhoto(photo decodedPhoto, originalBytes int, settings imageSettings, out *bytes.Buffer) (width, height int, ok bool, err error) {
+	width, height = photo.size()
+	resized := max(width, height) > settings.MaxLongEdge
+	width, height, err = photo.render(image.Rect(0, 0, width, height), settings.MaxLongEdge, settings.JPEGQuality, out)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// Niets gedraaid of verkleind en niet kleiner geworden: origineel houden
+	if !resized && photo.orientation == 1 && out.Len() >= originalBytes {
+		return 0, 0, false, nil
+	}
+	return width, height, true, nil
+}
+
+// render snijdt region (in rechtop coördinaten) uit de foto, verkleint tot maxLongEdge,
+// draait hem rechtop en schrijft hem als JPEG naar out. Geeft de afmetingen van het resultaat.
+func (p decodedPhoto) render(region image.Rectangle, maxLongEdge, quality int, out *bytes.Buffer) (width, height int, err error) {
+	// Eerst uitsnijden en verkleinen in de oriëntatie van de bron, dan pas draaien (minder pixels)
+	src := p.img
+	if rect := p.sourceRect(region); rect != src.Bounds() {
+		if sub, ok := src.(interface {
+			SubImage(image.Rectangle) image.Image
+		}); ok {
+			src = sub.SubImage(rect)
+		} else {
+			src = toRGBA(src).SubImage(rect.Sub(src.Bounds().Min))
+		}
+	}
+
+	bounds := src.Bounds()
+	var rgba *image.RGBA
+	if longest := max(bounds.Dx(), bounds.Dy()); longest > maxLongEdge {
+		rgba = resizeBox(src, bounds.Dx()*maxLongEdge/longest, bounds.Dy()*maxLongEdge/longest)
+	} else if p.orientation != 1 {
+		rgba = toRGBA(src)
+	}
+
+	result := src
+	if rgba != nil {
+		result = orient(rgba, p.orientation)
+	}
+	if err := jpeg.Encode(out, result, &jpeg.Options{Quality: quality}); err != nil {
+		return 0, 0, err
+	}
+	return result.Bounds().Dx(), result.Bounds().Dy(), nil
+}
+
+// sourceRect rekent een rechthoek in rechtop coördinaten terug naar de pixels van de bron
+func (p decodedPhoto) sourceRect(region image.Rectangle) image.Rectangle {
+	bounds := p.img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	// Omgekeerde van orient: rechtop pixel (x, y) komt uit bron pixel (sx, sy)
+	source := func(x, y int) image.Point {
+		switch p.orientation {
+		case 2:
+			return image.Pt(w-1-x, y)
+		case 3:
+			return image.Pt(w-1-x, h-1-y)
+		case 4:
+			return image.Pt(x, h-1-y)
+		case 5:
+			return image.Pt(y, x)
+		case 6:
+			return image.Pt(y, h-1-x)
+		case 7:
+			return image.Pt(w-1-y, h-1-x)
+		case 8:
+			return image.Pt(w-1-y, x)
+		}
+		return image.Pt(x, y)
+	}
+	a := source(region.Min.X, region.Min.Y)
+	b := source(region.Max.X-1, region.Max.Y-1)
+	rect := image.Rect(min(a.X, b.X), min(a.Y, b.Y), max(a.X, b.X)+1, max(a.Y, b.Y)+1)
+	return rect.Add(bounds.Min).Intersect(bounds)
+}
+
+// resizeBox verkleint met een box filter: elke nieuwe pixel is het gemiddelde van
+// de bronpixels eronder. Goed genoeg voor verkleinen en zonder externe library.
+func resizeBox(src image.Image, width, height int) *image.RGBA {
+	width, height = max(width, 1), max(height, 1)
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Per rij sommen we de kleuren per doelkolom op, en delen aan het einde van de doelrij
+	sums := make([]uint64, width*4)
+	counts := make([]uint64, width)
+	ycbcr, isYCbCr := src.(*image.YCbCr)
+
+	dstY := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var r, g, b, a uint32
+			if isYCbCr {
+				// Snelle route voor JPEG: direct uit de kleurvlakken, geen interface call per pixel
+				yi, ci := ycbcr.YOffset(x, y), ycbcr.COffset(x, y)
+				r8, g8, b8 := color.YCbCrToRGB(ycbcr.Y[yi], ycbcr.Cb[ci], ycbcr.Cr[ci])
+				r, g, b, a = uint32(r8), uint32(g8), uint32(b8), 255
+			} else {
+				r16, g16, b16, a16 := src.At(x, y).RGBA()
+				r, g, b, a = r16>>8, g16>>8, b16>>8, a16>>8
+			}
+			dx := (x - bounds.Min.X) * width / bounds.Dx()
+			sums[dx*4] += uint64(r)
+			sums[dx*4+1] += uint64(g)
+			sums[dx*4+2] += uint64(b)
+			sums[dx*4+3] += uint64(a)
+			counts[dx]++
+		}
+
+		// Laatste bronrij van deze doelrij? Dan de gemiddelden wegschrijven
+		nextDstY := (y + 1 - bounds.Min.Y) * height / bounds.Dy()
+		if nextDstY != dstY || y == bounds.Max.Y-1 {
+			row := dst.Pix[dstY*dst.Stride:]
+			for dx := 0; dx < width; dx++ {
+				if n := counts[dx]; n > 0 {
+					row[dx*4] = uint8(sums[dx*4] / n)
+					row[dx*4+1] = uint8(sums[dx*4+1] / n)
+					row[dx*4+2] = uint8(sums[dx*4+2] / n)
+					row[dx*4+3] = uint8(sums[dx*4+3] / n)
+				}
+			}
+			clear(sums)
+			clear(counts)
+			dstY = nextDstY
+		}
+	}
+	return dst
+}
+
+// toRGBA kopieert een afbeelding naar RGBA (nodig om te kunnen draaien)
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	return resizeBox(src, bounds.Dx(), bounds.Dy())
+}
+
+// orient draait/spiegelt volgens de EXIF orientation tag (1-8), zodat de foto rechtop staat
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 5-8 wisselen breedte en hoogte
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch orientation {
+			case 2: // gespiegeld horizontaal
+				nx, ny = w-1-x, y
+			case 3: // 180 graden
+				nx, ny = w-1-x, h-1-y
+			case 4: // gespiegeld verticaal
+				nx, ny = x, h-1-y
+			case 5: // gespiegeld over de diagonaal
+				nx, ny = y, x
+			case 6: // 90 graden met de klok mee
+				nx, ny = h-1-y, x
+			case 7: // gespiegeld over de andere diagonaal
+				nx, ny = h-1-y, w-1-x
+			case 8: // 90 graden tegen de klok in
+				nx, ny = y, w-1-x
+			}
+			copy(dst.Pix[ny*dst.Stride+nx*4:ny*dst.Stride+nx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
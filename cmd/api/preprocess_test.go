@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// labeled is een afbeelding waarin elke pixel uniek is: R = x, G = y
+func labeled(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+// quadrantJPEG is een JPEG met vier effen kwarten: rood, groen (boven), blauw, wit (onder)
+func quadrantJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := [2][2]color.RGBA{
+				{{R: 255, A: 255}, {G: 255, A: 255}},
+				{{B: 255, A: 255}, {R: 255, G: 255, B: 255, A: 255}},
+			}[y*2/height][x*2/width]
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// quadrant geeft de kleur in het midden van een kwart (0 = linksboven, 1 = rechtsboven, 2, 3 = onder)
+func quadrant(img image.Image, n int) string {
+	b := img.Bounds()
+	x := b.Min.X + b.Dx()/4 + (n%2)*b.Dx()/2
+	y := b.Min.Y + b.Dy()/4 + (n/2)*b.Dy()/2
+	r, g, bl, _ := img.At(x, y).RGBA()
+	high := func(v uint32) bool { return v > 0xc000 }
+	switch {
+	case high(r) && high(g) && high(bl):
+		return "white"
+	case high(r) && !high(g) && !high(bl):
+		return "red"
+	case !high(r) && high(g) && !high(bl):
+		return "green"
+	case !high(r) && !high(g) && high(bl):
+		return "blue"
+	}
+	return "mixed"
+}
+
+// quantTables geeft de DQT segmenten van een JPEG: die volgen direct uit de kwaliteit
+func quantTables(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var tables []byte
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker, length := data[i+1], int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA { // start of scan: daarna alleen nog beelddata
+			break
+		}
+		if marker == 0xDB {
+			tables = append(tables, data[i+4:i+2+length]...)
+		}
+		i += 2 + length
+	}
+	if len(tables) == 0 {
+		t.Fatal("JPEG without quantization tables")
+	}
+	return tables
+}
+
+func TestOrient(t *testing.T) {
+	// Bron van 3x2: a b c / d e f. Verwacht: de foto zoals hij rechtop bedoeld is (EXIF 2.32, tag 0x0112)
+	tests := []struct {
+		orientation int
+		want        []string // rijen, van boven naar beneden
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}}, // gespiegeld horizontaal
+		{3, []string{"fed", "cba"}}, // 180 graden
+		{4, []string{"def", "abc"}}, // gespiegeld verticaal
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}}, // 90 graden met de klok mee
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}}, // 90 graden tegen de klok in
+		{0, []string{"abc", "def"}},     // ongeldig: ongewijzigd
+		{9, []string{"abc", "def"}},
+	}
+	letter := func(c color.RGBA) string { return string(rune('a' + int(c.R) + 3*int(c.G))) }
+	for _, tt := range tests {
+		got := orient(labeled(3, 2), tt.orientation)
+		var rows []string
+		for y := 0; y < got.Bounds().Dy(); y++ {
+			var row strings.Builder
+			for x := 0; x < got.Bounds().Dx(); x++ {
+				row.WriteString(letter(got.RGBAAt(x, y)))
+			}
+			rows = append(rows, row.String())
+		}
+		if strings.Join(rows, "/") != strings.Join(tt.want, "/") {
+			t.Errorf("orientation %d: %v, want %v", tt.orientation, rows, tt.want)
+		}
+	}
+}
+
+func TestSourceRectMatchesOrient(t *testing.T) {
+	src := labeled(6, 4)
+	for orientation := 1; orientation <= 8; orientation++ {
+		upright := orient(src, orientation)
+		photo := decodedPhoto{img: src, orientation: orientation}
+		for _, region := range []image.Rectangle{image.Rect(1, 1, 3, 3), image.Rect(0, 0, 4, 1), image.Rect(2, 0, 4, 4)} {
+			// Eerst uitsnijden in de bron en dan draaien moet hetzelfde geven als draaien en dan uitsnijden
+			got := orient(toRGBA(src.SubImage(photo.sourceRect(region))), orientation)
+			if got.Bounds().Dx() != region.Dx() || got.Bounds().Dy() != region.Dy() {
+				t.Errorf("orientation %d, region %v: size %v", orientation, region, got.Bounds().Size())
+				continue
+			}
+			for y := 0; y < region.Dy(); y++ {
+				for x := 0; x < region.Dx(); x++ {
+					if g, w := got.RGBAAt(x, y), upright.RGBAAt(region.Min.X+x, region.Min.Y+y); g != w {
+						t.Fatalf("orientation %d, region %v: pixel (%d,%d) = %v, want %v", orientation, region, x, y, g, w)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPreprocessPhotoOrientation(t *testing.T) {
+	original := quadrantJPEG(t, 200, 100)
+	settings := imageSettings{Preprocess: true, MaxLongEdge: 50, JPEGQuality: 90, Detail: "auto"}
+
+	// Kleur linksboven en rechtsonder na het rechtop zetten (bron: rood groen / blauw wit)
+	tests := []struct {
+		orientation          int
+		width, height        int
+		topLeft, bottomRight string
+	}{
+		{1, 50, 25, "red", "white"},
+		{2, 50, 25, "green", "blue"},
+		{3, 50, 25, "white", "red"},
+		{4, 50, 25, "blue", "green"},
+		{5, 25, 50, "red", "white"},
+		{6, 25, 50, "blue", "green"},
+		{7, 25, 50, "white", "red"},
+		{8, 25, 50, "green", "blue"},
+	}
+	for _, tt := range tests {
+		photo, err := decodePhoto(bytes.NewReader(original), tt.orientation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		width, height, ok, err := preprocessPhoto(photo, len(original), settings, &out)
+		if err != nil || !ok {
+			t.Fatalf("orientation %d: ok %v, err %v", tt.orientation, ok, err)
+		}
+		img, err := jpeg.Decode(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != tt.width || height != tt.height || img.Bounds().Dx() != tt.width || img.Bounds().Dy() != tt.height {
+			t.Errorf("orientation %d: %dx%d (image %v), want %dx%d", tt.orientation, width, height, img.Bounds().Size(), tt.width, tt.height)
+		}
+		if tl, br := quadrant(img, 0), quadrant(img, 3); tl != tt.topLeft || br != tt.bottomRight {
+			t.Errorf("orientation %d: top left %s, bottom right %s, want %s and %s", tt.orientation, tl, br, tt.topLeft, tt.bottomRight)
+		}
+	}
+}
+
+func TestPreprocessPhotoResize(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height       int
+		maxLongEdge         int
+		originalBytes       int // 0 = de echte grootte
+		wantOK              bool
+		wantWidth, wantHigh int
+	}{
+		{"landscape", 400, 300, 200, 0, true, 200, 150},
+		{"portrait", 300, 400, 200, 0, true, 150, 200},
+		{"odd ratio", 1000, 333, 100, 0, true, 100, 33},
+		{"exactly the long edge", 200, 100, 200, 0, true, 200, 100}, // kwaliteit 50 is kleiner dan het origineel (95)
+		{"small and already compact", 200, 100, 200, 1, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := quadrantJPEG(t, tt.width, tt.height)
+			originalBytes := len(original)
+			if tt.originalBytes > 0 {
+				originalBytes = tt.originalBytes
+			}
+			photo, err := decodePhoto(bytes.NewReader(original), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			width, height, ok, err := preprocessPhoto(photo, originalBytes, imageSettings{Preprocess: true, MaxLongEdge: tt.maxLongEdge, JPEGQuality: 50}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || width != tt.wantWidth || height != tt.wantHigh {
+				t.Errorf("ok %v, %dx%d, want %v, %dx%d", ok, width, height, tt.wantOK, tt.wantWidth, tt.wantHigh)
+			}
+			if !ok {
+				return
+			}
+			// Verkleind met een gemiddelde: de kwarten blijven herkenbaar
+			img, err := jpeg.Decode(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n, want := range []string{"red", "green", "blue", "white"} {
+				if got := quadrant(img, n); got != want {
+					t.Errorf("quadrant %d = %s, want %s", n, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreprocessPhotoJPEGQuality(t *testing.T) {
+	original := testJPEG(t, 300, 200)
+	sizes := map[int]int{}
+	for _, quality := range []int{20, 60, 95} {
+		photo, err := decodePhoto(bytes.NewReader(original), 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if _, _, _, err := preprocessPhoto(photo, len(original), imageSettings{Preprocess: true, MaxLongEdge: 150, JPEGQuality: quality}, &out); err != nil {
+			t.Fatal(err)
+		}
+		// Dezelfde tabellen als een encoder met die kwaliteit: de instelling komt aan
+		var reference bytes.Buffer
+		jpeg.Encode(&reference, image.NewRGBA(image.Rect(0, 0, 8, 8)), &jpeg.Options{Quality: quality})
+		if !bytes.Equal(quantTables(t, out.Bytes()), quantTables(t, reference.Bytes())) {
+			t.Errorf("quality %d: quantization tables of another quality", quality)
+		}
+		sizes[quality] = out.Len()
+	}
+	if sizes[20] >= sizes[60] || sizes[60] >= sizes[95] {
+		t.Errorf("sizes by quality %v, want them to grow with the quality", sizes)
+	}
+}
+
+func TestImageSettingsFor(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Image.Detail, cfg.Image.MaxLongEdge, cfg.Image.JPEGQuality, cfg.Image.Tiles = "low", 1024, 80, 1
+	cfg.Checks = map[string]checkConfig{
+		"shippingBoltsRemoved": {Detail: "high", MaxLongEdge: 512},
+		"powerCordInSocket":    {JPEGQuality: 60, Tiles: 2},
+	}
+
+	tests := []struct {
+		check string
+		want  imageSettings
+	}{
+		{"shippingBoltsRemoved", imageSettings{MaxLongEdge: 512, JPEGQuality: 80, Detail: "high", Tiles: 1}},
+		{"powerCordInSocket", imageSettings{MaxLongEdge: 1024, JPEGQuality: 60, Detail: "low", Tiles: 2}},
+		{"drainHoseInDrain", imageSettings{MaxLongEdge: 1024, JPEGQuality: 80, Detail: "low", Tiles: 1}},
+	}
+	for _, tt := range tests {
+		got := cfg.imageSettingsFor(tt.check)
+		tt.want.Preprocess, tt.want.TileOverlap, tt.want.TileMerge = cfg.Image.Preprocess, cfg.Image.TileOverlap, cfg.Image.TileMerge
+		if got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.check, got, tt.want)
+		}
+	}
+	// Andere instellingen, andere cache key
+	if cfg.imageSettingsFor("shippingBoltsRemoved").key() == cfg.imageSettingsFor("drainHoseInDrain").key() {
+		t.Error("different image settings share a cache key")
+	}
+}
+
+func TestCheckImageSettingsReachModel(t *testing.T) {
+	// Rechtop gezet uit de EXIF: 200x100 met orientation 6 is 100x200 voor het model
+	tiff := buildTIFF(binary.LittleEndian, []tiffEntry{shortTag(binary.LittleEndian, tagOrientation, 6)}, nil, nil)
+	photo := withAPP1(quadrantJPEG(t, 200, 100), append([]byte("Exif\x00\x00"), tiff...))
+
+	tests := []struct {
+		check               string
+		wantDetail          string
+		wantWidth, wantHigh int
+		wantImageTokens     string
+	}{
+		{"shippingBoltsRemoved", "high", 40, 80, "255"},
+		{"drainHoseInDrain", "low", 50, 100, "85"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.check, func(t *testing.T) {
+			checker := &scriptedProvider{id: "checker", answers: []string{"PASS\nLooks fine"}}
+			a := newTestApp(t, checker)
+			a.cfg.Image.Detail, a.cfg.Image.MaxLongEdge = "low", 100
+			a.cfg.Checks = map[string]checkConfig{"shippingBoltsRemoved": {Detail: "high", MaxLongEdge: 80}}
+
+			rec := httptest.NewRecorder()
+			a.goldHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/"+tt.check, photo))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if len(checker.seen) != 1 {
+				t.Fatalf("%d calls, want 1", len(checker.seen))
+			}
+			req := checker.seen[0]
+			if req.ImageDetail != tt.wantDetail {
+				t.Errorf("detail %q, want %q", req.ImageDetail, tt.wantDetail)
+			}
+			data, err := base64.StdEncoding.DecodeString(req.ImageURL[strings.IndexByte(req.ImageURL, ',')+1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.wantWidth || img.Bounds().Dy() != tt.wantHigh || quadrant(img, 0) != "blue" {
+				t.Errorf("model got %v with %s top left, want %dx%d upright (blue top left)", img.Bounds().Size(), quadrant(img, 0), tt.wantWidth, tt.wantHigh)
+			}
+			if got := rec.Header().Get("X-Usage-Image-Tokens"); got != tt.wantImageTokens {
+				t.Errorf("image tokens %s, want %s", got, tt.wantImageTokens)
+			}
+		})
+	}
+}
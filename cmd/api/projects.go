@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========================================
+// PROJECTEN (afspraakvenster per project)
+// ========================================
+
+// Flags bij een inspectie (en foutcode bij policy "reject")
+const (
+	codeCaptureOutsideWindow = "CAPTURE_TIME_OUTSIDE_WINDOW" // foto genomen buiten het afspraakvenster
+	flagCaptureTimeUnknown   = "CAPTURE_TIME_UNKNOWN"        // wel een venster, maar geen opnametijd in de EXIF
+)
+
+// project is wat een tenant vooraf over een project vastlegt
+type project struct {
+	Tenant           string       `json:"tenant"`
+	ProjectNumber    string       `json:"projectNumber"`
+	AppointmentStart *time.Time   `json:"appointmentStart,omitempty"`
+	AppointmentEnd   *time.Time   `json:"appointmentEnd,omitempty"`
+	CapturePolicy    string       `json:"capturePolicy,omitempty"` // flag of reject, leeg = projects.capturePolicy
+	Location         *gpsPosition `json:"location,omitempty"`      // coördinaten van het adres (zie geofence.go)
+	RadiusMeters     float64      `json:"radiusMeters,omitempty"`  // straal van de geofence, 0 = projects.geofenceRadiusMeters
+	UpdatedAt        time.Time    `json:"updatedAt"`
+	Deleted          bool         `json:"deleted,omitempty"` // alleen in het bestand: project is verwijderd
+}
+
+// projectStore houdt de projecten per tenant in memory en schrijft wijzigingen
+// optioneel naar een JSON lines bestand (laatste regel per project wint)
+type projectStore struct {
+	cfg  projectsConfig
+	zone *time.Location // voor EXIF tijden zonder tijdzone
+
+	mu       sync.RWMutex
+	projects map[string]project // tenant + "/" + projectNumber -> project
+	file     *os.File           // nil = alleen in memory
+}
+
+// openProjectStore laadt de projecten uit cfg.File en herschrijft het bestand compact
+func openProjectStore(cfg projectsConfig) (*projectStore, error) {
+	zone, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("projects.timeZone: %w", err)
+	}
+	store := &projectStore{cfg: cfg, zone: zone, projects: make(map[string]project)}
+	if cfg.File == "" {
+		return store, nil
+	}
+
+	if data, err := os.ReadFile(cfg.File); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		line := 0
+		for scanner.Scan() {
+			line++
+			var p project
+			if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+				return nil, fmt.Errorf("projects file %s line %d: %w", cfg.File, line, err)
+			}
+			if p.Deleted {
+				delete(store.projects, projectKey(p.Tenant, p.ProjectNumber))
+			} else {
+				store.projects[projectKey(p.Tenant, p.ProjectNumber)] = p
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read projects file: %w", err)
+	}
+
+	if err := store.rewrite(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// rewrite schrijft de projecten compact naar een nieuw bestand en vervangt het oude daarmee,
+// zodat een crash halverwege nooit een half bestand achterlaat. Het nieuwe bestand blijft
+// open voor save (de store is nog niet in gebruik).
+func (s *projectStore) rewrite() error {
+	tmp, err := os.OpenFile(s.cfg.File+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("open projects file: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, p := range s.projects {
+		line, err := json.Marshal(p)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("encode project %s: %w", p.ProjectNumber, err)
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write projects file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync projects file: %w", err)
+	}
+	if err := os.Rename(s.cfg.File+".tmp", s.cfg.File); err != nil {
+		tmp.Close()
+		return fmt.Errorf("replace projects file: %w", err)
+	}
+	s.file = tmp
+	return nil
+}
+
+func projectKey(tenant, projectNumber string) string {
+	return tenant + "/" + projectNumber
+}
+
+// get zoekt een project van een tenant
+func (s *projectStore) get(tenant, projectNumber string) (project, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.projects[projectKey(tenant, projectNumber)]
+	return p, ok
+}
+
+// save slaat een project op (of verwijdert het bij p.Deleted)
+func (s *projectStore) save(p project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		line, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write project: %w", err)
+		}
+	}
+	if p.Deleted {
+		delete(s.projects, projectKey(p.Tenant, p.ProjectNumber))
+	} else {
+		s.projects[projectKey(p.Tenant, p.ProjectNumber)] = p
+	}
+	return nil
+}
+
+// close sluit het bestand (bij afsluiten van de server)
+func (s *projectStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// ========================================
+// OPNAMETIJD CONTROLE
+// ========================================
+
+// checkCaptureTime vergelijkt de opnametijd uit de EXIF met het afspraakvenster van het
+// project (plus de marge). Geeft de flags voor de inspectie. Bij policy "reject" en een
+// foto buiten het venster is 422 al verstuurd en is ok false.
+func (a *app) checkCaptureTime(w http.ResponseWriter, r *http.Request, p project, photo uploadedPhoto) (flags []string, ok bool) {
+	if p.AppointmentStart == nil || p.AppointmentEnd == nil {
+		return nil, true
+	}
+	if photo.EXIF.CaptureTime == nil {
+		captureWindowChecksTotal.WithLabelValues("unknown").Inc()
+		return []string{flagCaptureTimeUnknown}, true
+	}
+
+	captured := *photo.EXIF.CaptureTime
+	tolerance := time.Duration(a.cfg.Projects.CaptureTolerance)
+	if !captured.Before(p.AppointmentStart.Add(-tolerance)) && !captured.After(p.AppointmentEnd.Add(tolerance)) {
+		captureWindowChecksTotal.WithLabelValues("inside").Inc()
+		return nil, true
+	}
+	captureWindowChecksTotal.WithLabelValues("outside").Inc()
+	addLogAttrs(r.Context(), slog.Time("captureTime", captured))
+
+	policy := p.CapturePolicy
+	if policy == "" {
+		policy = a.cfg.Projects.CapturePolicy
+	}
+	if policy != "reject" {
+		return []string{codeCaptureOutsideWindow}, true
+	}
+
+	addLogAttrs(r.Context(), slog.String("errorCode", codeCaptureOutsideWindow))
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":            "Photo was taken outside the appointment window of this project",
+		"code":             codeCaptureOutsideWindow,
+		"captureTime":      captured,
+		"appointmentStart": p.AppointmentStart,
+		"appointmentEnd":   p.AppointmentEnd,
+	})
+	return nil, false
+}
+
+// ========================================
+// PROJECT API: /api/projects/v1/{projectNumber}
+// ========================================
+
+// projectHandler: GET geeft het project, PUT legt het vast, DELETE haalt het weg (eigen tenant)
+func (a *app) projectHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	projectNumber := strings.TrimPrefix(r.URL.Path, "/api/projects/v1/")
+	if !isValidProjectNumber(projectNumber) {
+		writeError(w, http.StatusBadRequest, "Invalid projectNumber. Only letters, numbers, underscores and hyphens allowed (max 50 chars)")
+		return
+	}
+	tenant := tenantFrom(r.Context())
+	existing, found := a.projects.get(tenant, projectNumber)
+
+	switch r.Method {
+	case "GET":
+		if !found {
+			writeError(w, http.StatusNotFound, "Unknown project")
+			return
+		}
+		json.NewEncoder(w).Encode(existing)
+
+	case "PUT":
+		var p project
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&p); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		if message := p.validate(); message != "" {
+			writeError(w, http.StatusBadRequest, message)
+			return
+		}
+		p.Tenant, p.ProjectNumber, p.UpdatedAt, p.Deleted = tenant, projectNumber, time.Now().UTC(), false
+		if err := a.projects.save(p); err != nil {
+			loggerFrom(r.Context()).Error("could not store project", "projectNumber", projectNumber, "error", err)
+			writeError(w, http.StatusInternalServerError, "Could not store project")
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+
+	case "DELETE":
+		if !found {
+			writeError(w, http.StatusNotFound, "Unknown project")
+			return
+		}
+		existing.Deleted, existing.UpdatedAt = true, time.Now().UTC()
+		if err := a.projects.save(existing); err != nil {
+			loggerFrom(r.Context()).Error("could not delete project", "projectNumber", projectNumber, "error", err)
+			writeError(w, http.StatusInternalServerError, "Could not delete project")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "ONLY GET, PUT AND DELETE REQUESTS ARE ALLOWED")
+	}
+}
+
+// validate geeft een foutmelding voor de client, of "" als het project klopt
+func (p project) validate() string {
+	if (p.AppointmentStart == nil) != (p.AppointmentEnd == nil) {
+		return "appointmentStart and appointmentEnd must be set together"
+	}
+	if p.AppointmentStart != nil && !p.AppointmentEnd.After(*p.AppointmentStart) {
+		return "appointmentEnd must be after appointmentStart"
+	}
+	if p.CapturePolicy != "" && p.CapturePolicy != "flag" && p.CapturePolicy != "reject" {
+		return "capturePolicy must be flag or reject"
+	}
+	if p.Location != nil && (p.Location.Latitude < -90 || p.Location.Latitude > 90 || p.Location.Longitude < -180 || p.Location.Longitude > 180) {
+		return "location must have a latitude between -90 and 90 and a longitude between -180 and 180"
+	}
+	if p.RadiusMeters < 0 || p.RadiusMeters > maxGeofenceRadiusMeters {
+		return fmt.Sprintf("radiusMeters must be between 0 and %d", maxGeofenceRadiusMeters)
+	}
+	if p.RadiusMeters > 0 && p.Location == nil {
+		return "radiusMeters requires a location"
+	}
+	return ""
+}
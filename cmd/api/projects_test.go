@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCaptureTime(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Hour)
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name      string
+		window    bool
+		policy    string // van het project, leeg = projects.capturePolicy (flag)
+		captured  *time.Time
+		wantFlags []string
+		wantCode  int // 0 = niet geweigerd
+	}{
+		{"no window", false, "", at(start.Add(-48 * time.Hour)), nil, 0},
+		{"inside", true, "", at(start.Add(time.Hour)), nil, 0},
+		{"inside the tolerance before", true, "", at(start.Add(-2 * time.Hour)), nil, 0},
+		{"inside the tolerance after", true, "reject", at(end.Add(2 * time.Hour)), nil, 0},
+		{"unknown", true, "reject", nil, []string{flagCaptureTimeUnknown}, 0},
+		{"outside, flag", true, "", at(end.Add(3 * time.Hour)), []string{codeCaptureOutsideWindow}, 0},
+		{"outside, project flags", true, "flag", at(start.Add(-3 * time.Hour)), []string{codeCaptureOutsideWindow}, 0},
+		{"outside, reject", true, "reject", at(start.Add(-3 * time.Hour)), nil, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			a.cfg.Projects.CapturePolicy, a.cfg.Projects.CaptureTolerance = "flag", duration(2*time.Hour)
+			p := project{CapturePolicy: tt.policy}
+			if tt.window {
+				p.AppointmentStart, p.AppointmentEnd = &start, &end
+			}
+
+			rec := httptest.NewRecorder()
+			flags, ok := a.checkCaptureTime(rec, httptest.NewRequest(http.MethodPost, "/", nil), p, uploadedPhoto{EXIF: exifData{CaptureTime: tt.captured}})
+			if ok != (tt.wantCode == 0) {
+				t.Fatalf("ok = %v, want rejected %v", ok, tt.wantCode != 0)
+			}
+			if !slices.Equal(flags, tt.wantFlags) {
+				t.Errorf("flags = %v, want %v", flags, tt.wantFlags)
+			}
+			if tt.wantCode != 0 && (rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), codeCaptureOutsideWindow)) {
+				t.Errorf("status = %d, body %s, want %d %s", rec.Code, rec.Body, tt.wantCode, codeCaptureOutsideWindow)
+			}
+		})
+	}
+}
+
+func TestProjectStoreRewritesFile(t *testing.T) {
+	cfg := defaultConfig().Projects
+	cfg.File = filepath.Join(t.TempDir(), "projects.jsonl")
+	lines := `{"tenant":"acme","projectNumber":"P1","capturePolicy":"flag"}` + "\n" +
+		`{"tenant":"acme","projectNumber":"P2"}` + "\n" +
+		`{"tenant":"acme","projectNumber":"P2","deleted":true}` + "\n" +
+		`{"tenant":"acme","projectNumber":"P1","capturePolicy":"reject"}` + "\n"
+	if err := os.WriteFile(cfg.File, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openProjectStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.save(project{Tenant: "acme", ProjectNumber: "P3"}); err != nil {
+		t.Fatal(err)
+	}
+	store.close()
+
+	// Compact: de laatste versie van P1, geen P2, en wat daarna opgeslagen is
+	store, err = openProjectStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	if p, ok := store.get("acme", "P1"); !ok || p.CapturePolicy != "reject" {
+		t.Errorf("P1 = %+v, want the last version", p)
+	}
+	if _, ok := store.get("acme", "P2"); ok {
+		t.Error("deleted P2 came back")
+	}
+	if _, ok := store.get("acme", "P3"); !ok {
+		t.Error("P3 saved after the rewrite is missing")
+	}
+	if _, err := os.Stat(cfg.File + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// Onleesbaar bestand: een fout, en het bestand blijft zoals het was
+	if err := os.WriteFile(cfg.File, []byte("{broken\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openProjectStore(cfg); err == nil {
+		t.Error("broken projects file was accepted")
+	}
+	if data, _ := os.ReadFile(cfg.File); string(data) != "{broken\n" {
+		t.Errorf("broken file was rewritten to %q", data)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// visionProvider is één model/endpoint dat een foto kan beoordelen
+type visionProvider interface {
+	name() string
+	analyze(ctx context.Context, req visionRequest) (providerAnswer, error)
+}
+
+// visionResult is het antwoord van het model plus de provider die het gaf
+type visionResult struct {
+	Content  string
+	Provider string
+	Model    string
+	Usage    tokenUsage
+}
+
+// visionRouter kiest per check een keten van providers en valt terug op de
+// volgende provider als de vorige faalt (down, rate limited of foto geweigerd)
+type visionRouter struct {
+	defaultChain []visionProvider
+	chains       map[string][]visionProvider // check id -> keten
+}
+
+// chainFor geeft de providerketen voor een check (of de standaard keten)
+func (vr *visionRouter) chainFor(check string) []visionProvider {
+	if chain, ok := vr.chains[check]; ok && len(chain) > 0 {
+		return chain
+	}
+	return vr.defaultChain
+}
+
+// analyze probeert de providers van de check in volgorde tot er één antwoordt
+func (vr *visionRouter) analyze(ctx context.Context, req visionRequest) (visionResult, error) {
+	chain := vr.chainFor(req.Check)
+	if len(chain) == 0 {
+		return visionResult{}, errors.New("no vision providers configured")
+	}
+
+	analysesInFlight.Inc()
+	defer analysesInFlight.Dec()
+
+	ctx, span := tracer.Start(ctx, "vision.analyze", trace.WithAttributes(attribute.String("apiq.check", req.Check)))
+	defer span.End()
+
+	var lastErr error
+	for i, provider := range chain {
+		answer, err := provider.analyze(ctx, req)
+		if err == nil {
+			span.SetAttributes(attribute.String("apiq.provider", provider.name()), attribute.Int("apiq.fallbacks", i))
+			if i > 0 {
+				loggerFrom(ctx).Info("answered by fallback provider", "check", req.Check, "provider", provider.name())
+			}
+			return visionResult{Content: answer.Content, Provider: provider.name(), Model: answer.Model, Usage: answer.Usage}, nil
+		}
+
+		// Client is weg of request is afgebroken: geen zin om verder te proberen
+		if ctx.Err() != nil {
+			return visionResult{}, err
+		}
+
+		lastErr = err
+		logger := loggerFrom(ctx).With("check", req.Check, "provider", provider.name(), "error", err)
+		if i < len(chain)-1 {
+			logger.Warn("provider failed, trying next", "next", chain[i+1].name())
+		} else {
+			logger.Warn("provider failed, no fallback left")
+		}
+	}
+
+	span.RecordError(lastErr)
+	span.SetStatus(codes.Error, "all providers failed")
+	return visionResult{}, lastErr
+}
+
+// ready geeft een fout als geen enkele provider bereikbaar is (alle circuit breakers open)
+func (vr *visionRouter) ready() error {
+	providers := append([]visionProvider{}, vr.defaultChain...)
+	for _, chain := range vr.chains {
+		providers = append(providers, chain...)
+	}
+
+	for _, p := range providers {
+		if client, ok := p.(*visionClient); !ok || !client.breaker.isOpen() {
+			return nil
+		}
+	}
+	return errors.New("all AI providers unavailable (circuit breakers open)")
+}
+
+// newVisionRouter bouwt de providers en de ketens per check uit de config.
+// Een check met een eigen model krijgt dat model eerst en valt daarna terug
+// op de standaard keten.
+func newVisionRouter(cfg config) *visionRouter {
+	providers := make(map[string]visionProvider)
+	var all []visionProvider
+	addProvider := func(p providerConfig) visionProvider {
+		if p.APIKey == "" {
+			p.APIKey = cfg.OpenAIAPIKey
+		}
+		client := newVisionClient(p, cfg.Retry, cfg.CircuitBreaker)
+		providers[p.Name] = client
+		return client
+	}
+	for _, p := range cfg.Providers {
+		all = append(all, addProvider(p))
+	}
+
+	chainOf := func(names []string) []visionProvider {
+		var chain []visionProvider
+		for _, name := range names {
+			chain = append(chain, providers[name])
+		}
+		return chain
+	}
+
+	router := &visionRouter{defaultChain: chainOf(cfg.ProviderChain), chains: make(map[string][]visionProvider)}
+	if len(router.defaultChain) == 0 {
+		router.defaultChain = all
+	}
+
+	for id, check := range cfg.Checks {
+		switch {
+		case len(check.Providers) > 0:
+			router.chains[id] = chainOf(check.Providers)
+		case check.Model != "":
+			primary, ok := providers[check.Model]
+			if !ok {
+				primary = addProvider(providerConfig{Name: check.Model, Model: check.Model})
+			}
+			chain := []visionProvider{primary}
+			for _, p := range router.defaultChain {
+				if p != primary {
+					chain = append(chain, p)
+				}
+			}
+			router.chains[id] = chain
+		}
+	}
+	return router
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider antwoordt altijd hetzelfde, zonder netwerk
+type fakeProvider struct {
+	id      string
+	content string
+	err     error
+	calls   atomic.Int32
+}
+
+func (f *fakeProvider) name() string { return f.id }
+
+func (f *fakeProvider) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	f.calls.Add(1)
+	if f.err != nil {
+		return providerAnswer{}, f.err
+	}
+	return providerAnswer{Content: f.content, Model: f.id + "-model", Usage: tokenUsage{PromptTokens: 100, CompletionTokens: 2}}, nil
+}
+
+// newTestApp maakt een app met de standaard config, stores in memory en de gegeven providerketen
+func newTestApp(t testing.TB, chain ...visionProvider) *app {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.Relevance.Enabled = false
+
+	inspections, err := openInspectionStore("", cfg.Storage.MaxRecentInspections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects, err := openProjectStore(cfg.Projects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas, err := newQuotaGuard(cfg, inspections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &app{
+		cfg:         cfg,
+		vision:      &visionRouter{defaultChain: chain, chains: make(map[string][]visionProvider)},
+		tenants:     newTenantDirectory(nil),
+		inspections: inspections,
+		quotas:      quotas,
+		idempotency: newIdempotencyStore(time.Duration(cfg.Idempotency.TTL)),
+		uploads:     newByteLimiter(cfg.Upload.MaxInFlightBytes),
+		projects:    projects,
+	}
+}
+
+// testJPEG is een kleine JPEG met een verloop (geen effen vlak)
+func testJPEG(t testing.TB, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// photoRequest is een multipart POST met één of meer foto's
+func photoRequest(t testing.TB, url string, photos ...[]byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, photo := range photos {
+		part, err := form.CreateFormFile("photo", "photo.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(photo)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, url, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// upstream is een OpenAI-compatibel endpoint dat handler gebruikt voor elke call
+func upstream(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		srv.CloseClientConnections() // laat hangende handlers stoppen
+		srv.Close()
+	})
+	return srv.URL + "/v1"
+}
+
+// testClient is een echte visionClient (retries, breaker, timeout) tegen baseURL
+func testClient(name, baseURL string) *visionClient {
+	return newVisionClient(
+		providerConfig{Name: name, Model: name + "-model", BaseURL: baseURL, APIKey: "test"},
+		retryConfig{MaxAttempts: 2, BaseDelay: duration(time.Millisecond), MaxDelay: duration(10 * time.Millisecond), AttemptTimeout: duration(100 * time.Millisecond)},
+		breakerConfig{Threshold: 1, Cooldown: duration(time.Minute)},
+	)
+}
+
+func failWith(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"message":"upstream trouble","type":"server_error"}}`))
+	}
+}
+
+func hang(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body) // pas daarna merkt de server dat de client weg is
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestFailoverToNextProvider(t *testing.T) {
+	check, _ := findCheck("powerCordInSocket")
+
+	tests := []struct {
+		name    string
+		primary func(t *testing.T) *visionClient
+	}{
+		{"primary returns 5xx", func(t *testing.T) *visionClient {
+			return testClient("primary", upstream(t, failWith(http.StatusBadGateway)))
+		}},
+		{"primary times out", func(t *testing.T) *visionClient {
+			return testClient("primary", upstream(t, hang))
+		}},
+		{"primary breaker open", func(t *testing.T) *visionClient {
+			client := testClient("primary", upstream(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("primary called while its breaker is open")
+			}))
+			client.breaker.failure() // threshold 1: open
+			return client
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallback := &fakeProvider{id: "fallback", content: "PASS"}
+			a := newTestApp(t, tt.primary(t), fallback)
+
+			rec := httptest.NewRecorder()
+			a.silverHandler(check)(rec, photoRequest(t, "/api/laundry/silver/v1/powerCordInSocket", testJPEG(t, 64, 48)))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("X-Provider"); got != "fallback" {
+				t.Errorf("X-Provider = %q, want fallback", got)
+			}
+			if fallback.calls.Load() != 1 {
+				t.Errorf("fallback called %d times, want 1", fallback.calls.Load())
+			}
+			recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+			if len(recorded) != 1 {
+				t.Fatalf("%d inspections recorded, want 1", len(recorded))
+			}
+			if recorded[0].Provider != "fallback" || recorded[0].Model != "fallback-model" || recorded[0].Result != "PASS" {
+				t.Errorf("inspection = %s/%s/%s, want fallback/fallback-model/PASS", recorded[0].Provider, recorded[0].Model, recorded[0].Result)
+			}
+		})
+	}
+}
+
+func TestAllProvidersFail(t *testing.T) {
+	check, _ := findCheck("powerCordInSocket")
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantCode   string
+	}{
+		{"unavailable", failWith(http.StatusServiceUnavailable), http.StatusServiceUnavailable, codeUpstreamUnavailable},
+		{"timeout", hang, http.StatusGatewayTimeout, codeUpstreamTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, testClient("primary", upstream(t, tt.handler)), testClient("secondary", upstream(t, tt.handler)))
+
+			rec := httptest.NewRecorder()
+			a.silverHandler(check)(rec, photoRequest(t, "/api/laundry/silver/v1/powerCordInSocket", testJPEG(t, 64, 48)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != tt.wantCode {
+				t.Errorf("code = %q, want %q", body["code"], tt.wantCode)
+			}
+			if n := len(a.inspections.query(defaultTenant, func(inspection) bool { return true })); n != 0 {
+				t.Errorf("%d inspections recorded for a failed analysis, want 0", n)
+			}
+		})
+	}
+}
+
+func TestCanceledCallLeavesBreakerAlone(t *testing.T) {
+	client := testClient("primary", upstream(t, hang))
+	client.breaker.failure() // open
+	client.breaker.openedAt = time.Now().Add(-2 * time.Minute)
+
+	// Half-open proefrequest die de client afbreekt
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := client.analyze(ctx, visionRequest{Check: "powerCordInSocket"}); err == nil {
+		t.Fatal("expected an error for a canceled call")
+	}
+	if state := client.breaker.currentState(); state != breakerHalfOpen {
+		t.Errorf("breaker state = %d after a canceled probe, want half-open", state)
+	}
+	if _, ok := client.breaker.allow(); !ok {
+		t.Error("breaker does not allow a new probe after the canceled one")
+	}
+}
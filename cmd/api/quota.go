@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========================================
+// QUOTA'S EN BUDGETTEN PER TENANT (per kalendermaand, UTC)
+// ========================================
+
+const (
+	codeQuotaExceeded  = "QUOTA_EXCEEDED"  // 429: maximum aantal inspecties deze maand bereikt
+	codeBudgetExceeded = "BUDGET_EXCEEDED" // 402: maximum provider kosten deze maand bereikt
+)
+
+// quotaOverride is een uitzondering die een admin voor één maand zet,
+// bijv. 500 extra inspecties of helemaal geen limiet
+type quotaOverride struct {
+	Tenant           string    `json:"tenant,omitempty"`
+	Month            string    `json:"month"` // "2025-10", leeg = huidige maand
+	ExtraInspections int       `json:"extraInspections"`
+	ExtraBudgetUSD   float64   `json:"extraBudgetUsd"`
+	Unlimited        bool      `json:"unlimited"`
+	Reason           string    `json:"reason,omitempty"`
+	SetAt            time.Time `json:"setAt"`
+	Deleted          bool      `json:"deleted,omitempty"` // alleen in het bestand: override is weggehaald
+}
+
+// quotaStatus is het verbruik en de limieten van een tenant in een maand (0 = onbeperkt)
+type quotaStatus struct {
+	Tenant         string         `json:"tenant"`
+	Month          string         `json:"month"`
+	Inspections    int            `json:"inspections"` // inclusief analyses die nu lopen
+	MaxInspections int            `json:"maxInspections"`
+	SpendUSD       float64        `json:"spendUsd"`
+	PendingUSD     float64        `json:"pendingUsd"` // geschatte kosten van analyses die nu lopen
+	BudgetUSD      float64        `json:"budgetUsd"`
+	ResetsAt       time.Time      `json:"resetsAt"`
+	Override       *quotaOverride `json:"override,omitempty"`
+}
+
+// quotaGuard controleert de quota's voordat een foto naar het model gaat
+type quotaGuard struct {
+	cfg     quotasConfig
+	tenants map[string]tenantConfig
+	store   *inspectionStore
+	client  *http.Client
+
+	mu          sync.Mutex
+	pending     map[string]int           // tenant -> lopende analyses (nog niet opgeslagen)
+	pendingCost map[string]float64       // tenant -> geschatte kosten van die analyses
+	overrides   map[string]quotaOverride // tenant/maand -> override (zie overrideKey)
+	notified    map[string]bool          // tenant/maand/soort -> webhook al verstuurd
+	file        *os.File                 // overrides bestand, nil = alleen in memory
+}
+
+// newQuotaGuard maakt de guard en laadt de overrides uit cfg.Quotas.OverridesFile
+func newQuotaGuard(cfg config, store *inspectionStore) (*quotaGuard, error) {
+	tenants := make(map[string]tenantConfig)
+	for _, t := range cfg.Tenants {
+		tenants[t.ID] = t
+	}
+	q := &quotaGuard{
+		cfg:         cfg.Quotas,
+		tenants:     tenants,
+		store:       store,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		pending:     make(map[string]int),
+		pendingCost: make(map[string]float64),
+		overrides:   make(map[string]quotaOverride),
+		notified:    make(map[string]bool),
+	}
+	path := cfg.Quotas.OverridesFile
+	if path == "" {
+		return q, nil
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		line := 0
+		for scanner.Scan() {
+			line++
+			var override quotaOverride
+			if err := json.Unmarshal(scanner.Bytes(), &override); err != nil {
+				return nil, fmt.Errorf("quota overrides file %s line %d: %w", path, line, err)
+			}
+			q.applyOverrideLocked(override)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read quota overrides file: %w", err)
+	}
+
+	// Compact herschrijven: alleen de overrides van deze en latere maanden gelden nog
+	current := time.Now().UTC().Format("2006-01")
+	for key, override := range q.overrides {
+		if override.Month < current {
+			delete(q.overrides, key)
+		}
+	}
+	file, err := rewriteOverrides(path, q.overrides)
+	if err != nil {
+		return nil, err
+	}
+	q.file = file
+	return q, nil
+}
+
+// rewriteOverrides schrijft de overrides naar een nieuw bestand en vervangt het oude daarmee,
+// zodat een crash halverwege nooit een half bestand achterlaat. Het nieuwe bestand blijft open
+// voor de volgende wijzigingen.
+func rewriteOverrides(path string, overrides map[string]quotaOverride) (*os.File, error) {
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open quota overrides file: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, override := range overrides {
+		line, err := json.Marshal(override)
+		if err != nil {
+			tmp.Close()
+			return nil, fmt.Errorf("encode quota override: %w", err)
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("write quota overrides file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("sync quota overrides file: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("replace quota overrides file: %w", err)
+	}
+	return tmp, nil
+}
+
+// overrideKey is de sleutel van een override, bijv. "acme/2025-10"
+func overrideKey(tenant, month string) string {
+	return tenant + "/" + month
+}
+
+// applyOverrideLocked zet een override (of het weghalen ervan) in memory (q.mu moet vast zijn,
+// of de guard is nog niet in gebruik). Een weggehaalde override zonder maand (oudere bestanden)
+// haalt alle maanden van de tenant weg.
+func (q *quotaGuard) applyOverrideLocked(override quotaOverride) {
+	switch {
+	case !override.Deleted:
+		q.overrides[overrideKey(override.Tenant, override.Month)] = override
+	case override.Month != "":
+		delete(q.overrides, overrideKey(override.Tenant, override.Month))
+	default:
+		for key, existing := range q.overrides {
+			if existing.Tenant == override.Tenant {
+				delete(q.overrides, key)
+			}
+		}
+	}
+}
+
+// saveOverrideLocked schrijft een override (of het weghalen ervan) naar het bestand en zet hem in memory (q.mu moet vast zijn)
+func (q *quotaGuard) saveOverrideLocked(override quotaOverride) error {
+	if q.file != nil {
+		line, err := json.Marshal(override)
+		if err != nil {
+			return err
+		}
+		if _, err := q.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write quota override: %w", err)
+		}
+	}
+	q.applyOverrideLocked(override)
+	return nil
+}
+
+// statusLocked berekent de status van een tenant (q.mu moet vast zijn)
+func (q *quotaGuard) statusLocked(tenant string, now time.Time) quotaStatus {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	used := q.store.monthTotals(tenant, now)
+	limits := q.tenants[tenant]
+
+	status := quotaStatus{
+		Tenant:         tenant,
+		Month:          month.Format("2006-01"),
+		Inspections:    used.Inspections + q.pending[tenant],
+		MaxInspections: limits.MonthlyInspections,
+		SpendUSD:       used.CostUSD,
+		PendingUSD:     q.pendingCost[tenant],
+		BudgetUSD:      limits.MonthlyBudgetUSD,
+		ResetsAt:       month.AddDate(0, 1, 0),
+	}
+
+	if override, ok := q.overrides[overrideKey(tenant, status.Month)]; ok {
+		status.Override = &override
+		switch {
+		case override.Unlimited:
+			status.MaxInspections, status.BudgetUSD = 0, 0
+		default:
+			if status.MaxInspections > 0 {
+				status.MaxInspections += override.ExtraInspections
+			}
+			if status.BudgetUSD > 0 {
+				status.BudgetUSD += override.ExtraBudgetUSD
+			}
+		}
+	}
+	return status
+}
+
+// estimateLocked schat de kosten van één analyse: het gemiddelde van de tenant deze maand,
+// of QUOTA_ESTIMATED_COST_USD zolang er nog niets verbruikt is (q.mu moet vast zijn)
+func (q *quotaGuard) estimateLocked(tenant string, now time.Time) float64 {
+	used := q.store.monthTotals(tenant, now)
+	if used.Inspections > 0 && used.CostUSD > 0 {
+		return used.CostUSD / float64(used.Inspections)
+	}
+	return q.cfg.EstimatedCostUSD
+}
+
+// reserve controleert de quota's en reserveert een inspectie. Bij een overschreden
+// limiet is de error response al verstuurd. release moet na de analyse (en het opslaan van
+// de inspectie met de echte kosten) aangeroepen worden. Lopende analyses tellen met hun
+// geschatte kosten mee voor het budget, zodat gelijktijdige requests er niet samen overheen gaan.
+func (q *quotaGuard) reserve(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	tenant := tenantFrom(r.Context())
+	now := time.Now().UTC()
+
+	q.mu.Lock()
+	status := q.statusLocked(tenant, now)
+	switch {
+	case status.MaxInspections > 0 && status.Inspections >= status.MaxInspections:
+		q.mu.Unlock()
+		q.notify(r.Context(), "quota.hard_limit", status)
+		writeQuotaError(w, r, status, codeQuotaExceeded)
+		return nil, false
+	case status.BudgetUSD > 0 && status.SpendUSD+status.PendingUSD >= status.BudgetUSD:
+		q.mu.Unlock()
+		q.notify(r.Context(), "quota.hard_limit", status)
+		writeQuotaError(w, r, status, codeBudgetExceeded)
+		return nil, false
+	}
+	estimate := q.estimateLocked(tenant, now)
+	q.pending[tenant]++
+	q.pendingCost[tenant] += estimate
+	q.mu.Unlock()
+
+	// Deze inspectie telt al mee voor de headers en de soft limit
+	status.Inspections++
+	status.PendingUSD += estimate
+	if status.MaxInspections > 0 {
+		w.Header().Set("X-Quota-Inspections-Remaining", strconv.Itoa(status.MaxInspections-status.Inspections))
+	}
+	if status.BudgetUSD > 0 {
+		remaining := status.BudgetUSD - status.SpendUSD - status.PendingUSD
+		w.Header().Set("X-Quota-Budget-Remaining-USD", strconv.FormatFloat(math.Max(remaining, 0), 'f', 2, 64))
+	}
+	if warning := q.softLimitWarning(status); warning != "" {
+		w.Header().Set("X-Quota-Warning", warning)
+		q.notify(r.Context(), "quota.soft_limit", status)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// De echte kosten staan nu in de store (of er was geen analyse)
+			q.mu.Lock()
+			if q.pending[tenant]--; q.pending[tenant] <= 0 {
+				delete(q.pending, tenant)
+				delete(q.pendingCost, tenant) // geen afrondingsresten
+			} else {
+				q.pendingCost[tenant] -= estimate
+			}
+			q.mu.Unlock()
+		})
+	}, true
+}
+
+// softLimitWarning geeft een waarschuwing als de tenant over de soft limit (bijv. 80%) zit
+func (q *quotaGuard) softLimitWarning(status quotaStatus) string {
+	var warnings []string
+	if status.MaxInspections > 0 && float64(status.Inspections) >= q.cfg.SoftLimitRatio*float64(status.MaxInspections) {
+		warnings = append(warnings, fmt.Sprintf("%d of %d monthly inspections used", status.Inspections, status.MaxInspections))
+	}
+	if spend := status.SpendUSD + status.PendingUSD; status.BudgetUSD > 0 && spend >= q.cfg.SoftLimitRatio*status.BudgetUSD {
+		warnings = append(warnings, fmt.Sprintf("%.2f of %.2f USD monthly budget used", spend, status.BudgetUSD))
+	}
+	return strings.Join(warnings, "; ")
+}
+
+// writeQuotaError stuurt 429 (inspecties) of 402 (budget) met de limiet en wanneer hij reset
+func writeQuotaError(w http.ResponseWriter, r *http.Request, status quotaStatus, code string) {
+	quotaRejectionsTotal.WithLabelValues(status.Tenant, code).Inc()
+	addLogAttrs(r.Context(), slog.String("errorCode", code))
+
+	body := map[string]any{
+		"code":     code,
+		"tenant":   status.Tenant,
+		"month":    status.Month,
+		"resetsAt": status.ResetsAt,
+	}
+	httpStatus := http.StatusTooManyRequests
+	if code == codeQuotaExceeded {
+		body["error"] = fmt.Sprintf("Monthly inspection quota exceeded (%d inspections)", status.MaxInspections)
+		body["limit"] = status.MaxInspections
+		body["used"] = status.Inspections
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(status.ResetsAt).Seconds()))))
+	} else {
+		httpStatus = http.StatusPaymentRequired
+		body["error"] = fmt.Sprintf("Monthly budget exceeded (%.2f USD)", status.BudgetUSD)
+		body["limit"] = status.BudgetUSD
+		body["used"] = status.SpendUSD
+	}
+
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(body)
+}
+
+// notify stuurt één keer per tenant/maand/soort een webhook (op de achtergrond)
+func (q *quotaGuard) notify(ctx context.Context, event string, status quotaStatus) {
+	key := status.Tenant + "/" + status.Month + "/" + event
+	q.mu.Lock()
+	if q.notified[key] {
+		q.mu.Unlock()
+		return
+	}
+	q.notified[key] = true
+	q.mu.Unlock()
+
+	logger := loggerFrom(ctx).With("event", event, "tenant", status.Tenant)
+	logger.Warn("tenant reached quota limit", "inspections", status.Inspections, "spendUsd", status.SpendUSD)
+	if q.cfg.WebhookURL == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]any{"event": event, "status": status})
+	go func() {
+		resp, err := q.client.Post(q.cfg.WebhookURL, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			logger.Error("quota webhook failed", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.Error("quota webhook failed", "status", resp.StatusCode)
+		}
+	}()
+}
+
+// ========================================
+// ADMIN: /api/admin/v1/quotas/{tenant}
+// ========================================
+
+// registerAdminRoutes registreert de admin endpoints (alleen als er een admin key is)
+func (q *quotaGuard) registerAdminRoutes(mux *http.ServeMux) {
+	if q.cfg.AdminAPIKey == "" {
+		return
+	}
+	// GET: status, PUT: override zetten, DELETE: override weghalen
+	mux.HandleFunc("/api/admin/v1/quotas/", q.requireAdmin(q.adminQuotaHandler))
+}
+
+// requireAdmin laat alleen requests met de admin key door
+func (q *quotaGuard) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	want := sha256.Sum256([]byte(q.cfg.AdminAPIKey))
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := sha256.Sum256([]byte(apiKeyFromRequest(r)))
+		if subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusUnauthorized, "Invalid or missing admin API key")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (q *quotaGuard) adminQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tenant := strings.TrimPrefix(r.URL.Path, "/api/admin/v1/quotas/")
+	if _, ok := q.tenants[tenant]; !ok {
+		writeError(w, http.StatusNotFound, "Unknown tenant")
+		return
+	}
+	now := time.Now().UTC()
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var override quotaOverride
+		if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		if override.Month == "" {
+			override.Month = now.Format("2006-01")
+		}
+		if _, err := time.Parse("2006-01", override.Month); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid month, expected YYYY-MM")
+			return
+		}
+		if override.Month < now.Format("2006-01") {
+			writeError(w, http.StatusBadRequest, "Month is in the past")
+			return
+		}
+		if override.ExtraInspections < 0 || override.ExtraBudgetUSD < 0 {
+			writeError(w, http.StatusBadRequest, "Extra inspections and budget must not be negative")
+			return
+		}
+		override.Tenant, override.SetAt, override.Deleted = tenant, now, false
+		q.mu.Lock()
+		err := q.saveOverrideLocked(override)
+		q.mu.Unlock()
+		if err != nil {
+			loggerFrom(r.Context()).Error("saving quota override failed", "tenant", tenant, "error", err)
+			writeError(w, http.StatusInternalServerError, "Could not save quota override")
+			return
+		}
+		loggerFrom(r.Context()).Info("quota override set", "tenant", tenant, "month", override.Month, "reason", override.Reason)
+	case "DELETE":
+		// ?month=2025-11 haalt de override van een andere maand weg, standaard de huidige
+		month := r.URL.Query().Get("month")
+		if month == "" {
+			month = now.Format("2006-01")
+		}
+		if _, err := time.Parse("2006-01", month); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid month, expected YYYY-MM")
+			return
+		}
+		q.mu.Lock()
+		err := q.saveOverrideLocked(quotaOverride{Tenant: tenant, Month: month, SetAt: now, Deleted: true})
+		q.mu.Unlock()
+		if err != nil {
+			loggerFrom(r.Context()).Error("removing quota override failed", "tenant", tenant, "error", err)
+			writeError(w, http.StatusInternalServerError, "Could not remove quota override")
+			return
+		}
+		loggerFrom(r.Context()).Info("quota override removed", "tenant", tenant, "month", month)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "ONLY GET, PUT AND DELETE REQUESTS ARE ALLOWED")
+		return
+	}
+
+	q.mu.Lock()
+	status := q.statusLocked(tenant, now)
+	q.mu.Unlock()
+	json.NewEncoder(w).Encode(status)
+}
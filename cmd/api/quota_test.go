@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tenantRequest is een request van tenant, zoals na de API key middleware
+func tenantRequest(tenant string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/laundry/gold/v1/powerCordInSocket", nil)
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant))
+}
+
+func TestReserveCountsPendingCostAgainstBudget(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Tenants = []tenantConfig{{ID: "acme", MonthlyBudgetUSD: 1}}
+	cfg.Quotas.EstimatedCostUSD = 0.34
+	store, _ := openInspectionStore("", 10)
+	q, err := newQuotaGuard(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Vier gelijktijdige analyses: de vierde past niet meer binnen 1 USD
+	var releases []func()
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		release, ok := q.reserve(rec, tenantRequest("acme"))
+		if want := i < 4-1; ok != want {
+			t.Fatalf("reservation %d: ok = %v, want %v (status %d)", i+1, ok, want, rec.Code)
+		}
+		if ok {
+			releases = append(releases, release)
+		} else if rec.Code != http.StatusPaymentRequired {
+			t.Errorf("status = %d, want 402", rec.Code)
+		}
+	}
+
+	// De eerste blijkt goedkoper dan geschat; na release telt alleen de echte prijs
+	store.add(inspection{ID: newInspectionID(), Tenant: "acme", CostUSD: 0.05, CreatedAt: time.Now().UTC()})
+	releases[0]()
+	releases[0]() // twee keer vrijgeven telt één keer
+	q.mu.Lock()
+	status := q.statusLocked("acme", time.Now().UTC())
+	q.mu.Unlock()
+	if status.SpendUSD != 0.05 || status.PendingUSD < 0.67 || status.PendingUSD > 0.69 {
+		t.Errorf("spend %.2f, pending %.2f, want 0.05 and 0.68", status.SpendUSD, status.PendingUSD)
+	}
+	for _, release := range releases[1:] {
+		release()
+	}
+	q.mu.Lock()
+	status = q.statusLocked("acme", time.Now().UTC())
+	q.mu.Unlock()
+	if status.PendingUSD != 0 || status.Inspections != 1 {
+		t.Errorf("after release: pending %.2f, %d inspections, want 0 and 1", status.PendingUSD, status.Inspections)
+	}
+}
+
+func TestQuotaOverridesSurviveRestart(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Tenants = []tenantConfig{{ID: "acme", MonthlyInspections: 10}, {ID: "globex", MonthlyInspections: 10}}
+	cfg.Quotas.AdminAPIKey = "admin"
+	cfg.Quotas.OverridesFile = filepath.Join(t.TempDir(), "overrides.jsonl")
+	store, _ := openInspectionStore("", 10)
+
+	q, err := newQuotaGuard(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := func(method, tenant, body string) {
+		r := httptest.NewRequest(method, "/api/admin/v1/quotas/"+tenant, strings.NewReader(body))
+		r.Header.Set("X-API-Key", "admin")
+		rec := httptest.NewRecorder()
+		q.requireAdmin(q.adminQuotaHandler)(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d, body %s", method, tenant, rec.Code, rec.Body)
+		}
+	}
+	admin(http.MethodPut, "acme", `{"extraInspections":5,"reason":"pilot"}`)
+	admin(http.MethodPut, "globex", `{"unlimited":true}`)
+	admin(http.MethodDelete, "globex", "")
+
+	// Herstart: zelfde bestand, nieuwe guard
+	q, err = newQuotaGuard(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	q.mu.Lock()
+	acme, globex := q.statusLocked("acme", now), q.statusLocked("globex", now)
+	q.mu.Unlock()
+	if acme.MaxInspections != 15 || acme.Override == nil || acme.Override.Reason != "pilot" {
+		t.Errorf("acme after restart: max %d, override %+v, want 15 with reason pilot", acme.MaxInspections, acme.Override)
+	}
+	if globex.Override != nil || globex.MaxInspections != 10 {
+		t.Errorf("globex after restart: max %d, override %+v, want 10 without override", globex.MaxInspections, globex.Override)
+	}
+}
+
+func TestQuotaOverridesPerMonth(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Tenants = []tenantConfig{{ID: "acme", MonthlyInspections: 10}}
+	cfg.Quotas.AdminAPIKey = "admin"
+	cfg.Quotas.OverridesFile = filepath.Join(t.TempDir(), "overrides.jsonl")
+	store, _ := openInspectionStore("", 10)
+	q, err := newQuotaGuard(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := func(method, path, body string) int {
+		r := httptest.NewRequest(method, "/api/admin/v1/quotas/"+path, strings.NewReader(body))
+		r.Header.Set("X-API-Key", "admin")
+		rec := httptest.NewRecorder()
+		q.requireAdmin(q.adminQuotaHandler)(rec, r)
+		return rec.Code
+	}
+
+	now := time.Now().UTC()
+	next := now.AddDate(0, 1, 0).Format("2006-01")
+	if code := admin(http.MethodPut, "acme", `{"extraInspections":5}`); code != http.StatusOK {
+		t.Fatalf("PUT current month: status %d", code)
+	}
+	// Een override voor volgende maand laat die van deze maand staan
+	if code := admin(http.MethodPut, "acme", `{"month":"`+next+`","unlimited":true}`); code != http.StatusOK {
+		t.Fatalf("PUT next month: status %d", code)
+	}
+	if code := admin(http.MethodPut, "acme", `{"month":"2020-01","unlimited":true}`); code != http.StatusBadRequest {
+		t.Errorf("PUT past month: status %d, want 400", code)
+	}
+
+	q, err = newQuotaGuard(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.mu.Lock()
+	current, later := q.statusLocked("acme", now), q.statusLocked("acme", now.AddDate(0, 1, 0))
+	q.mu.Unlock()
+	if current.MaxInspections != 15 {
+		t.Errorf("this month: max %d, want 15", current.MaxInspections)
+	}
+	if later.Override == nil || !later.Override.Unlimited {
+		t.Errorf("next month: override %+v, want unlimited", later.Override)
+	}
+
+	// Weghalen per maand
+	if code := admin(http.MethodDelete, "acme?month="+next, ""); code != http.StatusOK {
+		t.Fatalf("DELETE next month: status %d", code)
+	}
+	q.mu.Lock()
+	current, later = q.statusLocked("acme", now), q.statusLocked("acme", now.AddDate(0, 1, 0))
+	q.mu.Unlock()
+	if current.MaxInspections != 15 || later.Override != nil {
+		t.Errorf("after DELETE next month: this month max %d, next month override %+v", current.MaxInspections, later.Override)
+	}
+}
+
+func TestQuotaOverridesCompactionReplacesFile(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Tenants = []tenantConfig{{ID: "acme", MonthlyInspections: 10}}
+	cfg.Quotas.OverridesFile = filepath.Join(t.TempDir(), "overrides.jsonl")
+	month := time.Now().UTC().Format("2006-01")
+	lines := `{"tenant":"acme","month":"2020-01","unlimited":true}` + "\n" +
+		`{"tenant":"acme","month":"` + month + `","extraInspections":5}` + "\n" +
+		`{"tenant":"acme","deleted":true}` + "\n" +
+		`{"tenant":"acme","month":"` + month + `","extraInspections":7}` + "\n"
+	if err := os.WriteFile(cfg.Quotas.OverridesFile, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := openInspectionStore("", 10)
+	if _, err := newQuotaGuard(cfg, store); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alleen de override die nog geldt, en geen tijdelijk bestand
+	data, err := os.ReadFile(cfg.Quotas.OverridesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); strings.Count(got, "\n") != 0 || !strings.Contains(got, `"extraInspections":7`) {
+		t.Errorf("compacted file = %s, want only the override of 7", got)
+	}
+	if _, err := os.Stat(cfg.Quotas.OverridesFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// Onleesbaar bestand: een fout, en het bestand blijft zoals het was
+	if err := os.WriteFile(cfg.Quotas.OverridesFile, []byte("{broken\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newQuotaGuard(cfg, store); err == nil {
+		t.Error("broken overrides file was accepted")
+	}
+	if data, _ := os.ReadFile(cfg.Quotas.OverridesFile); string(data) != "{broken\n" {
+		t.Errorf("broken file was rewritten to %q", data)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ========================================
+// RELEVANTIE (staat de juiste installatie op de foto?)
+// ========================================
+
+const (
+	// relevanceCheckID is de "check" van de classificatie, voor de providerketen (checks.relevance)
+	relevanceCheckID = "relevance"
+
+	// codeWrongSubject: de foto toont geen installatie of een ander onderdeel dan de check vraagt
+	codeWrongSubject = "WRONG_SUBJECT"
+)
+
+// relevance is wat de classificatie over een foto zegt
+type relevance struct {
+	Installation bool   `json:"installation"`    // foto toont een installatie van een huishoudelijk apparaat
+	Check        string `json:"check,omitempty"` // check waar de foto bewijs voor is, leeg = geen
+	Subject      string `json:"subject,omitempty"`
+}
+
+// relevancePrompt somt alle checks op; het model kiest er één (of geen)
+var relevancePrompt = func() string {
+	var b strings.Builder
+	b.WriteString(`You classify photos uploaded by installers of home appliances (washing machines, dryers, dishwashers).
+
+Decide whether the photo shows a home appliance installation at all, and which of these checks it is evidence for:
+`)
+	for _, check := range laundryChecks {
+		if check.VariantOf != "" {
+			continue // zelfde foto als de check waar hij een variant van is
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", check.ID, check.Description)
+	}
+	b.WriteString(`
+RESPONSE FORMAT - FOLLOW EXACTLY (3 lines):
+Line 1: INSTALLATION if the photo shows (part of) a home appliance installation, otherwise OTHER
+Line 2: the check id from the list that the photo is evidence for, or NONE
+Line 3: a few words describing what the photo shows, e.g. "drain hose in a standpipe" or "selfie of a person"`)
+	return b.String()
+}()
+
+// relevanceUserText is de user message bij de classificatie
+const relevanceUserText = "Classify this photo."
+
+// relevanceVersion verandert als de prompt verandert (cache key)
+var relevanceVersion = func() string {
+	sum := sha256.Sum256([]byte(relevancePrompt + "\x00" + relevanceUserText))
+	return hex.EncodeToString(sum[:6])
+}()
+
+// parseRelevance leest het antwoord van de classificatie (3 regels)
+func parseRelevance(content string) relevance {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	var result relevance
+	result.Installation = strings.ToUpper(strings.TrimSpace(lines[0])) != "OTHER"
+	if len(lines) >= 2 {
+		answer := strings.Trim(strings.TrimSpace(lines[1]), "`\"'.")
+		for _, check := range laundryChecks {
+			if check.VariantOf == "" && strings.EqualFold(answer, check.ID) {
+				result.Check = check.ID
+			}
+		}
+	}
+	if len(lines) >= 3 {
+		result.Subject = strings.TrimSpace(lines[2])
+	}
+	return result
+}
+
+// noCheckReason is de uitleg bij WRONG_SUBJECT: geen installatie, of voor geen enkele check bewijs
+func (rel relevance) noCheckReason() string {
+	subject := rel.Subject
+	if subject == "" {
+		subject = "something else"
+	}
+	if !rel.Installation {
+		return fmt.Sprintf("Photo does not show a home appliance installation (shows: %s)", subject)
+	}
+	return fmt.Sprintf("Photo is not evidence for any of the checks (shows: %s)", subject)
+}
+
+// classifyPhoto laat het model bepalen wat er op de foto staat. Op detail "low": de vraag is
+// grof, dat kost maar 85 image tokens.
+func (a *app) classifyPhoto(ctx context.Context, photo uploadedPhoto) (relevance, visionResult, error) {
+	result, err := a.vision.analyze(ctx, visionRequest{
+		Check:        relevanceCheckID,
+		SystemPrompt: relevancePrompt,
+		UserText:     relevanceUserText,
+		ImageURL:     photo.DataURL,
+		ImageDetail:  "low",
+	})
+	if err != nil {
+		return relevance{}, visionResult{}, err
+	}
+	result.Usage.ImageTokens = estimateImageTokens(photo.Width, photo.Height, "low")
+	return parseRelevance(result.Content), result, nil
+}
+
+// relevanceEnabled: de classificatie vooraf kost een extra model call per foto en staat daarom
+// alleen aan voor tenants die erom vragen (of voor iedereen met RELEVANCE_CHECK_ENABLED)
+func (a *app) relevanceEnabled(tenant string) bool {
+	return a.cfg.Relevance.Enabled || a.tenants.settings(tenant).RelevanceCheck
+}
+
+// relevanceKey houdt oordelen met en zonder classificatie apart in de cache
+func (a *app) relevanceKey(tenant string) string {
+	if !a.relevanceEnabled(tenant) {
+		return ""
+	}
+	return "/relevance:" + relevanceVersion
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newRelevanceTestApp heeft een aparte classificatie provider en de classificatie aan voor de tenant
+func newRelevanceTestApp(t *testing.T, classifierAnswer string) (*app, *fakeProvider, *fakeProvider) {
+	t.Helper()
+	checker := &fakeProvider{id: "checker", content: "PASS"}
+	classifier := &fakeProvider{id: "classifier", content: classifierAnswer}
+	a := newTestApp(t, checker)
+	a.vision.chains[relevanceCheckID] = []visionProvider{classifier}
+	a.tenants = newTenantDirectory([]tenantConfig{{ID: defaultTenant, RelevanceCheck: true}})
+	a.cfg.Pricing = map[string]modelPrice{
+		"classifier-model": {InputPerMillion: 1},
+		"checker-model":    {InputPerMillion: 10},
+	}
+	return a, checker, classifier
+}
+
+func TestRelevanceWrongCheckStillRunsCheck(t *testing.T) {
+	a, checker, classifier := newRelevanceTestApp(t, "INSTALLATION\ndrainHoseInDrain\ndrain hose in a standpipe")
+	check, _ := findCheck("powerCordInSocket")
+
+	rec := httptest.NewRecorder()
+	a.silverHandler(check)(rec, photoRequest(t, "/api/laundry/silver/v1/powerCordInSocket", testJPEG(t, 64, 48)))
+
+	var response QualityResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != "PASS" || response.ReasonCode != "" || response.SuggestedCheck != "drainHoseInDrain" {
+		t.Errorf("response = %+v, want PASS from the check with drainHoseInDrain as a hint", response)
+	}
+	if classifier.calls.Load() != 1 || checker.calls.Load() != 1 {
+		t.Errorf("classifier called %d times, checker %d times, want 1 and 1", classifier.calls.Load(), checker.calls.Load())
+	}
+
+	// Elk deel tegen de prijs van zijn eigen model: 100 prompt tokens à 1 en 100 à 10 USD per 1M
+	recorded := a.inspections.query(defaultTenant, func(inspection) bool { return true })
+	if len(recorded) != 1 {
+		t.Fatalf("%d inspections recorded, want 1", len(recorded))
+	}
+	if want := 0.0011; math.Abs(recorded[0].CostUSD-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", recorded[0].CostUSD, want)
+	}
+	if recorded[0].ClassifierModel != "classifier-model" || recorded[0].ClassifierUsage == nil || recorded[0].ClassifierUsage.PromptTokens != 100 {
+		t.Errorf("classifier = %q %+v, want classifier-model with 100 prompt tokens", recorded[0].ClassifierModel, recorded[0].ClassifierUsage)
+	}
+}
+
+func TestRelevanceOffTopicSkipsCheck(t *testing.T) {
+	a, checker, _ := newRelevanceTestApp(t, "OTHER\nNONE\nselfie of a person")
+	check, _ := findCheck("powerCordInSocket")
+
+	rec := httptest.NewRecorder()
+	a.silverHandler(check)(rec, photoRequest(t, "/api/laundry/silver/v1/powerCordInSocket", testJPEG(t, 64, 48)))
+
+	var response QualityResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || response.Result != "FAIL" || response.ReasonCode != codeWrongSubject {
+		t.Errorf("response = %d %+v, want FAIL with WRONG_SUBJECT", rec.Code, response)
+	}
+	if checker.calls.Load() != 0 {
+		t.Errorf("checker called %d times for an off-topic photo, want 0", checker.calls.Load())
+	}
+}
+
+func TestRelevanceIsOptIn(t *testing.T) {
+	a, checker, classifier := newRelevanceTestApp(t, "OTHER\nNONE\nselfie of a person")
+	a.tenants = newTenantDirectory(nil) // tenant zonder relevanceCheck
+	check, _ := findCheck("powerCordInSocket")
+
+	rec := httptest.NewRecorder()
+	a.silverHandler(check)(rec, photoRequest(t, "/api/laundry/silver/v1/powerCordInSocket", testJPEG(t, 64, 48)))
+
+	if classifier.calls.Load() != 0 || checker.calls.Load() != 1 {
+		t.Errorf("classifier called %d times, checker %d times, want 0 and 1", classifier.calls.Load(), checker.calls.Load())
+	}
+}
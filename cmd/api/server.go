@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ========================================
+// HEALTH & READINESS
+// ========================================
+
+// readiness houdt bij of de service klaar is om requests te verwerken
+type readiness struct {
+	mu           sync.Mutex
+	checks       map[string]func() error
+	shuttingDown atomic.Bool
+}
+
+func newReadiness() *readiness {
+	return &readiness{checks: make(map[string]func() error)}
+}
+
+// add registreert een afhankelijkheid (bijv. AI provider of database)
+func (rd *readiness) add(name string, check func() error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.checks[name] = check
+}
+
+// status voert alle checks uit en geeft per afhankelijkheid "ok" of de fout terug
+func (rd *readiness) status() (map[string]string, bool) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	result := make(map[string]string)
+	ready := true
+	if rd.shuttingDown.Load() {
+		result["server"] = "shutting down"
+		ready = false
+	}
+	for name, check := range rd.checks {
+		if err := check(); err != nil {
+			result[name] = err.Error()
+			ready = false
+		} else {
+			result[name] = "ok"
+		}
+	}
+	return result, ready
+}
+
+// registerHealthRoutes voegt /healthz (leeft het proces) en /readyz (kan het werk doen) toe
+func registerHealthRoutes(mux *http.ServeMux, rd *readiness) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		checks, ready := rd.status()
+		status := "ok"
+		if !ready {
+			status = "unavailable"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+	})
+}
+
+// ========================================
+// SERVER + GRACEFUL SHUTDOWN
+// ========================================
+
+// runServer start de server en stopt netjes bij SIGTERM/SIGINT: readyz gaat op 503, na
+// DrainDelay (tijd voor de load balancer om dat te zien) worden nieuwe requests geweigerd
+// en mogen lopende analyses afmaken. Een tweede signaal slaat het wachten over.
+func runServer(cfg serverConfig, handler http.Handler, rd *readiness) error {
+	server := &http.Server{
+		Addr:              net.JoinHostPort(cfg.BindAddress, cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSCertFile != "" {
+			slog.Info("Server start", "addr", server.Addr, "tls", true)
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			slog.Info("Server start", "addr", server.Addr, "tls", false)
+			err = server.ListenAndServe()
+		}
+		serverErr <- err
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-serverErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("server stopped: %w", err)
+	case sig := <-stop:
+		slog.Info("Signal ontvangen, lopende analyses afronden", "signal", sig.String(), "timeout", time.Duration(cfg.ShutdownTimeout).String())
+	}
+
+	rd.shuttingDown.Store(true)
+	if delay := time.Duration(cfg.DrainDelay); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-stop:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+
+	slog.Info("Server netjes afgesloten")
+	return nil
+}
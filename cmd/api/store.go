@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// ========================================
+// INSPECTIONS (opslag van elke beoordeling)
+// ========================================
+
+// inspection is één beoordeelde foto: wie, welke check, welk resultaat en wat het kostte
+type inspection struct {
+	ID               string         `json:"id"`
+	RequestID        string         `json:"requestId,omitempty"`
+	Tenant           string         `json:"tenant"`
+	ProjectNumber    string         `json:"projectNumber,omitempty"` // leeg bij silver
+	Check            string         `json:"check"`
+	Tier             string         `json:"tier"`
+	Result           string         `json:"result"`
+	Reason           string         `json:"reason,omitempty"`
+	Provider         string         `json:"provider"`
+	Model            string         `json:"model"`
+	Usage            tokenUsage     `json:"usage"`
+	CostUSD          float64        `json:"costUsd"`
+	Cached           bool           `json:"cached,omitempty"`           // oordeel uit de cache, geen model call
+	Findings         []imageFinding `json:"findings,omitempty"`         // oordeel per uitsnede (zie tiles.go)
+	Region           *regionHint    `json:"region,omitempty"`           // gebied dat de installateur aanwees
+	Note             string         `json:"note,omitempty"`             // notitie van de installateur
+	Hints            []photoHint    `json:"hints,omitempty"`            // gebied en notitie per foto bij meer foto's (Region en Note zijn dan leeg)
+	EXIF             *exifData      `json:"exif,omitempty"`             // metadata van de camera (zie exif.go)
+	PHash            string         `json:"phash,omitempty"`            // perceptuele hash van de foto (zie phash.go)
+	Photos           int            `json:"photos,omitempty"`           // aantal foto's als het er meer dan één waren (zie photos.go)
+	PHashes          []string       `json:"phashes,omitempty"`          // hashes van alle foto's bij meer dan één (PHash is de eerste)
+	ReasonCode       string         `json:"reasonCode,omitempty"`       // WRONG_SUBJECT (zie relevance.go)
+	Relevance        *relevance     `json:"relevance,omitempty"`        // wat de classificatie op de foto zag
+	ClassifierModel  string         `json:"classifierModel,omitempty"`  // model van de classificatie
+	ClassifierUsage  *tokenUsage    `json:"classifierUsage,omitempty"`  // deel van Usage voor de classificatie, geprijsd met ClassifierModel
+	Level            *levelReport   `json:"level,omitempty"`            // aflezing van de waterpas (zie level.go)
+	SubFindings      []subFinding   `json:"subFindings,omitempty"`      // los beoordeelde onderdelen (zie drain.go)
+	Risk             *photoRisk     `json:"risk,omitempty"`             // signalen van bewerking of een screenshot (zie fraud.go)
+	ReuseMatches     []reuseMatch   `json:"reuseMatches,omitempty"`     // eerdere inspecties met (bijna) dezelfde foto
+	Flags            []string       `json:"flags,omitempty"`            // bijv. CAPTURE_TIME_OUTSIDE_WINDOW (zie projects.go)
+	LocationVerified string         `json:"locationVerified,omitempty"` // true, false of unknown (alleen gold, zie geofence.go)
+	DistanceMeters   *float64       `json:"distanceMeters,omitempty"`   // afstand tussen foto en adres
+	CreatedAt        time.Time      `json:"createdAt"`
+}
+
+// inspectionStore schrijft alle inspecties optioneel naar een JSON lines bestand, zodat ze
+// een herstart overleven. In memory staan alleen de nieuwste maxRecent per tenant (voor het
+// zoeken naar hergebruikte foto's) en de totalen per dag, project, check en tier (usage API).
+type inspectionStore struct {
+	mu        sync.RWMutex
+	recent    map[string][]inspection // tenant -> nieuwste inspecties, oudste eerst
+	maxRecent int
+	rollups   map[usageKey]*usageGroup
+	monthly   map[string]usageTotals // tenant + maand -> totalen (voor quota's)
+	file      *os.File               // nil = alleen in memory
+	lastErr   error                  // laatste schrijffout (voor /readyz)
+}
+
+// usageKey is de fijnste groep van de usage API; grovere groepen tellen deze op
+type usageKey struct {
+	Tenant, Day, ProjectNumber, Check, Tier string
+}
+
+// usageTotals zijn het aantal inspecties en de kosten van een tenant in een maand
+type usageTotals struct {
+	Inspections int
+	CostUSD     float64
+}
+
+// monthKey is de sleutel voor de maandtotalen, bijv. "acme/2025-10"
+func monthKey(tenant string, t time.Time) string {
+	return tenant + "/" + t.UTC().Format("2006-01")
+}
+
+// openInspectionStore laadt bestaande inspecties uit path (leeg = alleen in memory)
+func openInspectionStore(path string, maxRecent int) (*inspectionStore, error) {
+	store := &inspectionStore{
+		recent:    make(map[string][]inspection),
+		maxRecent: maxRecent,
+		rollups:   make(map[usageKey]*usageGroup),
+		monthly:   make(map[string]usageTotals),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open inspections file: %w", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var in inspection
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("inspections file %s line %d: %w", path, line, err)
+		}
+		store.append(in)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read inspections file: %w", err)
+	}
+
+	store.file = file
+	return store, nil
+}
+
+// add slaat een inspectie op
+func (s *inspectionStore) add(in inspection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		line, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			s.lastErr = err
+			return fmt.Errorf("write inspection: %w", err)
+		}
+		s.lastErr = nil
+	}
+
+	s.append(in)
+	return nil
+}
+
+// append voegt een inspectie toe aan memory, de usage totalen en de maandtotalen (mu moet vast zijn)
+func (s *inspectionStore) append(in inspection) {
+	recent := append(s.recent[in.Tenant], in)
+	// In stappen inkorten, niet bij elke inspectie alles kopiëren
+	if len(recent) >= s.maxRecent+s.maxRecent/4+1 {
+		recent = append([]inspection(nil), recent[len(recent)-s.maxRecent:]...)
+	}
+	s.recent[in.Tenant] = recent
+
+	rollup := usageKey{Tenant: in.Tenant, Day: in.CreatedAt.UTC().Format(time.DateOnly), ProjectNumber: in.ProjectNumber, Check: in.Check, Tier: in.Tier}
+	if s.rollups[rollup] == nil {
+		s.rollups[rollup] = &usageGroup{}
+	}
+	s.rollups[rollup].add(in)
+
+	key := monthKey(in.Tenant, in.CreatedAt)
+	totals := s.monthly[key]
+	totals.Inspections++
+	totals.CostUSD += in.CostUSD
+	s.monthly[key] = totals
+}
+
+// monthTotals geeft het verbruik van een tenant in de maand van t
+func (s *inspectionStore) monthTotals(tenant string, t time.Time) usageTotals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.monthly[monthKey(tenant, t)]
+}
+
+// query geeft de recente inspecties van een tenant waarvoor match true teruggeeft, oudste eerst
+func (s *inspectionStore) query(tenant string, match func(inspection) bool) []inspection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []inspection
+	for _, in := range s.recent[tenant] {
+		if match(in) {
+			result = append(result, in)
+		}
+	}
+	return result
+}
+
+// usage geeft de totalen van een tenant per dag, project, check en tier voor de dagen [from, to)
+func (s *inspectionStore) usage(tenant string, from, to time.Time) map[usageKey]usageGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	first, end := from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly)
+	result := make(map[usageKey]usageGroup)
+	for key, group := range s.rollups {
+		if key.Tenant == tenant && key.Day >= first && key.Day < end {
+			copied := *group
+			copied.Flags = maps.Clone(group.Flags) // de store blijft erin schrijven
+			result[key] = copied
+		}
+	}
+	return result
+}
+
+// ready geeft een fout als de laatste write naar het bestand mislukte
+func (s *inspectionStore) ready() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.lastErr != nil {
+		return fmt.Errorf("inspection store: %w", s.lastErr)
+	}
+	return nil
+}
+
+// close sluit het bestand (bij afsluiten van de server)
+func (s *inspectionStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// newInspectionID maakt een uniek id, bijv. "insp_3f2a..."
+func newInspectionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "insp_" + hex.EncodeToString(b)
+}
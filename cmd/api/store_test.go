@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInspectionStoreKeepsRecentAndAllUsage(t *testing.T) {
+	store, err := openInspectionStore("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		store.add(inspection{ID: newInspectionID(), Tenant: "acme", ProjectNumber: "P1", Check: "drainHoseInDrain", Tier: "gold", CostUSD: 0.01, Flags: []string{flagSuspectedReuse}, CreatedAt: day})
+	}
+	store.add(inspection{ID: newInspectionID(), Tenant: "other", ProjectNumber: "P1", Check: "drainHoseInDrain", Tier: "gold", CreatedAt: day})
+
+	recent := store.query("acme", func(inspection) bool { return true })
+	if len(recent) < 10 || len(recent) > 13 {
+		t.Errorf("%d recent inspections kept for acme, want about 10", len(recent))
+	}
+	if n := len(store.query("other", func(inspection) bool { return true })); n != 1 {
+		t.Errorf("%d recent inspections for other, want 1", n)
+	}
+
+	// Usage en quota's tellen ook de inspecties die niet meer in memory staan
+	usage := store.usage("acme", day.Truncate(24*time.Hour), day.AddDate(0, 0, 1))
+	if len(usage) != 1 {
+		t.Fatalf("%d usage groups, want 1", len(usage))
+	}
+	for _, group := range usage {
+		if group.Inspections != 100 || group.Flags[flagSuspectedReuse] != 100 {
+			t.Errorf("usage = %d inspections, %d flags, want 100 and 100", group.Inspections, group.Flags[flagSuspectedReuse])
+		}
+	}
+	if totals := store.monthTotals("acme", day); totals.Inspections != 100 {
+		t.Errorf("month totals = %d inspections, want 100", totals.Inspections)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ========================================
+// TENANTS (klanten, herkend aan hun API key)
+// ========================================
+
+// defaultTenant wordt gebruikt als er geen tenants geconfigureerd zijn (auth uit)
+const defaultTenant = "default"
+
+type tenantKey struct{}
+
+// tenantDirectory zoekt bij een API key de bijbehorende tenant
+type tenantDirectory struct {
+	byKeyHash map[[32]byte]string // sha256(api key) -> tenant id
+	byID      map[string]tenantConfig
+}
+
+func newTenantDirectory(tenants []tenantConfig) *tenantDirectory {
+	dir := &tenantDirectory{byKeyHash: make(map[[32]byte]string), byID: make(map[string]tenantConfig)}
+	for _, t := range tenants {
+		dir.byID[t.ID] = t
+		for _, key := range t.APIKeys {
+			dir.byKeyHash[sha256.Sum256([]byte(key))] = t.ID
+		}
+	}
+	return dir
+}
+
+// enabled is false als er geen tenants zijn: dan is alles van de "default" tenant
+func (d *tenantDirectory) enabled() bool {
+	return len(d.byKeyHash) > 0
+}
+
+// settings geeft de configuratie van een tenant (leeg voor "default")
+func (d *tenantDirectory) settings(tenant string) tenantConfig {
+	return d.byID[tenant]
+}
+
+// lookup vergelijkt via de hash, zodat de vergelijking niet van de key zelf afhangt
+func (d *tenantDirectory) lookup(apiKey string) (string, bool) {
+	if apiKey == "" {
+		return "", false
+	}
+	tenant, ok := d.byKeyHash[sha256.Sum256([]byte(apiKey))]
+	return tenant, ok
+}
+
+// apiKeyFromRequest leest de key uit X-API-Key of Authorization: Bearer
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// requireTenant weigert requests zonder geldige API key en zet de tenant in de context
+func (d *tenantDirectory) requireTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant := defaultTenant
+		if d.enabled() {
+			var ok bool
+			tenant, ok = d.lookup(apiKeyFromRequest(r))
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api-q"`)
+				writeError(w, http.StatusUnauthorized, "Invalid or missing API key")
+				return
+			}
+		}
+
+		addLogAttrs(r.Context(), slog.String("tenant", tenant))
+		next(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+	}
+}
+
+// tenantFrom geeft de tenant van de request
+func tenantFrom(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return defaultTenant
+}
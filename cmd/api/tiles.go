@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+)
+
+// ========================================
+// UITSNEDEN (kleine details zoals een stekker in de hoek)
+// ========================================
+
+// minTileEdge: kleinere uitsneden laten het model niets zien wat de hele foto niet al laat zien
+const minTileEdge = 512
+
+// photoTile is een uitsnede van de foto, klaar voor het AI model
+type photoTile struct {
+	Label   string // bijv. "top-left", voor de prompt en de findings
+	DataURL string
+	Width   int
+	Height  int
+	Marked  bool // door de installateur aangewezen gebied (zie hints.go)
+}
+
+// imageFinding is het oordeel over één beeld (de hele foto of een uitsnede)
+type imageFinding struct {
+	Image      string `json:"image"` // "overview", het label van de uitsnede of "photo 2" (zie photos.go)
+	Result     string `json:"result"`
+	Reason     string `json:"reason,omitempty"`
+	ReasonCode string `json:"reasonCode,omitempty"` // WRONG_SUBJECT bij een foto van iets anders
+}
+
+// tileSize is de grootte van één uitsnede bij tiles x tiles met overlap. Naar boven afgerond:
+// anders valt er zonder overlap tussen twee uitsneden een pixel buiten allebei.
+func tileSize(width, height, tiles int, overlap float64) (tileWidth, tileHeight int) {
+	span := float64(tiles) - float64(tiles-1)*overlap
+	return int(math.Ceil(float64(width) / span)), int(math.Ceil(float64(height) / span))
+}
+
+// tilesFit is true als uitsneden zin hebben: groot genoeg om meer detail te tonen dan de hele foto
+func tilesFit(width, height int, settings imageSettings) bool {
+	if settings.Tiles < 2 || width <= 0 || height <= 0 {
+		return false
+	}
+	tileWidth, tileHeight := tileSize(width, height, settings.Tiles, settings.TileOverlap)
+	return min(tileWidth, tileHeight) >= minTileEdge
+}
+
+// tileRegions verdeelt de foto in tiles x tiles overlappende rechthoeken, rij voor rij.
+// De buitenste uitsneden liggen precies tegen de rand.
+func tileRegions(width, height, tiles int, overlap float64) []image.Rectangle {
+	tileWidth, tileHeight := tileSize(width, height, tiles, overlap)
+	regions := make([]image.Rectangle, 0, tiles*tiles)
+	for row := 0; row < tiles; row++ {
+		y := (height - tileHeight) * row / (tiles - 1)
+		for col := 0; col < tiles; col++ {
+			x := (width - tileWidth) * col / (tiles - 1)
+			regions = append(regions, image.Rect(x, y, x+tileWidth, y+tileHeight))
+		}
+	}
+	return regions
+}
+
+// tileNames zijn de namen van de rijen en kolommen bij 2x2 en 3x3
+var tileNames = map[int][2][]string{
+	2: {{"top", "bottom"}, {"left", "right"}},
+	3: {{"top", "middle", "bottom"}, {"left", "center", "right"}},
+}
+
+// tileLabel beschrijft de plek van een uitsnede, bijv. "top-left" of "row 2, column 3"
+func tileLabel(row, col, tiles int) string {
+	names, ok := tileNames[tiles]
+	if !ok {
+		return fmt.Sprintf("row %d, column %d", row+1, col+1)
+	}
+	if names[0][row] == "middle" && names[1][col] == "center" {
+		return "center"
+	}
+	return names[0][row] + "-" + names[1][col]
+}
+
+// tileReserve schat het geheugen voor de uitsneden: hun pixels na verkleinen, ruim 1 byte per
+// pixel als JPEG, en dat 3x (JPEG, data URL, JSON naar de provider)
+func tileReserve(width, height int, settings imageSettings) int64 {
+	tileWidth, tileHeight := tileSize(width, height, settings.Tiles, settings.TileOverlap)
+	scale := min(1, float64(settings.MaxLongEdge)/float64(max(tileWidth, tileHeight)))
+	pixels := float64(settings.Tiles*settings.Tiles) * float64(tileWidth*tileHeight) * scale * scale
+	return int64(pixels) * 3
+}
+
+// renderReserve schat zo het geheugen voor één beeld van maximaal maxLongEdge uit een foto van
+// width x height (de voorbewerkte foto of het aangewezen gebied)
+func renderReserve(width, height, maxLongEdge int) int64 {
+	return min(int64(width)*int64(height), int64(maxLongEdge)*int64(maxLongEdge)) * 3
+}
+
+// renderTiles maakt de uitsneden als JPEG data URLs (elk maximaal MaxLongEdge)
+func renderTiles(photo decodedPhoto, settings imageSettings) ([]photoTile, error) {
+	width, height := photo.size()
+	buf := photoBuffers.Get().(*bytes.Buffer)
+	defer photoBuffers.Put(buf)
+
+	var tiles []photoTile
+	for i, region := range tileRegions(width, height, settings.Tiles, settings.TileOverlap) {
+		buf.Reset()
+		tileWidth, tileHeight, err := photo.render(region, settings.MaxLongEdge, settings.JPEGQuality, buf)
+		if err != nil {
+			return nil, err
+		}
+		tiles = append(tiles, photoTile{
+			Label:   tileLabel(i/settings.Tiles, i%settings.Tiles, settings.Tiles),
+			DataURL: dataURL("image/jpeg", buf.Bytes()),
+			Width:   tileWidth,
+			Height:  tileHeight,
+		})
+	}
+	return tiles, nil
+}
+
+// renderRegion maakt de uitsnede van het gebied dat de installateur aanwees
+func renderRegion(photo decodedPhoto, hint regionHint, settings imageSettings) (photoTile, error) {
+	width, height := photo.size()
+	buf := photoBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer photoBuffers.Put(buf)
+
+	tileWidth, tileHeight, err := photo.render(hint.rect(width, height), settings.MaxLongEdge, settings.JPEGQuality, buf)
+	if err != nil {
+		return photoTile{}, err
+	}
+	return photoTile{Label: "marked region", DataURL: dataURL("image/jpeg", buf.Bytes()), Width: tileWidth, Height: tileHeight, Marked: true}, nil
+}
+
+// tileUserText is de user message voor een uitsnede: het model moet weten dat het maar een deel ziet
+func tileUserText(userText string, tile photoTile) string {
+	if tile.Marked {
+		return userText + " This is an enlarged crop of the area the installer marked in the installation photo; the full photo is judged separately. Judge only what is visible in this crop."
+	}
+	return userText + " This is an enlarged crop (" + tile.Label + ") of the installation photo; the full photo is judged separately. Judge only what is visible in this crop."
+}
+
+// mergeFindings maakt één oordeel uit de oordelen per beeld:
+//   - any: PASS als minstens één beeld PASS is (bewijs mag overal staan)
+//   - all: PASS als alle beelden PASS zijn (één beeld met een fout is genoeg voor FAIL)
+//   - majority: PASS als meer dan de helft PASS is
+//
+// Een ander antwoord dan PASS (bijv. UNKNOWN) telt als FAIL. De reden komt van het eerste beeld dat
+// de doorslag gaf, met het label erbij als dat niet de hele foto is.
+func mergeFindings(rule string, findings []imageFinding) (result, reason string) {
+	passes := 0
+	for _, f := range findings {
+		if f.Result == "PASS" {
+			passes++
+		}
+	}
+
+	result = "FAIL"
+	switch rule {
+	case "all":
+		if passes == len(findings) {
+			result = "PASS"
+		}
+	case "majority":
+		if passes*2 > len(findings) {
+			result = "PASS"
+		}
+	default: // any
+		if passes > 0 {
+			result = "PASS"
+		}
+	}
+
+	for _, f := range findings {
+		if (f.Result == "PASS") != (result == "PASS") {
+			continue
+		}
+		if f.Image == "overview" || f.Reason == "" {
+			return result, f.Reason
+		}
+		return result, f.Image + ": " + f.Reason
+	}
+	return result, ""
+}
+
+// analyzeWithTiles laat de hele foto en alle uitsneden tegelijk beoordelen, met de notitie
+// van de installateur erbij. Het antwoord op de hele foto staat op index 0. De eerste fout
+// breekt de andere calls af.
+func (a *app) analyzeWithTiles(ctx context.Context, req visionRequest, photo uploadedPhoto) ([]visionResult, error) {
+	tiles := photo.Tiles
+	if len(tiles) == 0 {
+		req.UserText = noteUserText(req.UserText, photo.Note)
+		result, err := a.vision.analyze(ctx, req)
+		return []visionResult{result}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]visionResult, len(tiles)+1)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := range results {
+		imageReq := req
+		if i > 0 {
+			imageReq.UserText = tileUserText(req.UserText, tiles[i-1])
+			imageReq.ImageURL = tiles[i-1].DataURL
+		}
+		imageReq.UserText = noteUserText(imageReq.UserText, photo.Note)
+		wg.Add(1)
+		go func(i int, imageReq visionRequest) {
+			defer wg.Done()
+			result, err := a.vision.analyze(ctx, imageReq)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = result
+		}(i, imageReq)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
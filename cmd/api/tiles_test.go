@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tileProvider antwoordt per beeld: de uitsnede met dat label in de user message, anders "overview"
+type tileProvider struct {
+	answers map[string]string
+}
+
+func (p *tileProvider) name() string { return "tiles" }
+
+func (p *tileProvider) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	content := p.answers["overview"]
+	for label, answer := range p.answers {
+		if strings.Contains(req.UserText, "("+label+")") {
+			content = answer
+		}
+	}
+	return providerAnswer{Content: content, Model: "tiles-model", Usage: tokenUsage{PromptTokens: 100, CompletionTokens: 2}}, nil
+}
+
+func TestTileRegions(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		tiles         int
+		overlap       float64
+		want          []image.Rectangle
+	}{
+		{"2x2 with overlap", 2000, 1000, 2, 0.2, []image.Rectangle{
+			image.Rect(0, 0, 1112, 556), image.Rect(888, 0, 2000, 556),
+			image.Rect(0, 444, 1112, 1000), image.Rect(888, 444, 2000, 1000),
+		}},
+		{"3x3 without overlap", 3000, 1500, 3, 0, []image.Rectangle{
+			image.Rect(0, 0, 1000, 500), image.Rect(1000, 0, 2000, 500), image.Rect(2000, 0, 3000, 500),
+			image.Rect(0, 500, 1000, 1000), image.Rect(1000, 500, 2000, 1000), image.Rect(2000, 500, 3000, 1000),
+			image.Rect(0, 1000, 1000, 1500), image.Rect(1000, 1000, 2000, 1500), image.Rect(2000, 1000, 3000, 1500),
+		}},
+		{"odd size", 1001, 777, 2, 0.25, []image.Rectangle{
+			image.Rect(0, 0, 572, 444), image.Rect(429, 0, 1001, 444),
+			image.Rect(0, 333, 572, 777), image.Rect(429, 333, 1001, 777),
+		}},
+		// Afronding: zonder overlap geen pixel tussen twee uitsneden, de laatste tegen de rand
+		{"no gaps when rounding", 1025, 100, 3, 0, []image.Rectangle{
+			image.Rect(0, 0, 342, 34), image.Rect(341, 0, 683, 34), image.Rect(683, 0, 1025, 34),
+			image.Rect(0, 33, 342, 67), image.Rect(341, 33, 683, 67), image.Rect(683, 33, 1025, 67),
+			image.Rect(0, 66, 342, 100), image.Rect(341, 66, 683, 100), image.Rect(683, 66, 1025, 100),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tileRegions(tt.width, tt.height, tt.tiles, tt.overlap)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d regions, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("region %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTileRegionsCoverThePhoto(t *testing.T) {
+	for _, size := range [][2]int{{4032, 3024}, {3024, 4032}, {1200, 1200}, {1025, 4097}} {
+		for tiles := 2; tiles <= 4; tiles++ {
+			for _, overlap := range []float64{0, 0.1, 0.2, 0.5} {
+				width, height := size[0], size[1]
+				regions := tileRegions(width, height, tiles, overlap)
+				bounds := image.Rect(0, 0, width, height)
+				if len(regions) != tiles*tiles {
+					t.Fatalf("%dx%d, %d tiles: %d regions", width, height, tiles, len(regions))
+				}
+				tileWidth, tileHeight := tileSize(width, height, tiles, overlap)
+				for i, region := range regions {
+					row, col := i/tiles, i%tiles
+					if !region.In(bounds) || region.Dx() != tileWidth || region.Dy() != tileHeight {
+						t.Fatalf("%dx%d, %d tiles, overlap %g: region %d = %v outside %v or not %dx%d", width, height, tiles, overlap, i, region, bounds, tileWidth, tileHeight)
+					}
+					// De randen: eerste rij/kolom op 0, laatste precies tegen de rand
+					if (col == 0 && region.Min.X != 0) || (col == tiles-1 && region.Max.X != width) ||
+						(row == 0 && region.Min.Y != 0) || (row == tiles-1 && region.Max.Y != height) {
+						t.Errorf("%dx%d, %d tiles, overlap %g: edge region %d = %v", width, height, tiles, overlap, i, region)
+					}
+					// Buren overlappen minstens zoveel als gevraagd (op afronding na) en laten geen gat
+					if col > 0 {
+						shared := regions[i-1].Max.X - region.Min.X
+						if shared < 0 || float64(shared) < overlap*float64(tileWidth)-1 {
+							t.Errorf("%dx%d, %d tiles, overlap %g: columns %d and %d share %d px of %d", width, height, tiles, overlap, col-1, col, shared, tileWidth)
+						}
+					}
+					if row > 0 {
+						shared := regions[i-tiles].Max.Y - region.Min.Y
+						if shared < 0 || float64(shared) < overlap*float64(tileHeight)-1 {
+							t.Errorf("%dx%d, %d tiles, overlap %g: rows %d and %d share %d px of %d", width, height, tiles, overlap, row-1, row, shared, tileHeight)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTilesFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		tiles         int
+		overlap       float64
+		want          bool
+	}{
+		{"phone photo", 4032, 3024, 2, 0.2, true},
+		{"just big enough", 920, 920, 2, 0.2, true}, // 920 / 1.8 = 511.1, naar boven 512
+		{"just too small", 919, 2000, 2, 0.2, false},
+		{"tiny", 32, 24, 2, 0.2, false},
+		{"3x3 of a small photo", 1200, 1200, 3, 0.2, false},
+		{"tiles off", 4032, 3024, 1, 0.2, false},
+		{"tiles zero", 4032, 3024, 0, 0.2, false},
+		{"unknown size", 0, 0, 2, 0.2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tilesFit(tt.width, tt.height, imageSettings{Tiles: tt.tiles, TileOverlap: tt.overlap}); got != tt.want {
+				t.Errorf("tilesFit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTileLabel(t *testing.T) {
+	tests := []struct {
+		row, col, tiles int
+		want            string
+	}{
+		{0, 0, 2, "top-left"},
+		{1, 1, 2, "bottom-right"},
+		{1, 1, 3, "center"},
+		{1, 0, 3, "middle-left"},
+		{2, 1, 3, "bottom-center"},
+		{1, 2, 4, "row 2, column 3"},
+	}
+	for _, tt := range tests {
+		if got := tileLabel(tt.row, tt.col, tt.tiles); got != tt.want {
+			t.Errorf("tileLabel(%d, %d, %d) = %q, want %q", tt.row, tt.col, tt.tiles, got, tt.want)
+		}
+	}
+}
+
+func TestMergeFindings(t *testing.T) {
+	f := func(image, result, reason string) imageFinding {
+		return imageFinding{Image: image, Result: result, Reason: reason}
+	}
+	tests := []struct {
+		name       string
+		rule       string
+		findings   []imageFinding
+		wantResult string
+		wantReason string
+	}{
+		{"any: one tile is enough", "any", []imageFinding{f("overview", "FAIL", "No plug visible"), f("top-left", "FAIL", "Wall only"), f("bottom-right", "PASS", "Plug in the socket")},
+			"PASS", "bottom-right: Plug in the socket"},
+		{"any: none", "any", []imageFinding{f("overview", "FAIL", "No plug visible"), f("top-left", "FAIL", "Wall only")},
+			"FAIL", "No plug visible"},
+		{"unknown rule is any", "", []imageFinding{f("overview", "FAIL", "Blurry"), f("top-left", "PASS", "Plug visible")},
+			"PASS", "top-left: Plug visible"},
+		{"all: every image", "all", []imageFinding{f("overview", "PASS", "Bolts removed"), f("top-left", "PASS", "No bolt"), f("top-right", "PASS", "No bolt")},
+			"PASS", "Bolts removed"},
+		{"all: one tile fails", "all", []imageFinding{f("overview", "PASS", "Bolts removed"), f("top-left", "PASS", "No bolt"), f("bottom-left", "FAIL", "Bolt still in place")},
+			"FAIL", "bottom-left: Bolt still in place"},
+		{"majority: more than half", "majority", []imageFinding{f("overview", "PASS", "Level"), f("top-left", "PASS", ""), f("top-right", "FAIL", "Tilted")},
+			"PASS", "Level"},
+		{"majority: a tie fails", "majority", []imageFinding{f("overview", "PASS", "Level"), f("top-left", "FAIL", "Tilted"), f("top-right", "PASS", ""), f("bottom-left", "FAIL", "")},
+			"FAIL", "top-left: Tilted"},
+		{"reason without text has no label", "all", []imageFinding{f("overview", "PASS", "Fine"), f("top-right", "FAIL", "")},
+			"FAIL", ""},
+		// UNKNOWN is geen PASS: het telt als FAIL en kan ook de reden geven
+		{"all: unknown tile", "all", []imageFinding{f("overview", "PASS", "Bolts removed"), f("top-left", "UNKNOWN", "Too dark to tell")},
+			"FAIL", "top-left: Too dark to tell"},
+		{"any: unknown overview", "any", []imageFinding{f("overview", "UNKNOWN", "Too dark to tell"), f("top-left", "PASS", "Plug visible")},
+			"PASS", "top-left: Plug visible"},
+		{"majority: unknowns outvote", "majority", []imageFinding{f("overview", "PASS", "Level"), f("top-left", "UNKNOWN", "Cut off"), f("top-right", "UNKNOWN", "Blurry")},
+			"FAIL", "top-left: Cut off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, reason := mergeFindings(tt.rule, tt.findings)
+			if result != tt.wantResult || reason != tt.wantReason {
+				t.Errorf("mergeFindings = %s %q, want %s %q", result, reason, tt.wantResult, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestGoldTilesWithUnknownAnswer(t *testing.T) {
+	tests := []struct {
+		rule       string
+		wantResult string
+		wantReason string
+	}{
+		{"any", "PASS", "Bolts removed"},
+		{"all", "FAIL", "top-left: Too dark to tell"},
+		{"majority", "PASS", "Bolts removed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			// De uitsnede linksboven weet het niet: voor het model een UNKNOWN, voor ons een FAIL
+			a := newTestApp(t, &tileProvider{answers: map[string]string{
+				"overview": "PASS\nBolts removed",
+				"top-left": "UNKNOWN\nToo dark to tell",
+			}})
+			a.cfg.Image.Tiles, a.cfg.Image.TileOverlap, a.cfg.Image.TileMerge = 2, 0.2, tt.rule
+
+			rec := httptest.NewRecorder()
+			a.goldHandler(rec, photoRequest(t, "/api/laundry/gold/v1/P1/shippingBoltsRemoved", testJPEG(t, 1200, 1200)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var response struct {
+				Result   string         `json:"result"`
+				Reason   string         `json:"reason"`
+				Findings []imageFinding `json:"findings"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Result != tt.wantResult || response.Reason != tt.wantReason {
+				t.Errorf("verdict %s %q, want %s %q", response.Result, response.Reason, tt.wantResult, tt.wantReason)
+			}
+			if len(response.Findings) != 5 {
+				t.Fatalf("findings = %+v, want the overview and 4 tiles", response.Findings)
+			}
+			for _, finding := range response.Findings {
+				if want := map[bool]string{true: "FAIL", false: "PASS"}[finding.Image == "top-left"]; finding.Result != want {
+					t.Errorf("finding %s = %s, want %s", finding.Image, finding.Result, want)
+				}
+			}
+		})
+	}
+}
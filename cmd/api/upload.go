@@ -0,0 +1,736 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // decoders voor image.DecodeConfig
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ========================================
+// UPLOAD (gestreamd, zonder temp files)
+// ========================================
+
+// codeServerBusy: te veel uploads tegelijk in memory, probeer het zo opnieuw
+const codeServerBusy = "SERVER_BUSY"
+
+// maxHeaderBytes: zoveel lezen we hoogstens van het begin van een foto voor type, EXIF,
+// afmetingen en JPEG tabellen (zie readPhotoHeader). Meer metadata is zeldzaam; dan parsen
+// we wat erin past.
+const maxHeaderBytes = 1 << 20
+
+// reserveStep: wat we van een foto bewaren (data URL van het origineel, ruwe bytes) reserveren we
+// in stappen van zoveel bytes, terwijl het binnenkomt
+const reserveStep = 1 << 20
+
+// uploadedPhoto is de foto uit het multipart formulier, klaar voor het AI model
+type uploadedPhoto struct {
+	DataURL        string // "data:image/jpeg;base64,..." precies één keer opgebouwd
+	ContentType    string // van de foto zoals hij naar het model gaat
+	Size           int64  // grootte van de upload
+	Filename       string // bestandsnaam uit het formulier (kan leeg zijn)
+	ModelBytes     int64  // grootte na voorbewerking
+	Width          int    // afmetingen zoals naar het model gestuurd, 0 als het formaat onbekend is
+	Height         int
+	Detail         string        // OpenAI detail niveau (low/high/auto)
+	Settings       imageSettings // waarmee de foto voorbereid is (cache key, zie judge)
+	OriginalTokens int           // geschatte image tokens van het origineel op detail "high"
+	Hash           string        // SHA-256 van de foto zonder metadata (zie photoHash)
+	Tiles          []photoTile   // aangewezen gebied en uitsneden als de check dat wil (zie tiles.go)
+	Region         *regionHint   // gebied dat de installateur aanwees, nil = geen
+	Note           string        // notitie van de installateur (opgeschoond, zie cleanNote)
+	EXIF           exifData      // metadata van de camera (leeg als de foto geen EXIF heeft)
+	PHash          string        // perceptuele hash (zie phash.go), leeg als de foto niet te decoderen is
+	Risk           photoRisk     // signalen van bewerking of een screenshot (zie fraud.go)
+
+	raw formPhoto // de upload zelf als readPhotos hem moest bewaren, tot release() (zie reprepare)
+}
+
+// formPhoto is één "photo" part; Data is alleen gevuld als de ruwe foto bewaard wordt
+type formPhoto struct {
+	ContentType string
+	Filename    string
+	Size        int64 // bovengrens van de grootte (rest van de Content-Length), 0 = onbekend
+	Data        *chunkBuffer
+}
+
+// photoBuffers hergebruikt buffers tussen requests voor de voorbewerkte foto en de uitsneden
+var photoBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// chunkSize is de grootte van de stukken waarin chunkBuffer een foto bewaart
+const chunkSize = 64 << 10
+
+// photoChunks hergebruikt de stukken van chunkBuffer tussen requests
+var photoChunks = sync.Pool{New: func() any { return new([chunkSize]byte) }}
+
+// chunkBuffer bewaart een foto in stukken uit photoChunks: groeien kopieert niets, anders dan bij
+// een bytes.Buffer of strings.Builder die steeds opnieuw alloceert en kopieert
+type chunkBuffer struct {
+	chunks []*[chunkSize]byte
+	n      int
+}
+
+func (c *chunkBuffer) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		offset := c.n % chunkSize
+		if offset == 0 {
+			c.chunks = append(c.chunks, photoChunks.Get().(*[chunkSize]byte))
+		}
+		copied := copy(c.chunks[len(c.chunks)-1][offset:], p)
+		c.n += copied
+		p = p[copied:]
+	}
+	return written, nil
+}
+
+// reader leest de bewaarde bytes terug
+func (c *chunkBuffer) reader() io.Reader {
+	readers := make([]io.Reader, len(c.chunks))
+	for i, chunk := range c.chunks {
+		readers[i] = bytes.NewReader(chunk[:min(chunkSize, c.n-i*chunkSize)])
+	}
+	return io.MultiReader(readers...)
+}
+
+// dataURL schrijft de bewaarde bytes als data URL, in een builder van precies de juiste grootte
+func (c *chunkBuffer) dataURL(contentType string) string {
+	prefix := "data:" + contentType + ";base64,"
+	var url strings.Builder
+	url.Grow(len(prefix) + base64.StdEncoding.EncodedLen(c.n))
+	url.WriteString(prefix)
+	encoder := base64.NewEncoder(base64.StdEncoding, &url)
+	io.Copy(encoder, c.reader())
+	encoder.Close()
+	return url.String()
+}
+
+// release geeft de stukken terug aan de pool
+func (c *chunkBuffer) release() {
+	for _, chunk := range c.chunks {
+		photoChunks.Put(chunk)
+	}
+	c.chunks, c.n = nil, 0
+}
+
+// readPhotos streamt het formulier: de "photo" of "photo[]" parts (max maxPhotos, in volgorde)
+// plus de optionele velden "region", "note", "region[]" en "note[]" (zie hints.go). Geen
+// ParseMultipartForm (temp files): elke foto gaat terwijl hij binnenkomt door hash, decoder en
+// voorbewerking (zie preparePhoto). Omdat de foto daarna weg is, moet een aangewezen gebied vóór
+// zijn foto in het formulier staan; notities mogen overal. keepRaw bewaart de ruwe foto's, zodat
+// reprepare ze met andere instellingen opnieuw kan voorbereiden. De geheugenreservering loopt tot
+// release(). Bij een fout is de error response al verstuurd.
+func (a *app) readPhotos(w http.ResponseWriter, r *http.Request, tier string, settings imageSettings, maxPhotos int, keepRaw bool) (photos []uploadedPhoto, release func(), ok bool) {
+	// Body mag iets groter zijn dan de foto's zelf vanwege de multipart overhead
+	maxBody := a.cfg.Upload.MaxPhotoBytes*int64(maxPhotos) + 1<<20
+	body := http.MaxBytesReader(w, r.Body, maxBody)
+	consumed := &streamReader{r: body} // wat er van de body gelezen is, voor de bovengrens per foto
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{consumed, body}
+
+	var releases []func()
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	_, parseSpan := tracer.Start(r.Context(), "upload.parse", trace.WithAttributes(attribute.String("apiq.tier", tier)))
+	var total int64
+	fail := func(status int, message string) ([]uploadedPhoto, func(), bool) {
+		endSpan(parseSpan, errors.New(message))
+		release()
+		writeError(w, status, message)
+		return nil, nil, false
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return fail(http.StatusBadRequest, "Invalid form data")
+	}
+	// Gedeelde region en note gelden voor alle foto's, region[] en note[] per foto in volgorde
+	invalidRegion := "Invalid region. Expected x,y (point) or x,y,width,height (box) as fractions between 0 and 1"
+	var sharedRegion *regionHint
+	var regions []*regionHint
+	var sharedNote string
+	var notes []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return fail(http.StatusRequestEntityTooLarge, a.photoTooLarge())
+			}
+			return fail(http.StatusBadRequest, "Invalid form data")
+		}
+
+		switch name := part.FormName(); name {
+		case "photo", "photo[]":
+			i := len(photos)
+			if i == maxPhotos {
+				if maxPhotos == 1 {
+					continue // alleen de eerste foto telt
+				}
+				return fail(http.StatusBadRequest, fmt.Sprintf("Too many photos (max %d)", maxPhotos))
+			}
+			region := sharedRegion
+			if region != nil && i > 0 {
+				return fail(http.StatusBadRequest, "A region for all photos can only be marked when sending a single photo, use region[] per photo")
+			}
+			if i < len(regions) {
+				region = regions[i]
+			}
+			meta := formPhoto{ContentType: part.Header.Get("Content-Type"), Filename: part.FileName()}
+			if r.ContentLength > 0 {
+				// De multipart reader leest vooruit, dus een beetje marge
+				meta.Size = max(r.ContentLength-consumed.n, 0) + 64<<10
+			}
+			photo, releasePhoto, ok := a.preparePhoto(w, r, part, meta, settings, region, keepRaw)
+			if !ok {
+				endSpan(parseSpan, errors.New("photo rejected"))
+				release()
+				return nil, nil, false
+			}
+			releases = append(releases, releasePhoto)
+			photoSizeBytes.WithLabelValues(tier).Observe(float64(photo.Size))
+			total += photo.Size
+			photos = append(photos, photo)
+		case "region", "region[]":
+			value, err := readFormField(part)
+			if err != nil {
+				return fail(http.StatusBadRequest, "Invalid form data")
+			}
+			hint, ok := parseRegionHint(value)
+			if !ok {
+				return fail(http.StatusBadRequest, invalidRegion)
+			}
+			if name == "region" {
+				if len(photos) > 1 {
+					return fail(http.StatusBadRequest, "A region for all photos can only be marked when sending a single photo, use region[] per photo")
+				}
+				if len(photos) == 1 {
+					return fail(http.StatusBadRequest, "Send the region before the photo it marks")
+				}
+				sharedRegion = hint
+				continue
+			}
+			if len(regions) < len(photos) {
+				return fail(http.StatusBadRequest, "Send each region[] before the photo it marks")
+			}
+			regions = append(regions, hint)
+		case "note", "note[]":
+			value, err := readFormField(part)
+			if err != nil {
+				return fail(http.StatusBadRequest, "Invalid form data")
+			}
+			if name == "note" {
+				sharedNote = value
+			} else {
+				notes = append(notes, value)
+			}
+		}
+	}
+	if len(photos) == 0 {
+		return fail(http.StatusBadRequest, "No photo found")
+	}
+	if len(regions) > len(photos) || len(notes) > len(photos) {
+		return fail(http.StatusBadRequest, "More regions or notes than photos")
+	}
+
+	// Notities hebben geen invloed op de voorbewerking, die kunnen we nu pas toewijzen
+	noteTooLong := fmt.Sprintf("Note too long (max %d characters)", maxNoteChars)
+	note, ok := cleanNote(sharedNote)
+	if !ok {
+		return fail(http.StatusBadRequest, noteTooLong)
+	}
+	for i := range photos {
+		photos[i].Note = note
+		if i < len(notes) && strings.TrimSpace(notes[i]) != "" {
+			if photos[i].Note, ok = cleanNote(notes[i]); !ok {
+				return fail(http.StatusBadRequest, noteTooLong)
+			}
+		}
+	}
+	parseSpan.SetAttributes(attribute.Int64("apiq.image.bytes", total), attribute.Int("apiq.image.count", len(photos)))
+	parseSpan.End()
+	return photos, release, true
+}
+
+// readFormField leest een tekstveld (region, note), max maxFieldBytes. Langer is toch ongeldig
+// en wordt door parseRegionHint of cleanNote geweigerd.
+func readFormField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes))
+	return string(value), err
+}
+
+// maxFieldBytes: van tekstvelden lezen we niet meer dan dit (zie readFormField)
+const maxFieldBytes = 4 << 10
+
+// photoTooLarge is de 413 melding
+func (a *app) photoTooLarge() string {
+	return fmt.Sprintf("Photo too large (max %d MB)", a.cfg.Upload.MaxPhotoBytes>>20)
+}
+
+// reprepare bereidt een foto uit readPhotos (met keepRaw) opnieuw voor met andere instellingen,
+// bijv. die van de check die de classificatie koos. Zelfde instellingen of geen ruwe foto: de
+// foto zelf en een lege release. Het geheugen loopt tot release(). Bij false is de fout al verstuurd.
+func (a *app) reprepare(w http.ResponseWriter, r *http.Request, photo uploadedPhoto, settings imageSettings) (prepared uploadedPhoto, release func(), ok bool) {
+	if settings == photo.Settings || photo.raw.Data == nil {
+		return photo, func() {}, true
+	}
+	prepared, release, ok = a.preparePhoto(w, r, photo.raw.Data.reader(), formPhoto{ContentType: photo.raw.ContentType, Filename: photo.raw.Filename, Size: int64(photo.raw.Data.n)}, settings, photo.Region, false)
+	if !ok {
+		return uploadedPhoto{}, nil, false
+	}
+	prepared.Note = photo.Note
+	return prepared, release, true
+}
+
+var (
+	errPhotoTooLarge = errors.New("photo too large")
+	errPhotoRead     = errors.New("could not read photo")
+	errServerBusy    = errors.New("server busy")
+)
+
+// preparePhoto maakt één foto klaar voor het model terwijl hij binnenkomt: eerst de kop (type,
+// EXIF, afmetingen, zie readPhotoHeader), daarna gaat de rest in één keer door de hash en de
+// decoder, die de voorbewerking, uitsneden, perceptuele hash en fraudesignalen voedt. Het
+// origineel bewaren we alleen als het zelf naar het model kan gaan (geen voorbewerking, niet te
+// decoderen, of klein genoeg en rechtop), in stukken (zie chunkBuffer). Een foto die verkleind
+// wordt staat dus nooit in zijn geheel in memory, alleen gedecodeerd (dat reserveren we vooraf).
+// release geeft het geheugen en de buffers terug. Bij false is de fout al verstuurd.
+func (a *app) preparePhoto(w http.ResponseWriter, r *http.Request, src io.Reader, meta formPhoto, settings imageSettings, region *regionHint, keepRaw bool) (photo uploadedPhoto, release func(), ok bool) {
+	maxBytes := a.cfg.Upload.MaxPhotoBytes
+	var releases []func()
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	fail := func(err error) (uploadedPhoto, func(), bool) {
+		release()
+		a.writePhotoError(w, r, err)
+		return uploadedPhoto{}, nil, false
+	}
+
+	// De kop (max maxHeaderBytes, valt onder de reservering hieronder), max maxBytes+1 per foto
+	// zodat we "te groot" kunnen zien
+	stream := &streamReader{r: io.LimitReader(src, maxBytes+1)}
+	header, err := readPhotoHeader(stream)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Bepaal het juiste MIME type van de foto (WEBP en avif nog toevoegen)
+	contentType := meta.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = "image/jpeg" // Default
+		if sniffed := http.DetectContentType(header); strings.HasPrefix(sniffed, "image/") {
+			contentType = sniffed
+		}
+	}
+	photo = uploadedPhoto{ContentType: contentType, Filename: meta.Filename, Detail: settings.Detail, Settings: settings, Region: region}
+
+	// EXIF (opnametijd, locatie, toestel, orientation) voor de inspectie en de controles
+	if exif, err := parseEXIF(header, a.projects.zone); err == nil {
+		photo.EXIF = exif
+	} else if !errors.Is(err, errNoEXIF) {
+		loggerFrom(r.Context()).Debug("could not parse EXIF", "error", err)
+	}
+
+	// Afmetingen voor de schatting van de image tokens en de geheugenreservering
+	originalWidth, originalHeight := 0, 0
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(header)); err == nil {
+		originalWidth, originalHeight = cfg.Width, cfg.Height
+	}
+	photo.Width, photo.Height = originalWidth, originalHeight
+	photo.OriginalTokens = estimateImageTokens(originalWidth, originalHeight, "high")
+
+	tiling := tilesFit(originalWidth, originalHeight, settings)
+	decode := (settings.Preprocess || tiling || region != nil || a.cfg.Reuse.Enabled) && originalWidth > 0
+	upright := photo.EXIF.Orientation <= 1 || photo.EXIF.Orientation > 8
+	keepOriginal := !decode || !settings.Preprocess || (max(originalWidth, originalHeight) <= settings.MaxLongEdge && upright)
+
+	// Alles wat deze foto nodig heeft in één keer reserveren: wie de helft heeft en op de rest
+	// wacht, kan met andere uploads vastlopen. Blijvend: de voorbewerkte foto, het aangewezen
+	// gebied, de uitsneden en het bewaarde origineel (4x: de bytes, de data URL en de JSON body
+	// naar de provider) of de ruwe foto (1x). Tijdelijk: de kop en de gedecodeerde foto (~4
+	// bytes per pixel).
+	bound := maxBytes // de foto is hoogstens zo groot
+	if meta.Size > 0 {
+		bound = min(bound, meta.Size)
+	}
+	if originalWidth > 0 {
+		bound = min(bound, int64(originalWidth)*int64(originalHeight)*3) // ook een JPEG van 100% ruis
+	}
+	var keep, keptReserve, temporary int64
+	switch {
+	case keepOriginal:
+		keptReserve = bound * 4
+	case keepRaw:
+		keptReserve = bound
+	}
+	temporary = int64(len(header))
+	if decode {
+		if settings.Preprocess {
+			keep += renderReserve(originalWidth, originalHeight, settings.MaxLongEdge)
+		}
+		if region != nil {
+			keep += renderReserve(originalWidth, originalHeight, settings.MaxLongEdge)
+		}
+		if tiling {
+			keep += tileReserve(originalWidth, originalHeight, settings)
+		}
+		temporary += int64(originalWidth) * int64(originalHeight) * 4
+	}
+	if !a.reserveUploadMemory(w, r, keep+keptReserve+temporary) {
+		return uploadedPhoto{}, nil, false
+	}
+	releases = append(releases, func() { a.uploads.release(keep) })
+	defer func() { a.uploads.release(temporary) }()
+
+	// Wat de rest van de foto onderweg vult: altijd de hash en als het origineel of de ruwe foto
+	// nodig is een chunkBuffer (reserveert zelf bij als de schatting te krap was)
+	hasher := sha256.New()
+	writeJPEGWithoutMetadata(hasher, header)
+	stream.tee = hasher
+	var kept *chunkBuffer
+	if keepOriginal || keepRaw {
+		kept = new(chunkBuffer)
+		factor := int64(1)
+		if keepOriginal {
+			factor = 4
+		}
+		sink := a.reservingWriter(r.Context(), kept, factor, keptReserve)
+		releases = append(releases, sink.release, kept.release)
+		if _, err := sink.Write(header); err != nil {
+			return fail(err)
+		}
+		stream.tee = io.MultiWriter(hasher, sink)
+		if keepRaw {
+			photo.raw = formPhoto{ContentType: meta.ContentType, Filename: meta.Filename, Data: kept}
+		}
+	}
+	rest := io.Reader(stream)
+
+	// Rechtop draaien, verkleinen en opnieuw als JPEG opslaan (minder bytes en tokens) en
+	// eventueel uitsneden maken en de perceptuele hash berekenen. Alles uit één keer decoderen.
+	var modelBytes []byte
+	assessed := false
+	if decode {
+		processed := photoBuffers.Get().(*bytes.Buffer)
+		processed.Reset()
+		defer photoBuffers.Put(processed)
+
+		_, preprocessSpan := tracer.Start(r.Context(), "upload.preprocess", trace.WithAttributes(attribute.String("apiq.image.settings", settings.key())))
+		decoded, err := decodePhoto(io.MultiReader(bytes.NewReader(header), rest), photo.EXIF.Orientation)
+		// De decoder stopt bij het einde van het beeld; de rest moet nog door de hash
+		if _, drainErr := io.Copy(io.Discard, rest); err == nil {
+			err = drainErr
+		}
+		if stream.err != nil || stream.n > maxBytes {
+			endSpan(preprocessSpan, errPhotoRead)
+			return fail(stream.readError(maxBytes))
+		}
+		if err == nil && a.cfg.Reuse.Enabled {
+			photo.PHash = formatPHash(perceptualHash(decoded))
+		}
+		if err == nil {
+			photo.Risk, assessed = assessPhoto(header, contentType, photo.EXIF, &decoded), true
+		}
+		if err == nil && settings.Preprocess {
+			var width, height int
+			var ok bool
+			width, height, ok, err = preprocessPhoto(decoded, int(stream.n), settings, processed)
+			if ok {
+				modelBytes = processed.Bytes()
+				photo.ContentType = "image/jpeg"
+				photo.Width, photo.Height = width, height
+				preprocessSpan.SetAttributes(attribute.Int("apiq.image.bytes_out", len(modelBytes)))
+			}
+		}
+		if err == nil && region != nil {
+			var tile photoTile
+			tile, err = renderRegion(decoded, *region, settings)
+			photo.Tiles = append(photo.Tiles, tile)
+		}
+		if err == nil && tiling {
+			var tiles []photoTile
+			tiles, err = renderTiles(decoded, settings)
+			photo.Tiles = append(photo.Tiles, tiles...)
+			preprocessSpan.SetAttributes(attribute.Int("apiq.image.tiles", len(tiles)))
+		}
+		endSpan(preprocessSpan, err)
+		if err != nil && modelBytes == nil {
+			// Het origineel is alleen nog te sturen als we het bewaard hebben
+			if !keepOriginal {
+				loggerFrom(r.Context()).Warn("could not decode photo", "error", err)
+				return fail(fmt.Errorf("%w: %w", errPhotoRead, err))
+			}
+			loggerFrom(r.Context()).Warn("could not preprocess photo, sending original", "error", err)
+		} else if err != nil {
+			loggerFrom(r.Context()).Warn("could not render tiles", "error", err)
+		}
+	} else if io.Copy(io.Discard, rest); stream.err != nil || stream.n > maxBytes {
+		return fail(stream.readError(maxBytes))
+	}
+	if !assessed {
+		photo.Risk = assessPhoto(header, contentType, photo.EXIF, nil)
+	}
+	photo.Size = stream.n
+	photo.Hash = hex.EncodeToString(hasher.Sum(nil))
+
+	_, encodeSpan := tracer.Start(r.Context(), "upload.encode")
+	if modelBytes != nil {
+		photo.DataURL = dataURL(photo.ContentType, modelBytes)
+		photo.ModelBytes = int64(len(modelBytes))
+	} else {
+		photo.DataURL = kept.dataURL(photo.ContentType)
+		photo.ModelBytes = photo.Size
+	}
+	if kept != nil && !keepRaw {
+		kept.release() // het geheugen blijft gereserveerd voor de data URL
+	}
+	encodeSpan.SetAttributes(attribute.Int64("apiq.image.bytes", photo.ModelBytes))
+	encodeSpan.End()
+	return photo, release, true
+}
+
+// readPhotoHeader leest het begin van de foto: bij een JPEG alle segmenten tot en met de kop van
+// de scan (SOS), daar staan EXIF, de tabellen en de afmetingen; anders de eerste 512 bytes. Max
+// maxHeaderBytes. Een foto die korter is dan dat is geen fout.
+func readPhotoHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, 0, 64<<10)
+	read := func(n int) error {
+		n = min(n, maxHeaderBytes-len(header))
+		if n <= 0 {
+			return nil
+		}
+		start := len(header)
+		header = append(header, make([]byte, n)...)
+		got, err := io.ReadFull(r, header[start:])
+		header = header[:start+got]
+		return err
+	}
+	done := func(err error) ([]byte, error) {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return header, nil
+		}
+		return header, err
+	}
+
+	if err := read(4); err != nil {
+		return done(err)
+	}
+	if header[0] != 0xFF || header[1] != 0xD8 {
+		return done(read(508))
+	}
+	for pos := 2; len(header) < maxHeaderBytes; {
+		if err := read(pos + 4 - len(header)); err != nil {
+			return done(err)
+		}
+		if header[pos] != 0xFF {
+			return header, nil // geen segment: de decoder zoekt het verder uit
+		}
+		marker, length := header[pos+1], int(binary.BigEndian.Uint16(header[pos+2:]))
+		if length < 2 {
+			return header, nil
+		}
+		if err := read(pos + 2 + length - len(header)); err != nil {
+			return done(err)
+		}
+		pos += 2 + length
+		if marker == 0xDA {
+			break
+		}
+	}
+	return header, nil
+}
+
+// streamReader telt wat er van de foto gelezen is, schrijft het door naar tee (hash, bewaarde
+// kopieën) en onthoudt de eerste lees- of schrijffout (de decoder maakt er anders een formaatfout van)
+type streamReader struct {
+	r   io.Reader
+	tee io.Writer // nil tijdens het lezen van de kop
+	n   int64
+	err error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if n > 0 && s.tee != nil {
+		if _, writeErr := s.tee.Write(p[:n]); writeErr != nil {
+			err = writeErr
+		}
+	}
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// readError is de fout na het lezen: een leesfout of een te grote foto
+func (s *streamReader) readError(maxBytes int64) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.n > maxBytes {
+		return errPhotoTooLarge
+	}
+	return nil
+}
+
+// writePhotoError vertaalt een fout bij het lezen van een foto naar de response
+func (a *app) writePhotoError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr), errors.Is(err, errPhotoTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, a.photoTooLarge())
+	case errors.Is(err, errServerBusy):
+		writeServerBusy(w, r, err)
+	default:
+		writeError(w, http.StatusBadRequest, "Could not read photo")
+	}
+}
+
+// reservingWriter schrijft door naar w; factor bytes per geschreven byte moeten gereserveerd
+// zijn. reserved is al vooraf gereserveerd, wat erbij komt in stappen van reserveStep. Geen
+// geheugen binnen InFlightWait: errServerBusy.
+type reservingWriter struct {
+	a        *app
+	ctx      context.Context
+	w        io.Writer
+	factor   int64
+	written  int64
+	reserved int64
+}
+
+func (a *app) reservingWriter(ctx context.Context, w io.Writer, factor, reserved int64) *reservingWriter {
+	return &reservingWriter{a: a, ctx: ctx, w: w, factor: factor, reserved: reserved}
+}
+
+func (rw *reservingWriter) Write(p []byte) (int, error) {
+	for (rw.written+int64(len(p)))*rw.factor > rw.reserved {
+		ctx, cancel := context.WithTimeout(rw.ctx, time.Duration(rw.a.cfg.Upload.InFlightWait))
+		err := rw.a.uploads.acquire(ctx, reserveStep)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", errServerBusy, err)
+		}
+		rw.reserved += reserveStep
+	}
+	rw.written += int64(len(p))
+	return rw.w.Write(p)
+}
+
+// release geeft al het gereserveerde geheugen terug
+func (rw *reservingWriter) release() {
+	rw.a.uploads.release(rw.reserved)
+	rw.reserved = 0
+}
+
+// reserveUploadMemory wacht (max InFlightWait) tot er n bytes vrij zijn voor deze upload.
+// Bij false is 503 SERVER_BUSY al verstuurd.
+func (a *app) reserveUploadMemory(w http.ResponseWriter, r *http.Request, n int64) bool {
+	waitCtx, cancel := context.WithTimeout(r.Context(), time.Duration(a.cfg.Upload.InFlightWait))
+	defer cancel()
+	if err := a.uploads.acquire(waitCtx, n); err != nil {
+		writeServerBusy(w, r, err)
+		return false
+	}
+	return true
+}
+
+// writeServerBusy stuurt 503 SERVER_BUSY met Retry-After
+func writeServerBusy(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Retry-After", "1")
+	writeAnalysisError(w, r, &upstreamError{Code: codeServerBusy, Status: http.StatusServiceUnavailable, Message: "Server busy, too many uploads in progress", Err: err})
+}
+
+// dataURL schrijft de foto in één keer als data URL, in een builder van de juiste grootte (geen extra base64 kopie)
+func dataURL(contentType string, data []byte) string {
+	prefix := "data:" + contentType + ";base64,"
+	var url strings.Builder
+	url.Grow(len(prefix) + base64.StdEncoding.EncodedLen(len(data)))
+	url.WriteString(prefix)
+	encoder := base64.NewEncoder(base64.StdEncoding, &url)
+	encoder.Write(data)
+	encoder.Close()
+	return url.String()
+}
+
+// ========================================
+// IN-FLIGHT BYTES LIMIET (voor alle uploads samen)
+// ========================================
+
+// byteLimiter begrenst hoeveel bytes aan foto's er tegelijk in memory zijn
+type byteLimiter struct {
+	max int64
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // wordt gesloten (en vervangen) bij elke release
+}
+
+func newByteLimiter(max int64) *byteLimiter {
+	return &byteLimiter{max: max, changed: make(chan struct{})}
+}
+
+// acquire wacht tot er n bytes vrij zijn, of tot ctx afloopt. Meer dan max mag nog steeds,
+// maar dan wel alleen.
+func (l *byteLimiter) acquire(ctx context.Context, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.used+n <= l.max || l.used == 0 {
+			l.used += n
+			uploadBytesInFlight.Set(float64(l.used))
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for upload memory: %w", ctx.Err())
+		}
+	}
+}
+
+// release geeft n bytes terug; een reservering mag in delen terug
+func (l *byteLimiter) release(n int64) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.used -= n
+	uploadBytesInFlight.Set(float64(l.used))
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchUploads is het aantal gelijktijdige uploads in BenchmarkReadPhotos
+const benchUploads = 50
+
+var (
+	benchPhotoOnce sync.Once
+	benchPhoto     []byte
+)
+
+// noisyJPEG is een telefoonachtige foto: 12 MP met ruis, zodat hij niet wegcomprimeert (~6 MB)
+func noisyJPEG(b *testing.B) []byte {
+	benchPhotoOnce.Do(func() {
+		rng := rand.New(rand.NewSource(1))
+		img := image.NewRGBA(image.Rect(0, 0, 4000, 3000))
+		for y := 0; y < 3000; y++ {
+			for x := 0; x < 4000; x++ {
+				img.Set(x, y, color.RGBA{R: uint8(x/16) + uint8(rng.Intn(48)), G: uint8(y/12) + uint8(rng.Intn(48)), B: uint8(rng.Intn(48)), A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			b.Fatal(err)
+		}
+		benchPhoto = buf.Bytes()
+	})
+	return benchPhoto
+}
+
+// readPhotoMultipartForm is het oude leespad, als vergelijking: ParseMultipartForm (met temp
+// file boven maxBytes), io.ReadAll en een aparte base64 string die daarna nog in de data URL gaat.
+// Met settings wordt de hele foto daarna gedecodeerd en verkleind, zoals het oude preparePhoto.
+func readPhotoMultipartForm(r *http.Request, maxBytes int64, settings *imageSettings) (string, error) {
+	if err := r.ParseMultipartForm(maxBytes); err != nil {
+		return "", err
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("photo")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	photoBytes, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	photoHash(photoBytes)
+	image.DecodeConfig(bytes.NewReader(photoBytes))
+	if settings != nil {
+		decoded, err := decodePhoto(bytes.NewReader(photoBytes), 0)
+		if err != nil {
+			return "", err
+		}
+		var processed bytes.Buffer
+		if _, _, _, err := preprocessPhoto(decoded, len(photoBytes), *settings, &processed); err != nil {
+			return "", err
+		}
+		return dataURL("image/jpeg", processed.Bytes()), nil
+	}
+	return "data:" + header.Header.Get("Content-Type") + ";base64," + base64.StdEncoding.EncodeToString(photoBytes), nil
+}
+
+// BenchmarkReadPhotos leest 50 uploads tegelijk van een foto van ~6 MB en rapporteert naast
+// allocs/op het hoogste heap gebruik tijdens de run (peak-MB, boven wat er al stond).
+// "multipartForm" is het oude pad en "readPhotos" het gestreamde, elk zonder ("original") en met
+// verkleinen ("preprocessed"). "silverHandler" is de hele request met een fake provider. De
+// limiter staat ruim, zodat we het pad meten; "silverHandler/limited" gebruikt de standaard
+// MAX_IN_FLIGHT_BYTES (512 MB) en laat zien dat die de piek begrenst.
+//
+//	go test ./cmd/api -run '^$' -bench ReadPhotos -benchmem -benchtime 100x
+func BenchmarkReadPhotos(b *testing.B) {
+	photo := noisyJPEG(b)
+	check, _ := findCheck("powerCordInSocket")
+	url := "/api/laundry/silver/v1/powerCordInSocket"
+
+	// Het formulier één keer opbouwen; elke upload leest het opnieuw
+	form := photoRequest(b, url, photo)
+	body, _ := io.ReadAll(form.Body)
+	contentType := form.Header.Get("Content-Type")
+
+	newApp := func(b *testing.B, chain ...visionProvider) *app {
+		a := newTestApp(b, chain...)
+		a.cfg.Pricing = map[string]modelPrice{"fake-model": {}}
+		a.cfg.Reuse.Enabled = false
+		a.cfg.Upload.InFlightWait = duration(time.Hour) // één core: in de rij staan is hier geen fout
+		a.uploads = newByteLimiter(1 << 40)
+		return a
+	}
+	// SetParallelism vermenigvuldigt GOMAXPROCS: zo draaien er ~50 uploads tegelijk
+	parallel := func(b *testing.B, upload func(*http.Request)) {
+		b.SetBytes(int64(len(photo)))
+		b.ReportAllocs()
+		b.SetParallelism((benchUploads + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+		stop := measurePeakHeap(b)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+				r.Header.Set("Content-Type", contentType)
+				upload(r)
+			}
+		})
+		b.StopTimer()
+		stop()
+	}
+	readPhotos := func(preprocess bool) func(b *testing.B) {
+		return func(b *testing.B) {
+			a := newApp(b)
+			settings := a.cfg.imageSettingsFor(check.ID)
+			settings.Preprocess = preprocess
+			parallel(b, func(r *http.Request) {
+				rec := httptest.NewRecorder()
+				_, release, ok := a.readPhotos(rec, r, "silver", settings, 1, false)
+				if !ok {
+					b.Errorf("readPhotos: %d %s", rec.Code, rec.Body)
+					return
+				}
+				release()
+			})
+		}
+	}
+
+	multipartForm := func(preprocess bool) func(b *testing.B) {
+		return func(b *testing.B) {
+			a := newApp(b)
+			var settings *imageSettings
+			if preprocess {
+				s := a.cfg.imageSettingsFor(check.ID)
+				settings = &s
+			}
+			parallel(b, func(r *http.Request) {
+				if _, err := readPhotoMultipartForm(r, a.cfg.Upload.MaxPhotoBytes, settings); err != nil {
+					b.Error(err)
+				}
+			})
+		}
+	}
+	silverHandler := func(limited bool) func(b *testing.B) {
+		return func(b *testing.B) {
+			a := newApp(b, &fakeProvider{id: "fake", content: "PASS"})
+			if limited {
+				a.uploads = newByteLimiter(a.cfg.Upload.MaxInFlightBytes)
+			}
+			handler := a.silverHandler(check)
+			parallel(b, func(r *http.Request) {
+				rec := httptest.NewRecorder()
+				handler(rec, r)
+				if rec.Code != http.StatusOK {
+					b.Errorf("silver: %d %s", rec.Code, rec.Body)
+				}
+			})
+		}
+	}
+
+	b.Run("multipartForm/original", multipartForm(false))
+	b.Run("readPhotos/original", readPhotos(false))
+	b.Run("multipartForm/preprocessed", multipartForm(true))
+	b.Run("readPhotos/preprocessed", readPhotos(true))
+	b.Run("silverHandler", silverHandler(false))
+	b.Run("silverHandler/limited", silverHandler(true))
+}
+
+// measurePeakHeap meet tot stop() elke paar milliseconden HeapInuse en rapporteert het hoogste
+// punt boven de stand bij de start als peak-MB
+func measurePeakHeap(b *testing.B) (stop func()) {
+	runtime.GC()
+	var start runtime.MemStats
+	runtime.ReadMemStats(&start)
+
+	var peak uint64
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(2 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapInuse)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+		b.ReportMetric(float64(peak-min(peak, start.HeapInuse))/(1<<20), "peak-MB")
+	}
+}
+
+// withAPP1 zet een APP1 segment (zoals EXIF) direct na de SOI van een JPEG
+func withAPP1(photo, payload []byte) []byte {
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	out := append([]byte{}, photo[:2]...)
+	out = append(out, segment...)
+	out = append(out, payload...)
+	return append(out, photo[2:]...)
+}
+
+func TestPreparePhotoStreams(t *testing.T) {
+	plain := testJPEG(t, 3000, 2000)
+	tagged := withAPP1(plain, append([]byte("Exif\x00\x00"), bytes.Repeat([]byte{0}, 300)...))
+	var pngPhoto bytes.Buffer
+	png.Encode(&pngPhoto, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+
+	tests := []struct {
+		name       string
+		photo      []byte
+		preprocess bool
+		wantWidth  int
+		original   bool // het origineel gaat ongewijzigd naar het model
+	}{
+		{"downscaled JPEG", tagged, true, 2048, false},
+		{"original JPEG", tagged, false, 3000, true},
+		{"small PNG kept", pngPhoto.Bytes(), true, 40, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			settings := a.cfg.imageSettingsFor("powerCordInSocket")
+			settings.Preprocess = tt.preprocess
+
+			rec := httptest.NewRecorder()
+			photo, release, ok := a.preparePhoto(rec, httptest.NewRequest(http.MethodPost, "/", nil), bytes.NewReader(tt.photo), formPhoto{}, settings, nil, false)
+			if !ok {
+				t.Fatalf("preparePhoto: %d %s", rec.Code, rec.Body)
+			}
+			// Zelfde hash als over de hele foto in één keer, zonder metadata
+			if want := photoHash(tt.photo); photo.Hash != want {
+				t.Errorf("hash %s, want %s", photo.Hash, want)
+			}
+			if photo.Size != int64(len(tt.photo)) || photo.Width != tt.wantWidth {
+				t.Errorf("size %d, width %d, want %d and %d", photo.Size, photo.Width, len(tt.photo), tt.wantWidth)
+			}
+			if got := photo.DataURL == dataURL(photo.ContentType, tt.photo); got != tt.original {
+				t.Errorf("original sent = %v, want %v", got, tt.original)
+			}
+			release()
+			if a.uploads.used != 0 {
+				t.Errorf("%d bytes still reserved after release", a.uploads.used)
+			}
+		})
+	}
+	if photoHash(tagged) != photoHash(plain) {
+		t.Error("metadata changes the photo hash")
+	}
+}
+
+func TestReadPhotosRegionOrder(t *testing.T) {
+	photo := testJPEG(t, 64, 48)
+	request := func(fields ...string) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for _, field := range fields {
+			if field == "photo" {
+				part, _ := form.CreateFormFile("photo", "photo.jpg")
+				part.Write(photo)
+				continue
+			}
+			form.WriteField("region", field)
+		}
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		return r
+	}
+
+	a := newTestApp(t)
+	settings := a.cfg.imageSettingsFor("powerCordInSocket")
+	rec := httptest.NewRecorder()
+	photos, release, ok := a.readPhotos(rec, request("0.5,0.5", "photo"), "gold", settings, 1, false)
+	if !ok {
+		t.Fatalf("region before the photo: %d %s", rec.Code, rec.Body)
+	}
+	if len(photos[0].Tiles) != 1 || !photos[0].Tiles[0].Marked {
+		t.Errorf("tiles = %+v, want the marked region", photos[0].Tiles)
+	}
+	release()
+
+	// De foto is al voorbereid als het gebied komt
+	rec = httptest.NewRecorder()
+	if _, _, ok := a.readPhotos(rec, request("photo", "0.5,0.5"), "gold", settings, 1, false); ok || rec.Code != http.StatusBadRequest {
+		t.Errorf("region after the photo: %d, want 400", rec.Code)
+	}
+	if a.uploads.used != 0 {
+		t.Errorf("%d bytes still reserved after a rejected form", a.uploads.used)
+	}
+}
+
+func TestReadPhotosTooLarge(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.Upload.MaxPhotoBytes = 1 << 10
+	rec := httptest.NewRecorder()
+	if _, _, ok := a.readPhotos(rec, photoRequest(t, "/", testJPEG(t, 400, 300)), "gold", a.cfg.imageSettingsFor("powerCordInSocket"), 1, false); ok || rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", rec.Code)
+	}
+	if a.uploads.used != 0 {
+		t.Errorf("%d bytes still reserved after 413", a.uploads.used)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========================================
+// TOKEN USAGE & KOSTEN
+// ========================================
+
+// tokenUsage zijn de tokens van één AI call. ImageTokens is een schatting en
+// zit ook al in PromptTokens (OpenAI rapporteert ze niet apart).
+type tokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	ImageTokens      int `json:"imageTokens"`
+}
+
+// modelPrice is de prijs in USD per 1 miljoen tokens
+type modelPrice struct {
+	InputPerMillion  float64 `json:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion"`
+}
+
+// defaultPricing zijn de OpenAI list prices; overschrijfbaar via "pricing" in de config
+var defaultPricing = map[string]modelPrice{
+	"gpt-5-nano":  {InputPerMillion: 0.05, OutputPerMillion: 0.40},
+	"gpt-5-mini":  {InputPerMillion: 0.25, OutputPerMillion: 2.00},
+	"gpt-5":       {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+	"gpt-4o-mini": {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4o":      {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+}
+
+// priceFor zoekt de prijs van een model: eerst exact, dan de langste prefix
+// (zodat "gpt-5-nano-2025-08-07" de prijs van "gpt-5-nano" krijgt)
+func priceFor(pricing map[string]modelPrice, model string) (modelPrice, bool) {
+	if price, ok := pricing[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range pricing {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return pricing[best], true
+}
+
+// costUSD rekent tokens om naar dollars
+func costUSD(price modelPrice, usage tokenUsage) float64 {
+	return float64(usage.PromptTokens)*price.InputPerMillion/1e6 +
+		float64(usage.CompletionTokens)*price.OutputPerMillion/1e6
+}
+
+// costOf is costUSD met de prijs van model; zonder prijs 0 (en een waarschuwing)
+func (a *app) costOf(r *http.Request, model string, usage tokenUsage) float64 {
+	if usage == (tokenUsage{}) {
+		return 0
+	}
+	price, ok := priceFor(a.cfg.Pricing, model)
+	if !ok {
+		loggerFrom(r.Context()).Warn("no price configured for model, cost recorded as 0", "model", model)
+		return 0
+	}
+	return costUSD(price, usage)
+}
+
+// plus telt twee verbruiken op
+func (u tokenUsage) plus(other tokenUsage) tokenUsage {
+	return tokenUsage{u.PromptTokens + other.PromptTokens, u.CompletionTokens + other.CompletionTokens, u.ImageTokens + other.ImageTokens}
+}
+
+// minus haalt een deel van het verbruik eraf (nooit onder 0)
+func (u tokenUsage) minus(other tokenUsage) tokenUsage {
+	return tokenUsage{max(u.PromptTokens-other.PromptTokens, 0), max(u.CompletionTokens-other.CompletionTokens, 0), max(u.ImageTokens-other.ImageTokens, 0)}
+}
+
+// estimateImageTokens schat de tokens van een foto volgens de OpenAI tile formule:
+// schalen naar max 2048x2048, korte zijde naar 768, dan 85 + 170 per tegel van 512x512.
+// Met detail "low" is het altijd 85.
+func estimateImageTokens(width, height int, detail string) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	if detail == "low" {
+		return 85
+	}
+	w, h := float64(width), float64(height)
+	if longest := math.Max(w, h); longest > 2048 {
+		w, h = w*2048/longest, h*2048/longest
+	}
+	if shortest := math.Min(w, h); shortest > 768 {
+		w, h = w*768/shortest, h*768/shortest
+	}
+	tiles := math.Ceil(w/512) * math.Ceil(h/512)
+	return 85 + 170*int(tiles)
+}
+
+// writeUsageHeaders zet de X-Usage-* headers (bij een stapel foto's de som, zie classify.go)
+func writeUsageHeaders(w http.ResponseWriter, usage tokenUsage, cost float64) {
+	w.Header().Set("X-Usage-Prompt-Tokens", strconv.Itoa(usage.PromptTokens))
+	w.Header().Set("X-Usage-Completion-Tokens", strconv.Itoa(usage.CompletionTokens))
+	w.Header().Set("X-Usage-Image-Tokens", strconv.Itoa(usage.ImageTokens))
+	w.Header().Set("X-Usage-Cost-USD", strconv.FormatFloat(cost, 'f', 6, 64))
+}
+
+// recordInspection slaat de inspectie op met tokens en kosten en zet de X-Usage-* headers.
+// De tokens staan al in in.Usage (zie judge); van de foto's komen de EXIF, hashes en risicoscore.
+func (a *app) recordInspection(w http.ResponseWriter, r *http.Request, in inspection, photos []uploadedPhoto) inspection {
+	in.ID = newInspectionID()
+	in.RequestID = requestID(r.Context())
+	in.Tenant = tenantFrom(r.Context())
+	in.CreatedAt = time.Now().UTC()
+	if photos[0].EXIF != (exifData{}) {
+		exif := photos[0].EXIF
+		in.EXIF = &exif
+	}
+	in.PHash = photos[0].PHash
+	if len(photos) > 1 {
+		in.Photos = len(photos)
+		for _, photo := range photos {
+			in.PHashes = append(in.PHashes, photo.PHash)
+		}
+	}
+	if risk := highestRisk(photos); risk.Score > 0 {
+		in.Risk = &risk
+	}
+
+	// De classificatie vooraf kan een ander (goedkoper) model zijn dan de check
+	checkUsage := in.Usage
+	if in.ClassifierUsage != nil {
+		checkUsage = in.Usage.minus(*in.ClassifierUsage)
+		in.CostUSD += a.costOf(r, in.ClassifierModel, *in.ClassifierUsage)
+	}
+	in.CostUSD += a.costOf(r, in.Model, checkUsage)
+
+	if err := a.inspections.add(in); err != nil {
+		// Het resultaat is belangrijker dan de administratie: wel loggen, niet falen
+		loggerFrom(r.Context()).Error("could not store inspection", "inspectionId", in.ID, "error", err)
+	}
+
+	w.Header().Set("X-Inspection-ID", in.ID)
+	writeUsageHeaders(w, in.Usage, in.CostUSD)
+	addLogAttrs(r.Context(),
+		slog.String("inspectionId", in.ID),
+		slog.Int("promptTokens", in.Usage.PromptTokens),
+		slog.Int("completionTokens", in.Usage.CompletionTokens),
+		slog.Float64("costUsd", in.CostUSD),
+	)
+
+	return in
+}
+
+// ========================================
+// USAGE API: GET /api/usage/v1
+// ========================================
+
+// usageGroup is het totaal van een groep inspecties (bijv. per project per dag)
+type usageGroup struct {
+	Tenant           string         `json:"tenant,omitempty"`
+	ProjectNumber    *string        `json:"projectNumber,omitempty"`
+	Check            string         `json:"check,omitempty"`
+	Tier             string         `json:"tier,omitempty"`
+	Day              string         `json:"day,omitempty"`
+	Inspections      int            `json:"inspections"`
+	PromptTokens     int            `json:"promptTokens"`
+	CompletionTokens int            `json:"completionTokens"`
+	ImageTokens      int            `json:"imageTokens"`
+	CostUSD          float64        `json:"costUsd"`
+	Flags            map[string]int `json:"flags,omitempty"` // aantal inspecties per flag, bijv. LOCATION_OUTSIDE_GEOFENCE
+}
+
+func (g *usageGroup) add(in inspection) {
+	g.Inspections++
+	for _, flag := range in.Flags {
+		if g.Flags == nil {
+			g.Flags = make(map[string]int)
+		}
+		g.Flags[flag]++
+	}
+	g.PromptTokens += in.Usage.PromptTokens
+	g.CompletionTokens += in.Usage.CompletionTokens
+	g.ImageTokens += in.Usage.ImageTokens
+	g.CostUSD += in.CostUSD
+}
+
+// merge telt de totalen van een andere groep erbij (zie inspectionStore.usage)
+func (g *usageGroup) merge(other usageGroup) {
+	g.Inspections += other.Inspections
+	for flag, n := range other.Flags {
+		if g.Flags == nil {
+			g.Flags = make(map[string]int)
+		}
+		g.Flags[flag] += n
+	}
+	g.PromptTokens += other.PromptTokens
+	g.CompletionTokens += other.CompletionTokens
+	g.ImageTokens += other.ImageTokens
+	g.CostUSD += other.CostUSD
+}
+
+// UsageResponse is het antwoord van de usage API
+type UsageResponse struct {
+	Tenant  string       `json:"tenant"`
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	GroupBy []string     `json:"groupBy"`
+	Totals  usageGroup   `json:"totals"`
+	Groups  []usageGroup `json:"groups"`
+}
+
+var validUsageGroups = map[string]bool{"project": true, "check": true, "tier": true, "day": true}
+
+// usageHandler geeft tokens en kosten van de eigen tenant, gegroepeerd per
+// project/check/tier/dag. Query: ?from=2025-10-01&to=2025-10-31&groupBy=project,day
+func (a *app) usageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "ONLY GET REQUESTS ARE ALLOWED")
+		return
+	}
+
+	// Standaard: de huidige maand (UTC)
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.DateOnly, value); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.DateOnly, value); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+	}
+	if to.Before(from) {
+		writeError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+
+	groupBy := []string{"day"}
+	if value := r.URL.Query().Get("groupBy"); value != "" {
+		groupBy = splitList(value)
+		for _, g := range groupBy {
+			if !validUsageGroups[g] {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid groupBy %q. Valid: project, check, tier, day", g))
+				return
+			}
+		}
+	}
+
+	tenant := tenantFrom(r.Context())
+	end := to.AddDate(0, 0, 1) // "to" is inclusief
+	rollups := a.inspections.usage(tenant, from, end)
+
+	response := UsageResponse{
+		Tenant:  tenant,
+		From:    from.Format(time.DateOnly),
+		To:      to.Format(time.DateOnly),
+		GroupBy: groupBy,
+		Groups:  []usageGroup{},
+	}
+
+	groups := make(map[string]*usageGroup)
+	var order []string
+	for rollup, totals := range rollups {
+		response.Totals.merge(totals)
+
+		group := usageGroup{}
+		var key []string
+		for _, g := range groupBy {
+			switch g {
+			case "project":
+				project := rollup.ProjectNumber
+				group.ProjectNumber = &project
+				key = append(key, project)
+			case "check":
+				group.Check = rollup.Check
+				key = append(key, rollup.Check)
+			case "tier":
+				group.Tier = rollup.Tier
+				key = append(key, rollup.Tier)
+			case "day":
+				group.Day = rollup.Day
+				key = append(key, group.Day)
+			}
+		}
+
+		k := strings.Join(key, "\x00")
+		if _, ok := groups[k]; !ok {
+			groups[k] = &group
+			order = append(order, k)
+		}
+		groups[k].merge(totals)
+	}
+
+	sort.Strings(order)
+	for _, k := range order {
+		response.Groups = append(response.Groups, *groups[k])
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
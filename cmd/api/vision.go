@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Foutcodes die we teruggeven als het AI model (upstream) niet goed antwoordt
+const (
+	codeUpstreamRateLimited   = "UPSTREAM_RATE_LIMITED"
+	codeUpstreamUnavailable   = "UPSTREAM_UNAVAILABLE"
+	codeUpstreamTimeout       = "UPSTREAM_TIMEOUT"
+	codeUpstreamRejectedImage = "UPSTREAM_REJECTED_IMAGE"
+	codeAnalysisFailed        = "AI_ANALYSIS_FAILED"
+)
+
+// upstreamError beschrijft waarom de AI analyse niet gelukt is en welke status de client krijgt
+type upstreamError struct {
+	Code       string
+	Status     int
+	Message    string
+	RetryAfter time.Duration // 0 = onbekend
+	Err        error
+}
+
+func (e *upstreamError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	return e.Code
+}
+
+func (e *upstreamError) Unwrap() error { return e.Err }
+
+// retryable geeft aan of het zin heeft om dezelfde request nog een keer te proberen
+func (e *upstreamError) retryable() bool {
+	return e.Code == codeUpstreamRateLimited || e.Code == codeUpstreamUnavailable
+}
+
+// retryPolicy bepaalt hoe vaak en hoe lang we wachten tussen pogingen
+type retryPolicy struct {
+	MaxAttempts int           // totaal aantal pogingen (inclusief de eerste)
+	BaseDelay   time.Duration // wachttijd na de eerste mislukte poging
+	MaxDelay    time.Duration // maximale wachttijd tussen twee pogingen
+}
+
+// backoff berekent de wachttijd voor poging n (0-based) met "full jitter"
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := float64(p.BaseDelay) * math.Pow(2, float64(attempt))
+	if ceiling > float64(p.MaxDelay) {
+		ceiling = float64(p.MaxDelay)
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// visionRequest is alles wat nodig is om één foto te laten beoordelen
+type visionRequest struct {
+	Check        string // check id, bijv. "shippingBoltsRemoved"
+	SystemPrompt string
+	UserText     string
+	ImageURL     string // data URL van de foto
+	ImageDetail  string // low, high of auto
+
+	MoreImageURLs []string // meer foto's van dezelfde installatie in één call (zie photos.go)
+}
+
+// visionClient stuurt foto's naar één AI model, met retries en een circuit breaker
+type visionClient struct {
+	providerName string
+	client       *openai.Client
+	model        string
+	retry        retryPolicy
+	timeout      time.Duration // max duur van één call (0 = geen eigen timeout)
+	breaker      *circuitBreaker
+}
+
+// newVisionClient maakt een client voor een OpenAI-compatibel endpoint (baseURL leeg = OpenAI)
+func newVisionClient(p providerConfig, retry retryConfig, breaker breakerConfig) *visionClient {
+	clientConfig := openai.DefaultConfig(p.APIKey)
+	if p.BaseURL != "" {
+		clientConfig.BaseURL = p.BaseURL
+	}
+	clientConfig.HTTPClient = retryAfterDoer{doer: http.DefaultClient}
+
+	return &visionClient{
+		providerName: p.Name,
+		client:       openai.NewClientWithConfig(clientConfig),
+		model:        p.Model,
+		retry: retryPolicy{
+			MaxAttempts: retry.MaxAttempts,
+			BaseDelay:   time.Duration(retry.BaseDelay),
+			MaxDelay:    time.Duration(retry.MaxDelay),
+		},
+		timeout: time.Duration(retry.AttemptTimeout),
+		breaker: newCircuitBreaker(breaker.Threshold, time.Duration(breaker.Cooldown)),
+	}
+}
+
+func (v *visionClient) name() string { return v.providerName }
+
+// providerAnswer is het ruwe antwoord (tekst) van het model plus het verbruik
+type providerAnswer struct {
+	Content string
+	Model   string // model zoals de provider het rapporteert (bijv. "gpt-5-nano-2025-08-07")
+	Usage   tokenUsage
+}
+
+// analyze stuurt de foto naar het model en geeft het ruwe antwoord (tekst) terug
+func (v *visionClient) analyze(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	var lastErr *upstreamError
+
+	for attempt := 0; attempt < v.retry.MaxAttempts; attempt++ {
+		// Circuit breaker open? Dan niet eens proberen, direct 503
+		if wait, ok := v.breaker.allow(); !ok {
+			breakerRejectionsTotal.WithLabelValues(v.name()).Inc()
+			return providerAnswer{}, &upstreamError{
+				Code:       codeUpstreamUnavailable,
+				Status:     http.StatusServiceUnavailable,
+				Message:    "AI provider temporarily unavailable",
+				RetryAfter: wait,
+			}
+		}
+
+		answer, err := v.callWithTimeout(ctx, req)
+		if err == nil {
+			v.breaker.success()
+			return answer, nil
+		}
+
+		lastErr = classifyUpstreamError(err)
+		switch {
+		case errors.Is(err, context.Canceled):
+			// Client is weg: dat zegt niets over de provider, en opnieuw proberen heeft geen zin
+			v.breaker.abandon()
+			return providerAnswer{}, lastErr
+		case lastErr.Code == codeUpstreamUnavailable || lastErr.Code == codeUpstreamTimeout:
+			v.breaker.failure()
+		default:
+			v.breaker.success() // provider reageert wel, dus hij is niet "down"
+		}
+
+		if !lastErr.retryable() || attempt == v.retry.MaxAttempts-1 {
+			break
+		}
+
+		// Wacht minimaal zo lang als de provider vraagt (Retry-After), anders backoff met jitter
+		delay := v.retry.backoff(attempt)
+		if lastErr.RetryAfter > delay {
+			delay = lastErr.RetryAfter
+		}
+		if delay > v.retry.MaxDelay {
+			// Provider wil dat we langer wachten dan we willen blokkeren, geef het door aan de client
+			break
+		}
+
+		providerRetriesTotal.WithLabelValues(v.name(), lastErr.Code).Inc()
+		select {
+		case <-ctx.Done():
+			// Deadline of client weg tijdens het wachten: de laatste fout van de provider blijft zichtbaar in de log
+			return providerAnswer{}, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+		case <-time.After(delay):
+		}
+	}
+
+	return providerAnswer{}, lastErr
+}
+
+// callWithTimeout is call met de eigen timeout van de client. Hangt de provider, dan
+// kan de router daarna nog de volgende provider proberen binnen de tier timeout.
+func (v *visionClient) callWithTimeout(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	if v.timeout <= 0 {
+		return v.call(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	return v.call(ctx, req)
+}
+
+// call doet één enkele request naar OpenAI
+func (v *visionClient) call(ctx context.Context, req visionRequest) (providerAnswer, error) {
+	var retryAfter time.Duration
+	ctx = context.WithValue(ctx, retryAfterKey{}, &retryAfter)
+
+	parts := []openai.ChatMessagePart{
+		{ // User message (gewone instructie)
+			Type: openai.ChatMessagePartTypeText,
+			Text: req.UserText,
+		},
+	}
+	dataURLBytes := 0
+	for _, url := range append([]string{req.ImageURL}, req.MoreImageURLs...) {
+		parts = append(parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL:    url,
+				Detail: openai.ImageURLDetail(req.ImageDetail),
+			},
+		})
+		dataURLBytes += len(url)
+	}
+
+	ctx, span := tracer.Start(ctx, "provider.call", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("apiq.provider", v.name()),
+		attribute.String("apiq.model", v.model),
+		attribute.String("apiq.check", req.Check),
+		attribute.Int("apiq.image.data_url_bytes", dataURLBytes),
+	))
+
+	started := time.Now()
+	resp, err := v.client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model: v.model,
+			Messages: []openai.ChatCompletionMessage{
+				// System prompt (instructies voor de AI)
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: req.SystemPrompt,
+				},
+				{
+					Role:         openai.ChatMessageRoleUser,
+					MultiContent: parts, // instructie plus de foto('s)
+				},
+			},
+		},
+	)
+	if err != nil {
+		err = retryAfterError{err: err, retryAfter: retryAfter}
+		observeProviderCall(v.name(), req.Check, started, err)
+		endSpan(span, err)
+		return providerAnswer{}, err
+	}
+	span.SetAttributes(
+		attribute.Int("apiq.tokens.prompt", resp.Usage.PromptTokens),
+		attribute.Int("apiq.tokens.completion", resp.Usage.CompletionTokens),
+	)
+	span.End()
+	observeProviderCall(v.name(), req.Check, started, nil)
+	providerTokensTotal.WithLabelValues(v.name(), checkLabel(req.Check), "prompt").Add(float64(resp.Usage.PromptTokens))
+	providerTokensTotal.WithLabelValues(v.name(), checkLabel(req.Check), "completion").Add(float64(resp.Usage.CompletionTokens))
+
+	if len(resp.Choices) == 0 {
+		// De tokens zijn al betaald: niet opnieuw proberen, en de provider is niet "down"
+		return providerAnswer{}, &upstreamError{Code: codeAnalysisFailed, Status: http.StatusInternalServerError, Message: "AI analysis failed", Err: errors.New("AI response contained no choices")}
+	}
+
+	answer := providerAnswer{
+		Content: resp.Choices[0].Message.Content,
+		Model:   resp.Model,
+		Usage: tokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		},
+	}
+	if answer.Model == "" {
+		answer.Model = v.model
+	}
+	return answer, nil
+}
+
+// retryAfterError bewaart de Retry-After header van een mislukte response
+type retryAfterError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e retryAfterError) Error() string { return e.err.Error() }
+func (e retryAfterError) Unwrap() error { return e.err }
+
+// classifyUpstreamError vertaalt een fout van de OpenAI SDK naar onze eigen foutcodes
+func classifyUpstreamError(err error) *upstreamError {
+	var upErr *upstreamError
+	if errors.As(err, &upErr) {
+		return upErr
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		// Provider antwoordde niet binnen de timeout van de tier: telt als fout voor de breaker
+		return &upstreamError{Code: codeUpstreamTimeout, Status: http.StatusGatewayTimeout, Message: "AI provider did not answer in time", Err: err}
+	case errors.Is(err, context.Canceled):
+		return &upstreamError{Code: codeAnalysisFailed, Status: http.StatusInternalServerError, Message: "AI analysis canceled", Err: err}
+	}
+
+	var retryAfter time.Duration
+	var raErr retryAfterError
+	if errors.As(err, &raErr) {
+		retryAfter = raErr.retryAfter
+	}
+
+	statusCode := 0
+	message := ""
+	code := ""
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+		message = strings.ToLower(apiErr.Message)
+		if c, ok := apiErr.Code.(string); ok {
+			code = c
+		}
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+		message = strings.ToLower(string(reqErr.Body))
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests && code == "insufficient_quota":
+		// Geen tijdelijk probleem: het account zit door zijn tegoed heen
+		return &upstreamError{Code: codeUpstreamUnavailable, Status: http.StatusServiceUnavailable, Message: "AI provider unavailable", Err: err}
+	case statusCode == http.StatusTooManyRequests:
+		return &upstreamError{Code: codeUpstreamRateLimited, Status: http.StatusTooManyRequests, Message: "AI provider rate limited, please retry later", RetryAfter: retryAfter, Err: err}
+	case statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		// 0 = netwerkfout (geen response ontvangen)
+		return &upstreamError{Code: codeUpstreamUnavailable, Status: http.StatusServiceUnavailable, Message: "AI provider unavailable", RetryAfter: retryAfter, Err: err}
+	case statusCode == http.StatusBadRequest && (strings.Contains(code, "image") || strings.Contains(message, "image")):
+		return &upstreamError{Code: codeUpstreamRejectedImage, Status: http.StatusUnprocessableEntity, Message: "AI provider rejected the image", Err: err}
+	default:
+		return &upstreamError{Code: codeAnalysisFailed, Status: http.StatusInternalServerError, Message: "AI analysis failed", Err: err}
+	}
+}
+
+// writeAnalysisError stuurt de juiste status en foutcode terug naar de client
+func writeAnalysisError(w http.ResponseWriter, r *http.Request, err error) {
+	var upErr *upstreamError
+	if !errors.As(err, &upErr) {
+		upErr = &upstreamError{Code: codeAnalysisFailed, Status: http.StatusInternalServerError, Message: "AI analysis failed", Err: err}
+	}
+	addLogAttrs(r.Context(), slog.String("errorCode", upErr.Code), slog.String("error", upErr.Error()))
+
+	if upErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(upErr.RetryAfter.Seconds()))))
+	}
+	w.WriteHeader(upErr.Status)
+	json.NewEncoder(w).Encode(map[string]string{"error": upErr.Message, "code": upErr.Code})
+}
+
+// ========================================
+// RETRY-AFTER HEADER
+// ========================================
+
+// De OpenAI SDK geeft response headers niet door in zijn errors, dus we lezen
+// Retry-After zelf uit via een eigen HTTP doer en een pointer in de context.
+type retryAfterKey struct{}
+
+type retryAfterDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if resp != nil {
+		if target, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*target = parseRetryAfter(resp.Header)
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter leest "retry-after-ms" of "Retry-After" (seconden of HTTP datum)
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.Atoi(h.Get("Retry-After-Ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ========================================
+// CIRCUIT BREAKER
+// ========================================
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // alles normaal
+	breakerOpen                         // provider is down, direct falen
+	breakerHalfOpen                     // één proefrequest toegestaan
+)
+
+// circuitBreaker stopt met requests naar de provider als die herhaaldelijk faalt
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	threshold int           // aantal fouten op rij voordat de breaker opengaat
+	cooldown  time.Duration // hoe lang de breaker open blijft
+	openedAt  time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow geeft false terug (plus resterende wachttijd) als de breaker open is
+func (b *circuitBreaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return 0, true
+	case breakerHalfOpen:
+		if b.probing {
+			return b.cooldown, false // er loopt al een proefrequest
+		}
+		b.probing = true
+		return 0, true
+	default:
+		return 0, true
+	}
+}
+
+// currentState geeft de huidige status (voor metrics)
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// isOpen geeft aan of de breaker op dit moment requests tegenhoudt
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// abandon geeft een proefrequest terug zonder oordeel over de provider (bijv. de client ging weg)
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testVisionRequest = visionRequest{Check: "powerCordInSocket", UserText: "check", ImageURL: "data:image/jpeg;base64,AAAA", ImageDetail: "low"}
+
+// answerWith is een upstream die met status en een OpenAI foutbody antwoordt (plus eventuele headers)
+func answerWith(status int, body string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+// completion is een geslaagd antwoord van het model
+var completion = answerWith(http.StatusOK, `{"id":"c1","object":"chat.completion","model":"test-model-2026","choices":[{"index":0,"message":{"role":"assistant","content":"{\"result\":\"PASS\"}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantCode   string
+		wantStatus int
+		wantRetry  time.Duration
+	}{
+		{"rate limited", answerWith(http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, "Retry-After", "3"),
+			codeUpstreamRateLimited, http.StatusTooManyRequests, 3 * time.Second},
+		{"rate limited in ms", answerWith(http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests"}}`, "Retry-After-Ms", "1500", "Retry-After", "2"),
+			codeUpstreamRateLimited, http.StatusTooManyRequests, 1500 * time.Millisecond},
+		{"insufficient quota", answerWith(http.StatusTooManyRequests, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`, "Retry-After", "3"),
+			codeUpstreamUnavailable, http.StatusServiceUnavailable, 0},
+		{"server error", failWith(http.StatusInternalServerError), codeUpstreamUnavailable, http.StatusServiceUnavailable, 0},
+		{"overloaded", answerWith(http.StatusServiceUnavailable, `{"error":{"message":"overloaded","type":"server_error"}}`, "Retry-After", "1"),
+			codeUpstreamUnavailable, http.StatusServiceUnavailable, time.Second},
+		{"request timeout", failWith(http.StatusRequestTimeout), codeUpstreamUnavailable, http.StatusServiceUnavailable, 0},
+		{"image rejected by code", answerWith(http.StatusBadRequest, `{"error":{"message":"Invalid request","type":"invalid_request_error","code":"invalid_image_format"}}`),
+			codeUpstreamRejectedImage, http.StatusUnprocessableEntity, 0},
+		{"image rejected by message", answerWith(http.StatusBadRequest, `{"error":{"message":"Could not process Image","type":"invalid_request_error"}}`),
+			codeUpstreamRejectedImage, http.StatusUnprocessableEntity, 0},
+		{"other bad request", answerWith(http.StatusBadRequest, `{"error":{"message":"Unknown parameter","type":"invalid_request_error"}}`),
+			codeAnalysisFailed, http.StatusInternalServerError, 0},
+		{"no JSON body", answerWith(http.StatusBadGateway, "<html>bad gateway</html>"), codeUpstreamUnavailable, http.StatusServiceUnavailable, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := testClient("primary", upstream(t, tt.handler))
+			_, err := v.call(context.Background(), testVisionRequest)
+			if err == nil {
+				t.Fatal("call succeeded, want an error")
+			}
+			got := classifyUpstreamError(err)
+			if got.Code != tt.wantCode || got.Status != tt.wantStatus || got.RetryAfter != tt.wantRetry {
+				t.Errorf("got %s %d retry %v, want %s %d retry %v (%v)", got.Code, got.Status, got.RetryAfter, tt.wantCode, tt.wantStatus, tt.wantRetry, err)
+			}
+		})
+	}
+
+	// Fouten van de context zelf, zonder response
+	if got := classifyUpstreamError(context.DeadlineExceeded); got.Code != codeUpstreamTimeout || got.Status != http.StatusGatewayTimeout {
+		t.Errorf("deadline: got %s %d, want %s 504", got.Code, got.Status, codeUpstreamTimeout)
+	}
+	if got := classifyUpstreamError(context.Canceled); got.Code != codeAnalysisFailed || got.Status != http.StatusInternalServerError {
+		t.Errorf("canceled: got %s %d, want %s 500", got.Code, got.Status, codeAnalysisFailed)
+	}
+	own := &upstreamError{Code: codeUpstreamRateLimited, Status: http.StatusTooManyRequests}
+	if got := classifyUpstreamError(retryAfterError{err: own}); got != own {
+		t.Errorf("own upstreamError was replaced by %+v", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		min, max time.Duration
+	}{
+		{"none", nil, 0, 0},
+		{"seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second, 7 * time.Second},
+		{"ms wins", map[string]string{"Retry-After-Ms": "250", "Retry-After": "7"}, 250 * time.Millisecond, 250 * time.Millisecond},
+		{"bad ms falls back", map[string]string{"Retry-After-Ms": "soon", "Retry-After": "2"}, 2 * time.Second, 2 * time.Second},
+		{"http date", map[string]string{"Retry-After": time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)}, 8 * time.Second, 10 * time.Second},
+		{"date in the past", map[string]string{"Retry-After": time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}, 0, 0},
+		{"zero", map[string]string{"Retry-After": "0"}, 0, 0},
+		{"negative", map[string]string{"Retry-After": "-5"}, 0, 0},
+		{"garbage", map[string]string{"Retry-After": "later"}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			if got := parseRetryAfter(h); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryAfterDoer(t *testing.T) {
+	url := upstream(t, answerWith(http.StatusTooManyRequests, `{}`, "Retry-After", "4"))
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Zonder pointer in de context: niets te bewaren, en geen panic
+	resp, err := retryAfterDoer{doer: http.DefaultClient}.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var retryAfter time.Duration
+	resp, err = retryAfterDoer{doer: http.DefaultClient}.Do(req.WithContext(context.WithValue(context.Background(), retryAfterKey{}, &retryAfter)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if retryAfter != 4*time.Second {
+		t.Errorf("retry after = %v, want 4s", retryAfter)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, ceiling := range []time.Duration{100, 200, 400, 800, 1000, 1000, 1000} {
+		ceiling *= time.Millisecond
+		var longest time.Duration
+		for range 500 {
+			d := p.backoff(attempt)
+			if d < 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want between 0 and %v", attempt, d, ceiling)
+			}
+			longest = max(longest, d)
+		}
+		// Full jitter: de wachttijd groeit met de poging (de kans dat 500 waarden onder de helft blijven is nihil)
+		if longest <= ceiling/2 {
+			t.Errorf("backoff(%d) never above %v, want it to grow to %v", attempt, ceiling/2, ceiling)
+		}
+	}
+	if d := p.backoff(60); d < 0 || d > p.MaxDelay {
+		t.Errorf("backoff(60) = %v, want at most %v", d, p.MaxDelay)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cooldown := 30 * time.Millisecond
+	b := newCircuitBreaker(2, cooldown)
+	mustAllow := func(want bool) {
+		t.Helper()
+		if _, ok := b.allow(); ok != want {
+			t.Fatalf("allow = %v in state %d, want %v", ok, b.currentState(), want)
+		}
+	}
+	mustState := func(want breakerState) {
+		t.Helper()
+		if got := b.currentState(); got != want {
+			t.Fatalf("state = %d, want %d", got, want)
+		}
+	}
+
+	// Closed: fouten onder de drempel houden hem dicht, een succes zet de teller terug
+	mustAllow(true)
+	b.failure()
+	b.success()
+	b.failure()
+	mustState(breakerClosed)
+
+	// De tweede fout op rij: open, met de resterende cooldown als wachttijd
+	b.failure()
+	mustState(breakerOpen)
+	if wait, ok := b.allow(); ok || wait <= 0 || wait > cooldown {
+		t.Fatalf("open breaker: allow = %v, wait %v, want refused with at most %v", ok, wait, cooldown)
+	}
+	if !b.isOpen() {
+		t.Error("isOpen = false for an open breaker")
+	}
+
+	// Na de cooldown: half-open, precies één proefrequest
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if b.isOpen() {
+		t.Error("isOpen = true after the cooldown")
+	}
+	mustAllow(true)
+	mustState(breakerHalfOpen)
+	mustAllow(false)
+
+	// Proef mislukt: meteen weer open, ook al is de drempel 2
+	b.failure()
+	mustState(breakerOpen)
+	mustAllow(false)
+
+	// Proef afgebroken (client weg): de volgende request mag proberen
+	time.Sleep(cooldown + 10*time.Millisecond)
+	mustAllow(true)
+	b.abandon()
+	mustState(breakerHalfOpen)
+	mustAllow(true)
+
+	// Proef gelukt: dicht, en de teller begint opnieuw
+	b.success()
+	mustState(breakerClosed)
+	mustAllow(true)
+	mustAllow(true)
+	b.failure()
+	mustState(breakerClosed)
+}
+
+func TestAnalyzeRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		answers   []http.HandlerFunc // per call, de laatste blijft gelden
+		wantCalls int32
+		wantCode  string // leeg = gelukt
+	}{
+		{"retry after server error", []http.HandlerFunc{failWith(http.StatusInternalServerError), completion}, 2, ""},
+		{"rate limit within max delay", []http.HandlerFunc{answerWith(http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`, "Retry-After-Ms", "5"), completion}, 2, ""},
+		// Langer wachten dan MaxDelay: niet blokkeren maar de 429 (met Retry-After) doorgeven
+		{"rate limit beyond max delay", []http.HandlerFunc{answerWith(http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`, "Retry-After", "30")}, 1, codeUpstreamRateLimited},
+		{"rejected image is final", []http.HandlerFunc{answerWith(http.StatusBadRequest, `{"error":{"message":"invalid image"}}`)}, 1, codeUpstreamRejectedImage},
+		{"gives up after max attempts", []http.HandlerFunc{failWith(http.StatusServiceUnavailable)}, 2, codeUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			v := testClient("primary", upstream(t, func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				tt.answers[min(n, len(tt.answers))-1](w, r)
+			}))
+			v.breaker = newCircuitBreaker(5, time.Minute) // breaker buiten beschouwing
+
+			answer, err := v.analyze(context.Background(), testVisionRequest)
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			if tt.wantCode == "" {
+				if err != nil || answer.Model != "test-model-2026" || answer.Usage.PromptTokens != 10 {
+					t.Fatalf("answer %+v, err %v, want the completion", answer, err)
+				}
+				return
+			}
+			var upErr *upstreamError
+			if !errors.As(err, &upErr) || upErr.Code != tt.wantCode {
+				t.Fatalf("err = %v, want %s", err, tt.wantCode)
+			}
+			if tt.wantCode == codeUpstreamRateLimited && upErr.RetryAfter != 30*time.Second {
+				t.Errorf("retry after = %v, want 30s for the client", upErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestAnalyzeOpensBreaker(t *testing.T) {
+	var calls atomic.Int32
+	v := testClient("primary", upstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		failWith(http.StatusBadGateway)(w, r)
+	}))
+	v.retry.MaxAttempts = 1
+	v.breaker = newCircuitBreaker(2, time.Minute)
+
+	for range 2 {
+		if _, err := v.analyze(context.Background(), testVisionRequest); err == nil {
+			t.Fatal("analyze succeeded against a failing upstream")
+		}
+	}
+	// Open: geen call meer, direct 503 met de resterende cooldown
+	_, err := v.analyze(context.Background(), testVisionRequest)
+	var upErr *upstreamError
+	if !errors.As(err, &upErr) || upErr.Code != codeUpstreamUnavailable || upErr.RetryAfter <= 0 {
+		t.Fatalf("err = %v, want %s with a retry after", err, codeUpstreamUnavailable)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2 (none while open)", calls.Load())
+	}
+}
+
+func TestAnalyzeDeadlineDuringBackoff(t *testing.T) {
+	var calls atomic.Int32
+	url := upstream(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		answerWith(http.StatusServiceUnavailable, `{"error":{"message":"overloaded"}}`, "Retry-After-Ms", "500")(w, r)
+	})
+	v := newVisionClient(
+		providerConfig{Name: "primary", Model: "primary-model", BaseURL: url, APIKey: "test"},
+		retryConfig{MaxAttempts: 3, BaseDelay: duration(time.Millisecond), MaxDelay: duration(time.Second)},
+		breakerConfig{Threshold: 5, Cooldown: duration(time.Minute)},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := v.analyze(ctx, testVisionRequest)
+
+	if elapsed := time.Since(started); elapsed > 400*time.Millisecond {
+		t.Errorf("analyze took %v, want it to stop at the deadline", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+	// De deadline bepaalt de foutcode, de laatste providerfout staat erbij
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), codeUpstreamUnavailable) {
+		t.Fatalf("err = %v, want the deadline with the last error", err)
+	}
+	if got := classifyUpstreamError(err); got.Code != codeUpstreamTimeout {
+		t.Errorf("classified as %s, want %s", got.Code, codeUpstreamTimeout)
+	}
+}